@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var errUnknownAssetType = errors.New("unknown asset type")
+
+// decodeAsset builds an asset of the given type from its JSON and validates
+// it, resolving links against the existing assets it lives alongside. A
+// missing ID is generated.
+func decodeAsset(typ string, raw json.RawMessage, existing []Asset) (Asset, error) {
+	asset, err := newAsset(typ)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, asset); err != nil {
+		return nil, err
+	}
+	if err := validateAsset(asset, existing); err != nil {
+		return nil, err
+	}
+	if asset.GetID() == uuid.Nil {
+		setAssetID(asset, uuid.New())
+	}
+	return asset, nil
+}
+
+// newAsset returns an empty asset of the given type
+func newAsset(typ string) (Asset, error) {
+	switch typ {
+	case ChartType:
+		return &Chart{}, nil
+	case InsightType:
+		return &Insight{}, nil
+	case AudienceType:
+		return &Audience{}, nil
+	}
+	return nil, errUnknownAssetType
+}
+
+// setAssetID gives the asset a new ID
+func setAssetID(asset Asset, id uuid.UUID) {
+	switch a := asset.(type) {
+	case *Chart:
+		a.ID = id
+	case *Insight:
+		a.ID = id
+	case *Audience:
+		a.ID = id
+	}
+}
+
+// copyAsset returns a copy of the asset to change: stored assets are replaced
+// rather than changed in place, as readers don't hold the store lock
+func copyAsset(asset Asset) Asset {
+	switch a := asset.(type) {
+	case *Chart:
+		c := *a
+		return &c
+	case *Insight:
+		c := *a
+		return &c
+	case *Audience:
+		c := *a
+		return &c
+	}
+	return asset
+}
+
+// validateAsset normalizes and checks the fields shared by every asset type,
+// then the type-specific ones
+func validateAsset(asset Asset, existing []Asset) error {
+	tags, err := normalizeTags(asset.GetTags())
+	if err != nil {
+		return err
+	}
+	asset.SetTags(tags)
+	if i, ok := asset.(*Insight); ok {
+		return validateInsight(existing, i)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHandleAddFavourite_AudienceRules(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+
+	add := func(rules string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"type":     AudienceType,
+			"favorite": true,
+			"asset":    map[string]interface{}{"rules": rules},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/favourites/add", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		AuthMiddleware(handleAddFavourite)(w, req)
+		return w
+	}
+
+	w := add(`gender = Female AND age BETWEEN 25 AND 34`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var resp Audience
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Rules == nil || resp.Rules.String() != `gender = "Female" AND (age BETWEEN 25 AND 34)` {
+		t.Errorf("unexpected rules %v", resp.Rules)
+	}
+
+	if w := add(`gender BETWEEN 1 AND 2`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for invalid rules, got %d", http.StatusBadRequest, w.Code)
+	}
+}
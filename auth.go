@@ -11,18 +11,67 @@ import (
 	"github.com/google/uuid"
 )
 
-var jwtSecret = []byte("supersecretkey") // Change this in production
+var (
+	// jwtSecret signs every token; set by auth.jwt_secret
+	jwtSecret = []byte(defaultJWTSecret)
+	// tokenLifetime is how long the tokens of GenerateJWT are valid; set by auth.token_lifetime
+	tokenLifetime = 24 * time.Hour
+)
 
-// GenerateJWT creates a JWT token for a given user ID
+// GenerateJWT creates a JWT token for a given user ID, scoped to the
+// tenant (organisation) the user currently belongs to
 func GenerateJWT(userID uuid.UUID) (string, error) {
+	tenantID := uuid.Nil
+	if user := store.GetUser(userID); user != nil {
+		tenantID = store.TenantOf(user)
+	}
+	return GenerateTenantJWT(userID, tenantID)
+}
+
+// GenerateTenantJWT creates a JWT token for a user within a tenant
+func GenerateTenantJWT(userID, tenantID uuid.UUID) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID.String(),
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // 24h expiry
+		"user_id":   userID.String(),
+		"tenant_id": tenantID.String(),
+		"exp":       time.Now().Add(currentTokenLifetime()).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
 }
 
+// GenerateShareToken signs the token of a public share link, valid until expiresAt
+func GenerateShareToken(linkID uuid.UUID, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"link_id": linkID.String(),
+		"exp":     expiresAt.Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+// parseShareToken verifies a share link token and returns its link ID
+func parseShareToken(tokenStr string) (uuid.UUID, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return uuid.Nil, jwt.ErrSignatureInvalid
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return uuid.Nil, jwt.ErrSignatureInvalid
+	}
+	// user tokens carry no link_id, so they can't be used as share links
+	linkIDStr, ok := claims["link_id"].(string)
+	if !ok {
+		return uuid.Nil, jwt.ErrSignatureInvalid
+	}
+	return uuid.Parse(linkIDStr)
+}
+
 // TokenHandler issues a JWT for a given user_id (POST /token)
 func TokenHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -49,55 +98,128 @@ func TokenHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func extractUserIDFromToken(r *http.Request) (uuid.UUID, error) {
+// extractIdentityFromToken returns the user and tenant IDs of the bearer
+// token. Tokens without a tenant_id claim belong to the tenant uuid.Nil.
+func extractIdentityFromToken(r *http.Request) (uuid.UUID, uuid.UUID, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return uuid.Nil, http.ErrNoCookie
+		return uuid.Nil, uuid.Nil, http.ErrNoCookie
 	}
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return uuid.Nil, http.ErrNoCookie
+		return uuid.Nil, uuid.Nil, http.ErrNoCookie
+	}
+	return parseUserToken(parts[1])
+}
+
+// extractIdentity authenticates a request by its bearer token or, without
+// one, by its client certificate
+func extractIdentity(r *http.Request) (uuid.UUID, uuid.UUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return identityFromCertificate(r.TLS)
 	}
-	tokenStr := parts[1]
+	return extractIdentityFromToken(r)
+}
+
+// hasCredentials reports whether a request carries a token or a verified
+// client certificate
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || (r.TLS != nil && len(r.TLS.VerifiedChains) > 0)
+}
+
+// parseUserToken returns the user and tenant IDs of a user JWT
+func parseUserToken(tokenStr string) (uuid.UUID, uuid.UUID, error) {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		return jwtSecret, nil
 	})
 	if err != nil || !token.Valid {
-		return uuid.Nil, http.ErrNoCookie
+		return uuid.Nil, uuid.Nil, http.ErrNoCookie
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return uuid.Nil, http.ErrNoCookie
+		return uuid.Nil, uuid.Nil, http.ErrNoCookie
 	}
 	userIDStr, ok := claims["user_id"].(string)
 	if !ok {
-		return uuid.Nil, http.ErrNoCookie
+		return uuid.Nil, uuid.Nil, http.ErrNoCookie
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
 	}
-	return uuid.Parse(userIDStr)
+	tenantID := uuid.Nil
+	if tenantIDStr, ok := claims["tenant_id"].(string); ok {
+		if tenantID, err = uuid.Parse(tenantIDStr); err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+	}
+	return userID, tenantID, nil
+}
+
+// tokenExpiry returns when the bearer token of an authenticated request
+// expires; ok is false for requests without a token or a token without exp
+func tokenExpiry(r *http.Request) (expiresAt time.Time, ok bool) {
+	tokenStr := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}); err != nil {
+		return time.Time{}, false
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
 }
 
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := extractUserIDFromToken(r)
+		userID, tenantID, err := extractIdentity(r)
 		if err != nil || userID == uuid.Nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		// Attach userID to context for handlers
+		// Attach userID and tenantID to context for handlers
 		ctx := r.Context()
 		ctx = contextWithUserID(ctx, userID)
+		ctx = context.WithValue(ctx, tenantIDKey, tenantID)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			serveMutation(w, r.WithContext(ctx), next)
+			return
+		}
 		next(w, r.WithContext(ctx))
 	}
 }
 
 type contextKey string
 
-const userIDKey contextKey = "userID"
+const (
+	userIDKey   contextKey = "userID"
+	tenantIDKey contextKey = "tenantID"
+)
 
 func contextWithUserID(ctx context.Context, userID uuid.UUID) context.Context {
 	return context.WithValue(ctx, userIDKey, userID)
 }
 
+// getTenantIDFromContext returns the tenant of the token, uuid.Nil for users
+// outside any organisation
+func getTenantIDFromContext(r *http.Request) uuid.UUID {
+	if id, ok := r.Context().Value(tenantIDKey).(uuid.UUID); ok {
+		return id
+	}
+	return uuid.Nil
+}
+
+// userFromContext returns the user of the identity AuthMiddleware or the
+// gRPC interceptors put in the context
+func userFromContext(ctx context.Context) *User {
+	userID, _ := ctx.Value(userIDKey).(uuid.UUID)
+	tenantID, _ := ctx.Value(tenantIDKey).(uuid.UUID)
+	return store.GetTenantUser(tenantID, userID)
+}
+
 func getUserIDFromContext(r *http.Request) uuid.UUID {
 	val := r.Context().Value(userIDKey)
 	if id, ok := val.(uuid.UUID); ok {
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxImportBytes   = 10 << 20
+	maxImportRecords = 10000
+	tagSeparator     = ";"
+)
+
+// csvHeader is the column layout of CSV exports. On import only type and
+// asset are required; the other columns, when present and not empty,
+// override the matching fields of the asset JSON.
+var csvHeader = []string{"type", "id", "favorite", "description", "tags", "asset"}
+
+// Conflict policies for imported assets whose ID is already taken
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictDuplicate = "duplicate"
+)
+
+// importRecord is one asset read from an import file
+type importRecord struct {
+	Line  int
+	Type  string
+	Asset json.RawMessage
+	Err   error
+}
+
+// ImportResult reports what happened to one line of an import
+type ImportResult struct {
+	Line   int       `json:"line"`
+	Status string    `json:"status"`
+	ID     uuid.UUID `json:"id"`
+	Type   string    `json:"type,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// ImportReport summarizes an import
+type ImportReport struct {
+	DryRun      bool           `json:"dry_run"`
+	Created     int            `json:"created"`
+	Overwritten int            `json:"overwritten"`
+	Skipped     int            `json:"skipped"`
+	Failed      int            `json:"failed"`
+	Results     []ImportResult `json:"results"`
+}
+
+// Streams all the user's assets, in display order, as JSON Lines
+// ({"type", "asset"} per line) or CSV: GET /favourites/export?format=jsonl|csv
+func handleExportFavourites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleExportFavourites: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleExportFavourites")
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "csv" {
+		log.Printf("handleExportFavourites: unknown format %q", format)
+		http.Error(w, "Format must be jsonl or csv", http.StatusBadRequest)
+		return
+	}
+	assets := sortedFavourites(user)
+	flusher, _ := w.(http.Flusher)
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="favourites.`+format+`"`)
+
+	enc := json.NewEncoder(w)
+	cw := csv.NewWriter(w)
+	if format == "csv" {
+		cw.Write(csvHeader)
+	}
+	for n, asset := range assets {
+		var err error
+		if format == "jsonl" {
+			err = enc.Encode(struct {
+				Type  string `json:"type"`
+				Asset Asset  `json:"asset"`
+			}{asset.GetType(), asset})
+		} else {
+			raw, _ := json.Marshal(asset)
+			err = cw.Write([]string{
+				asset.GetType(),
+				asset.GetID().String(),
+				strconv.FormatBool(asset.IsFavorite()),
+				escapeCSVCell(asset.GetDescription()),
+				escapeCSVCell(strings.Join(asset.GetTags(), tagSeparator)),
+				string(raw),
+			})
+		}
+		if err != nil {
+			log.Printf("handleExportFavourites: client went away: %v", err)
+			return
+		}
+		if n%100 == 99 && flusher != nil {
+			cw.Flush()
+			flusher.Flush()
+		}
+	}
+	cw.Flush()
+	log.Printf("handleExportFavourites: exported %d assets of user %s as %s", len(assets), user.ID, format)
+}
+
+// escapeCSVCell prefixes cells a spreadsheet would run as a formula with a
+// quote, so an exported description such as "=HYPERLINK(...)" stays text.
+// Cells starting with a quote get one too, so the import strips only ours.
+func escapeCSVCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r'", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeCSVCell reverses escapeCSVCell, so exports import unchanged
+func unescapeCSVCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && escapeCSVCell(cell[1:]) == cell {
+		return cell[1:]
+	}
+	return cell
+}
+
+// readJSONLines reads {"type", "asset"} objects, one per non-blank line
+func readJSONLines(body io.Reader) ([]importRecord, error) {
+	records := make([]importRecord, 0)
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), maxImportBytes)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec struct {
+			Type  string          `json:"type"`
+			Asset json.RawMessage `json:"asset"`
+		}
+		err := json.Unmarshal([]byte(text), &rec)
+		records = append(records, importRecord{Line: line, Type: rec.Type, Asset: rec.Asset, Err: err})
+	}
+	return records, scanner.Err()
+}
+
+// readCSV reads records laid out as csvHeader; columns are matched by name
+func readCSV(body io.Reader) ([]importRecord, error) {
+	cr := csv.NewReader(body)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for n, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = n
+	}
+	if _, ok := cols["type"]; !ok {
+		return nil, errors.New("missing type column")
+	}
+	records := make([]importRecord, 0)
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			records = append(records, importRecord{Line: parseErr.StartLine, Err: err})
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			if n, ok := cols[name]; ok {
+				return unescapeCSVCell(strings.TrimSpace(row[n]))
+			}
+			return ""
+		}
+		rec := importRecord{Line: line, Type: field("type")}
+		rec.Asset, rec.Err = csvAsset(field)
+		records = append(records, rec)
+	}
+}
+
+// csvAsset builds the asset JSON of a CSV row from its asset column and the
+// non-empty override columns
+func csvAsset(field func(string) string) (json.RawMessage, error) {
+	raw := field("asset")
+	if raw == "" {
+		raw = "{}"
+	}
+	doc, err := decodeJSON([]byte(raw))
+	if err != nil {
+		return nil, fmt.Errorf("asset column: %v", err)
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("asset column must be a JSON object")
+	}
+	if id := field("id"); id != "" {
+		obj[fieldKey(obj, "ID")] = id
+	}
+	if fav := field("favorite"); fav != "" {
+		b, err := strconv.ParseBool(fav)
+		if err != nil {
+			return nil, fmt.Errorf("favorite column: %q is not a boolean", fav)
+		}
+		obj[fieldKey(obj, "Favorite")] = b
+	}
+	if desc := field("description"); desc != "" {
+		obj[fieldKey(obj, "Description")] = desc
+	}
+	if tags := field("tags"); tags != "" {
+		list := make([]interface{}, 0)
+		for _, tag := range strings.Split(tags, tagSeparator) {
+			list = append(list, tag)
+		}
+		obj[fieldKey(obj, "Tags")] = list
+	}
+	return json.Marshal(obj)
+}
+
+// Imports assets from JSON Lines or CSV, validating each line like
+// /favourites/add and reporting per line:
+// POST /favourites/import?format=jsonl|csv&dry_run=true&on_conflict=skip|overwrite|duplicate
+func handleImportFavourites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("handleImportFavourites: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleImportFavourites")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "jsonl"
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			format = "csv"
+		}
+	}
+	onConflict := query.Get("on_conflict")
+	if onConflict == "" {
+		onConflict = conflictSkip
+	}
+	if onConflict != conflictSkip && onConflict != conflictOverwrite && onConflict != conflictDuplicate {
+		log.Printf("handleImportFavourites: unknown on_conflict %q", onConflict)
+		http.Error(w, "on_conflict must be skip, overwrite or duplicate", http.StatusBadRequest)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(query.Get("dry_run"))
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var records []importRecord
+	var err error
+	switch format {
+	case "jsonl":
+		records, err = readJSONLines(body)
+	case "csv":
+		records, err = readCSV(body)
+	default:
+		log.Printf("handleImportFavourites: unknown format %q", format)
+		http.Error(w, "Format must be jsonl or csv", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("handleImportFavourites: cannot read %s: %v", format, err)
+		http.Error(w, "Invalid "+format+" file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(records) > maxImportRecords {
+		log.Printf("handleImportFavourites: %d records exceed the limit", len(records))
+		http.Error(w, fmt.Sprintf("At most %d assets can be imported at once", maxImportRecords), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	report := importAssets(user, records, onConflict, dryRun)
+	log.Printf("handleImportFavourites: user %s imported %d, overwrote %d, skipped %d, failed %d (dry run %v)",
+		user.ID, report.Created, report.Overwritten, report.Skipped, report.Failed, dryRun)
+	json.NewEncoder(w).Encode(report)
+}
+
+// importAssets validates and applies the records in order, so that insights
+// can relate to assets imported on earlier lines. In a dry run nothing is
+// stored but the report is the same.
+func importAssets(user *User, records []importRecord, onConflict string, dryRun bool) ImportReport {
+	report := ImportReport{DryRun: dryRun, Results: make([]ImportResult, 0, len(records))}
+	working := append([]Asset{}, store.FavouritesOf(user)...)
+	for _, rec := range records {
+		result := ImportResult{Line: rec.Line, Type: rec.Type}
+		asset, err := rec.Asset, rec.Err
+		var decoded Asset
+		if err == nil {
+			decoded, err = decodeAsset(rec.Type, asset, working)
+		}
+		if err != nil {
+			result.Status, result.Error = "error", err.Error()
+			report.Failed++
+			report.Results = append(report.Results, result)
+			continue
+		}
+		result.ID = decoded.GetID()
+		existing := lookupAsset(working, decoded.GetID())
+		switch {
+		case existing != nil && onConflict == conflictSkip:
+			result.Status = "skipped"
+			report.Skipped++
+		case existing != nil && onConflict == conflictOverwrite:
+			result.Status = "overwritten"
+			report.Overwritten++
+			decoded.SetPosition(existing.GetPosition())
+			decoded.SetPinned(existing.IsPinned())
+			for n, a := range working {
+				if a == existing {
+					working[n] = decoded
+				}
+			}
+			if !dryRun {
+				store.ReplaceAsset(user, decoded)
+				recordRevision(user, decoded, user.ID, "import")
+				notify(user, EventUpdated, decoded)
+			}
+		default:
+			if existing != nil {
+				setAssetID(decoded, uuid.New())
+				result.ID = decoded.GetID()
+			}
+			if !dryRun {
+				// another request may have added the ID since working was taken
+				if err := store.AddAsset(user, decoded); err != nil {
+					result.Status, result.Error = "error", err.Error()
+					report.Failed++
+					break
+				}
+				recordRevision(user, decoded, user.ID, "import")
+				notify(user, EventCreated, decoded)
+			}
+			result.Status = "created"
+			report.Created++
+			working = append(working, decoded)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
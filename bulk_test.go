@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func importBody(t *testing.T, token, query, body string) ImportReport {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/favourites/import?"+query, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	AuthMiddleware(handleImportFavourites)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d importing, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var report ImportReport
+	json.NewDecoder(w.Body).Decode(&report)
+	return report
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	for _, format := range []string{"jsonl", "csv"} {
+		resetStore()
+		srcID, dstID := uuid.New(), uuid.New()
+		chart := &Chart{ID: uuid.New(), Title: "Sales", Data: []float64{1, 2}, Tags: []string{"q4", "kpi"}, Description: "desc, with comma", Favorite: true}
+		insight := &Insight{ID: uuid.New(), Text: "Up", RelatedAssets: []uuid.UUID{chart.ID}}
+		store.AddUser(&User{ID: srcID, Favourites: []Asset{chart, insight}})
+		store.AddUser(&User{ID: dstID})
+		srcToken, _ := GenerateJWT(srcID)
+		dstToken, _ := GenerateJWT(dstID)
+
+		w := doRequest(t, handleExportFavourites, srcToken, http.MethodGet, "/favourites/export?format="+format, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d exporting, got %d", format, http.StatusOK, w.Code)
+		}
+		report := importBody(t, dstToken, "format="+format, w.Body.String())
+		if report.Created != 2 || report.Failed != 0 {
+			t.Fatalf("%s: unexpected report %+v", format, report)
+		}
+		dst := store.GetUser(dstID)
+		got, ok := findAsset(dst, chart.ID).(*Chart)
+		if !ok || got.Title != "Sales" || got.Description != chart.Description || len(got.Tags) != 2 || !got.Favorite {
+			t.Errorf("%s: unexpected imported chart %+v", format, got)
+		}
+		if findAsset(dst, insight.ID) == nil {
+			t.Errorf("%s: insight relating to an earlier line was not imported", format)
+		}
+	}
+}
+
+func TestExportCSV_EscapesFormulas(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Sales", Description: `=HYPERLINK("http://example.com","x")`, Tags: []string{"@team", "q4"}}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart}})
+	token, _ := GenerateJWT(userID)
+
+	w := doRequest(t, handleExportFavourites, token, http.MethodGet, "/favourites/export?format=csv", nil)
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("unexpected export %v %v", rows, err)
+	}
+	if rows[1][3] != "'"+chart.Description || rows[1][4] != "'@team;q4" {
+		t.Errorf("expected formula cells prefixed with a quote, got %q and %q", rows[1][3], rows[1][4])
+	}
+
+	// The quotes are dropped again on import
+	w = doRequest(t, handleExportFavourites, token, http.MethodGet, "/favourites/export?format=csv", nil)
+	report := importBody(t, token, "format=csv&on_conflict=overwrite", w.Body.String())
+	got := findAsset(store.GetUser(userID), chart.ID).(*Chart)
+	if report.Overwritten != 1 || got.Description != chart.Description || got.Tags[0] != "@team" {
+		t.Errorf("expected the cells imported unchanged, got %+v %+v", report, got)
+	}
+	if unescapeCSVCell("'quoted") != "'quoted" {
+		t.Error("expected quotes not added by the export kept")
+	}
+	for _, cell := range []string{"'=1+1", "''@x", "'quoted", "=1+1", "plain"} {
+		if got := unescapeCSVCell(escapeCSVCell(cell)); got != cell {
+			t.Errorf("expected %q to round-trip, got %q", cell, got)
+		}
+	}
+
+	// A description the user started with a quote keeps it
+	quoted := &Chart{ID: uuid.New(), Title: "Quoted", Description: "'=SUM(A1:A2)"}
+	store.AddAsset(store.GetUser(userID), quoted)
+	w = doRequest(t, handleExportFavourites, token, http.MethodGet, "/favourites/export?format=csv", nil)
+	importBody(t, token, "format=csv&on_conflict=overwrite", w.Body.String())
+	if got := findAsset(store.GetUser(userID), quoted.ID).GetDescription(); got != quoted.Description {
+		t.Errorf("expected %q imported unchanged, got %q", quoted.Description, got)
+	}
+}
+
+func TestImport_ConflictsAndDryRun(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Original", Position: 1024}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart}})
+	token, _ := GenerateJWT(userID)
+	user := store.GetUser(userID)
+
+	body := strings.Join([]string{
+		`{"type":"chart","asset":{"ID":"` + chart.ID.String() + `","Title":"Imported"}}`,
+		``,
+		`{"type":"insight","asset":{"Text":"x","Sources":[{"URL":"ftp://example.com"}]}}`,
+		`{"type":"widget","asset":{}}`,
+		`not json`,
+	}, "\n")
+
+	report := importBody(t, token, "dry_run=true&on_conflict=overwrite", body)
+	if !report.DryRun || report.Overwritten != 1 || report.Failed != 3 || len(user.Favourites) != 1 || chart.Title != "Original" {
+		t.Fatalf("unexpected dry run %+v, favourites %d", report, len(user.Favourites))
+	}
+	if report.Results[1].Line != 3 || report.Results[1].Status != "error" || report.Results[3].Line != 5 {
+		t.Errorf("unexpected per-line results %+v", report.Results)
+	}
+
+	if report := importBody(t, token, "", body); report.Skipped != 1 || findAsset(user, chart.ID).(*Chart).Title != "Original" {
+		t.Errorf("expected the conflicting chart to be skipped, got %+v", report)
+	}
+	if report := importBody(t, token, "on_conflict=duplicate", body); report.Created != 1 || report.Results[0].ID == chart.ID || len(user.Favourites) != 2 {
+		t.Errorf("expected a duplicate with a new ID, got %+v", report)
+	}
+	importBody(t, token, "on_conflict=overwrite", body)
+	if got := findAsset(user, chart.ID).(*Chart); got.Title != "Imported" || got.Position != 1024 {
+		t.Errorf("expected chart overwritten in place, got %+v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/favourites/import?on_conflict=merge", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	AuthMiddleware(handleImportFavourites)(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for unknown on_conflict, got %d", http.StatusBadRequest, w.Code)
+	}
+}
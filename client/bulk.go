@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// ImportOptions configures Import
+type ImportOptions struct {
+	// Format is jsonl or csv
+	Format string
+	DryRun bool
+	// OnConflict is skip (the default), overwrite or duplicate
+	OnConflict string
+}
+
+// ImportResult is the outcome of one line of an import
+type ImportResult struct {
+	Line   int       `json:"line"`
+	Status string    `json:"status"`
+	ID     uuid.UUID `json:"id,omitempty"`
+	Type   string    `json:"type,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// ImportReport summarizes an import
+type ImportReport struct {
+	DryRun      bool           `json:"dry_run"`
+	Created     int            `json:"created"`
+	Overwritten int            `json:"overwritten"`
+	Skipped     int            `json:"skipped"`
+	Failed      int            `json:"failed"`
+	Results     []ImportResult `json:"results"`
+}
+
+// Export writes every asset of the user to w as JSON Lines ({"type",
+// "asset"} per line) or CSV
+func (c *Client) Export(ctx context.Context, format string, w io.Writer) error {
+	resp, err := c.send(ctx, c.HTTPClient, http.MethodGet, "/favourites/export", url.Values{"format": {format}}, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Import creates assets from a JSON Lines or CSV file. Imports are not
+// retried, the server may have run them.
+func (c *Client) Import(ctx context.Context, data []byte, opts ImportOptions) (*ImportReport, error) {
+	query := url.Values{"dry_run": {strconv.FormatBool(opts.DryRun)}}
+	contentType := "application/x-ndjson"
+	if opts.Format != "" {
+		query.Set("format", opts.Format)
+		if opts.Format == "csv" {
+			contentType = "text/csv"
+		}
+	}
+	if opts.OnConflict != "" {
+		query.Set("on_conflict", opts.OnConflict)
+	}
+	resp, err := c.send(ctx, c.HTTPClient, http.MethodPost, "/favourites/import", query, contentType, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var report ImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
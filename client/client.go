@@ -0,0 +1,301 @@
+// Package client is a Go client for the favourites API. It decodes assets
+// into the models types the server uses.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"platform-go-challenge/models"
+)
+
+// Client calls the API at BaseURL. Its fields may be changed before its
+// first request.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Token is the JWT sent with every request; Login sets it
+	Token string
+	// MaxRetries is how many times a request is retried after a network error
+	// or a 429, 502, 503 or 504 response. Only 429 responses are retried for
+	// POST requests, which the server did not run.
+	MaxRetries int
+	// RetryWait is the wait before the first retry, doubled for each next one
+	// unless the server sends Retry-After
+	RetryWait time.Duration
+	// PageSize is the number of favourites ListFavourites fetches per request
+	PageSize int
+}
+
+// New returns a client of the API at baseURL, e.g. http://localhost:8080
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		MaxRetries: 3,
+		RetryWait:  200 * time.Millisecond,
+		PageSize:   100,
+	}
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("favourites API: %d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Login obtains a token for the user and uses it for the next requests
+func (c *Client) Login(ctx context.Context, userID uuid.UUID) (string, error) {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/token", nil, map[string]string{"user_id": userID.String()}, &resp); err != nil {
+		return "", err
+	}
+	c.Token = resp.Token
+	return resp.Token, nil
+}
+
+// ListOptions filters ListFavourites
+type ListOptions struct {
+	CollectionID uuid.UUID
+	Tag          string
+}
+
+// ListFavourites returns every asset marked favourite, pinned first then in
+// the user's order, fetching as many pages as needed
+func (c *Client) ListFavourites(ctx context.Context, opts *ListOptions) ([]models.Asset, error) {
+	query := url.Values{}
+	if opts != nil && opts.CollectionID != uuid.Nil {
+		query.Set("collection", opts.CollectionID.String())
+	}
+	if opts != nil && opts.Tag != "" {
+		query.Set("tag", opts.Tag)
+	}
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	query.Set("limit", strconv.Itoa(pageSize))
+	var assets []models.Asset
+	for {
+		query.Set("offset", strconv.Itoa(len(assets)))
+		var page []json.RawMessage
+		if err := c.do(ctx, http.MethodGet, "/favourites", query, nil, &page); err != nil {
+			return nil, err
+		}
+		decoded, err := decodeAssets(page)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, decoded...)
+		if len(page) < pageSize {
+			return assets, nil
+		}
+	}
+}
+
+// GetAsset returns an asset owned by or shared with the user
+func (c *Client) GetAsset(ctx context.Context, id uuid.UUID) (models.Asset, error) {
+	return c.assetCall(ctx, http.MethodGet, "/favourites/"+id.String(), nil, nil)
+}
+
+// AddChart creates a chart; the server generates its ID when it has none
+func (c *Client) AddChart(ctx context.Context, chart *models.Chart, favorite bool) (*models.Chart, error) {
+	var out models.Chart
+	return &out, c.add(ctx, models.ChartType, chart, favorite, &out)
+}
+
+// AddInsight creates an insight; the server generates its ID when it has none
+func (c *Client) AddInsight(ctx context.Context, insight *models.Insight, favorite bool) (*models.Insight, error) {
+	var out models.Insight
+	return &out, c.add(ctx, models.InsightType, insight, favorite, &out)
+}
+
+// AddAudience creates an audience; the server generates its ID when it has none
+func (c *Client) AddAudience(ctx context.Context, audience *models.Audience, favorite bool) (*models.Audience, error) {
+	var out models.Audience
+	return &out, c.add(ctx, models.AudienceType, audience, favorite, &out)
+}
+
+func (c *Client) add(ctx context.Context, typ string, asset models.Asset, favorite bool, out interface{}) error {
+	body := map[string]interface{}{"type": typ, "asset": asset, "favorite": favorite}
+	return c.do(ctx, http.MethodPost, "/favourites/add", nil, body, out)
+}
+
+// EditDescription sets the description of an asset
+func (c *Client) EditDescription(ctx context.Context, id uuid.UUID, description string) (models.Asset, error) {
+	return c.assetCall(ctx, http.MethodPut, "/favourites/edit", assetQuery(id), map[string]string{"description": description})
+}
+
+// SetFavourite marks an asset favourite or not
+func (c *Client) SetFavourite(ctx context.Context, id uuid.UUID, favorite bool) (models.Asset, error) {
+	return c.assetCall(ctx, http.MethodPut, "/favourites/remove", assetQuery(id), map[string]bool{"favorite": favorite})
+}
+
+// ToggleFavourite flips the favourite mark of an asset
+func (c *Client) ToggleFavourite(ctx context.Context, id uuid.UUID) (models.Asset, error) {
+	asset, err := c.GetAsset(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return c.SetFavourite(ctx, id, !asset.IsFavorite())
+}
+
+// Delete moves an asset to the user's trash
+func (c *Client) Delete(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/favourites/delete", assetQuery(id), nil, nil)
+}
+
+func assetQuery(id uuid.UUID) url.Values {
+	return url.Values{"asset_id": {id.String()}}
+}
+
+func (c *Client) assetCall(ctx context.Context, method, path string, query url.Values, body interface{}) (models.Asset, error) {
+	var raw json.RawMessage
+	if err := c.do(ctx, method, path, query, body, &raw); err != nil {
+		return nil, err
+	}
+	return DecodeAsset(raw)
+}
+
+// DecodeAsset decodes an asset as the API encodes it. Assets carry no type,
+// so it is told by the fields only one type has.
+func DecodeAsset(data []byte) (models.Asset, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var asset models.Asset
+	switch {
+	case fields["Title"] != nil:
+		asset = &models.Chart{}
+	case fields["Text"] != nil:
+		asset = &models.Insight{}
+	case fields["Rules"] != nil:
+		asset = &models.Audience{}
+	default:
+		return nil, errors.New("favourites API: asset of unknown type")
+	}
+	if err := json.Unmarshal(data, asset); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+func decodeAssets(raw []json.RawMessage) ([]models.Asset, error) {
+	assets := make([]models.Asset, 0, len(raw))
+	for _, data := range raw {
+		asset, err := DecodeAsset(data)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, nil
+}
+
+// do sends the request, retrying it as configured, and decodes the JSON
+// response into out unless it is nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var payload []byte
+	contentType := ""
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+	resp, err := c.send(ctx, c.HTTPClient, method, path, query, contentType, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends the request with hc, retrying it as configured. Error
+// responses are returned as *Error; the caller closes the body of others.
+func (c *Client) send(ctx context.Context, hc *http.Client, method, path string, query url.Values, contentType string, payload []byte) (*http.Response, error) {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+		resp, err := hc.Do(req)
+		retry := err != nil && method != http.MethodPost
+		if err == nil {
+			retry = resp.StatusCode == http.StatusTooManyRequests ||
+				method != http.MethodPost && (resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout)
+		}
+		if !retry || attempt >= c.MaxRetries {
+			if err != nil {
+				return nil, err
+			}
+			if err := responseError(resp); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			if after, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+				wait = time.Duration(after) * time.Second
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// responseError closes the body of an error response and returns it as *Error
+func responseError(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+}
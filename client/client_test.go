@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"platform-go-challenge/models"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c := New(server.URL)
+	c.RetryWait = time.Millisecond
+	return c
+}
+
+func TestListFavourites_PagesAndDecodesEachType(t *testing.T) {
+	rule, _ := models.ParseRule(`country = UK`)
+	all := []models.Asset{
+		&models.Chart{ID: uuid.New(), Title: "Sales", Data: []float64{1}, Favorite: true},
+		&models.Insight{ID: uuid.New(), Text: "Up", Favorite: true},
+		&models.Audience{ID: uuid.New(), Rules: rule, Favorite: true},
+		&models.Chart{ID: uuid.New(), Title: "Costs", Favorite: true},
+		&models.Audience{ID: uuid.New(), Favorite: true},
+	}
+	requests := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" || r.URL.Query().Get("tag") != "q3" {
+			t.Errorf("unexpected request %s %v", r.URL, r.Header)
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		json.NewEncoder(w).Encode(all[offset:min(offset+limit, len(all))])
+	})
+	c.Token, c.PageSize = "secret", 2
+
+	assets, err := c.ListFavourites(context.Background(), &ListOptions{Tag: "q3"})
+	if err != nil {
+		t.Fatalf("listing: %v", err)
+	}
+	if requests != 3 || len(assets) != len(all) {
+		t.Fatalf("expected %d assets in 3 requests, got %d in %d", len(all), len(assets), requests)
+	}
+	for n, asset := range assets {
+		if asset.GetType() != all[n].GetType() || asset.GetID() != all[n].GetID() {
+			t.Errorf("asset %d: expected %s %s, got %s %s", n, all[n].GetType(), all[n].GetID(), asset.GetType(), asset.GetID())
+		}
+	}
+	if got := assets[2].(*models.Audience).Rules.String(); got != rule.String() {
+		t.Errorf("expected the audience rules %q, got %q", rule, got)
+	}
+}
+
+func TestDo_RetriesIdempotentRequests(t *testing.T) {
+	attempts := map[string]int{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts[r.Method]++
+		if attempts[r.Method] < 3 {
+			http.Error(w, "Try again", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(&models.Chart{ID: uuid.New(), Title: "Sales", Description: "Monthly"})
+	})
+
+	asset, err := c.EditDescription(context.Background(), uuid.New(), "Monthly")
+	if err != nil || asset.GetDescription() != "Monthly" || attempts[http.MethodPut] != 3 {
+		t.Errorf("expected the edit retried until it succeeds, got %v %v after %d attempts", asset, err, attempts[http.MethodPut])
+	}
+	_, err = c.AddChart(context.Background(), &models.Chart{Title: "Sales"}, true)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || attempts[http.MethodPost] != 1 {
+		t.Errorf("expected the add not retried, got %v after %d attempts", err, attempts[http.MethodPost])
+	}
+
+	c.MaxRetries = 1
+	if err := c.Delete(context.Background(), uuid.New()); err == nil || attempts[http.MethodDelete] != 2 {
+		t.Errorf("expected the delete to give up after one retry, got %v", err)
+	}
+}
+
+func TestDo_StopsRetryingWhenCancelled(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Slow down", http.StatusTooManyRequests)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.GetAsset(ctx, uuid.New()); err != context.DeadlineExceeded {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("expected the retry wait interrupted by the context")
+	}
+}
+
+func TestLoginAndErrors(t *testing.T) {
+	userID := uuid.New()
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			var req struct {
+				UserID string `json:"user_id"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(map[string]string{"token": "token-" + req.UserID})
+		default:
+			http.Error(w, "Asset not found", http.StatusNotFound)
+		}
+	})
+	token, err := c.Login(context.Background(), userID)
+	if err != nil || token != "token-"+userID.String() || c.Token != token {
+		t.Fatalf("unexpected login %q %v", token, err)
+	}
+	_, err = c.ToggleFavourite(context.Background(), uuid.New())
+	if !IsNotFound(err) || err.Error() != "favourites API: 404 Asset not found" {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestEvents_ResumesAfterTheLastEvent(t *testing.T) {
+	connections := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		connections++
+		w.Header().Set("Content-Type", "text/event-stream")
+		if connections == 1 {
+			w.Write([]byte(": ping\n\nid: 1\nevent: created\ndata: {\"id\":1,\"type\":\"created\"}\n\n"))
+			return
+		}
+		if got := r.URL.Query().Get("last_event_id"); got != "1" {
+			t.Errorf("expected to resume after event 1, got %q", got)
+		}
+		w.Write([]byte("event: reset\ndata: {}\n\nid: 2\nevent: deleted\ndata: {\"id\":2,\"type\":\"deleted\"}\n\n"))
+	})
+	var types []string
+	stop := errors.New("stop")
+	err := c.Events(context.Background(), 0, func(ev Event) error {
+		types = append(types, ev.Type)
+		if ev.ID == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || strings.Join(types, ",") != "created,reset,deleted" {
+		t.Errorf("unexpected events %v, %v", types, err)
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventReset tells the events since the requested one are no longer known;
+// the client should reload the assets
+const EventReset = "reset"
+
+// Event is a change to one of the user's assets
+type Event struct {
+	ID            uint64          `json:"id"`
+	Type          string          `json:"type"`
+	Change        string          `json:"change,omitempty"`
+	AssetID       uuid.UUID       `json:"asset_id,omitempty"`
+	AssetType     string          `json:"asset_type,omitempty"`
+	Asset         json.RawMessage `json:"asset,omitempty"`
+	CollectionIDs []uuid.UUID     `json:"collection_ids,omitempty"`
+	At            time.Time       `json:"at"`
+}
+
+// Events follows the user's events after lastID (0 for new events only),
+// calling fn for each. It reconnects when the stream drops and returns when
+// ctx is done or fn fails.
+func (c *Client) Events(ctx context.Context, lastID uint64, fn func(Event) error) error {
+	stream := *c.HTTPClient
+	stream.Timeout = 0
+	for {
+		err := c.readEvents(ctx, &stream, &lastID, fn)
+		var apiErr *Error
+		var failed *callbackError
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.As(err, &apiErr):
+			return err
+		case errors.As(err, &failed):
+			return failed.err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.RetryWait):
+		}
+	}
+}
+
+// callbackError is an error of the function Events calls
+type callbackError struct{ err error }
+
+func (e *callbackError) Error() string { return e.err.Error() }
+
+func (c *Client) readEvents(ctx context.Context, hc *http.Client, lastID *uint64, fn func(Event) error) error {
+	query := url.Values{}
+	if *lastID > 0 {
+		query.Set("last_event_id", strconv.FormatUint(*lastID, 10))
+	}
+	resp, err := c.send(ctx, hc, http.MethodGet, "/favourites/events", query, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var ev Event
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			if err := json.Unmarshal([]byte(data.String()), &ev); err != nil {
+				return err
+			}
+			data.Reset()
+			if ev.ID > 0 {
+				*lastID = ev.ID
+			}
+			if err := fn(ev); err != nil {
+				return &callbackError{err}
+			}
+			ev = Event{}
+		case field == "event":
+			ev.Type = value
+		case field == "data":
+			data.WriteString(value)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"platform-go-challenge/client"
+	"platform-go-challenge/models"
+)
+
+func runConfig(a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected set, use or list")
+	}
+	switch args[0] {
+	case "set":
+		fs := flag.NewFlagSet("config set", flag.ContinueOnError)
+		server := fs.String("server", "", "server URL")
+		userID := fs.String("user-id", "", "user to act as")
+		rest, err := parseArgs(fs, args[1:], 1, commands["config"].usage)
+		if err != nil {
+			return err
+		}
+		if *userID != "" {
+			if _, err := uuid.Parse(*userID); err != nil {
+				return fmt.Errorf("invalid user id %q", *userID)
+			}
+		}
+		p := a.cfg.Profiles[rest[0]]
+		if p == nil {
+			p = &Profile{}
+			a.cfg.Profiles[rest[0]] = p
+		}
+		p.Server, p.UserID = firstOf(*server, p.Server), firstOf(*userID, p.UserID)
+		if a.cfg.Current == "" {
+			a.cfg.Current = rest[0]
+		}
+		return a.cfg.save()
+	case "use":
+		if len(args) != 2 || a.cfg.Profiles[args[1]] == nil {
+			return fmt.Errorf("expected the name of a profile")
+		}
+		a.cfg.Current = args[1]
+		return a.cfg.save()
+	case "list":
+		if a.out.format != "table" {
+			return a.out.structured(a.cfg.Profiles)
+		}
+		names := make([]string, 0, len(a.cfg.Profiles))
+		for name := range a.cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		rows := make([][]string, len(names))
+		for n, name := range names {
+			current := ""
+			if name == a.cfg.Current {
+				current = "*"
+			}
+			rows[n] = []string{current, name, a.cfg.Profiles[name].Server, a.cfg.Profiles[name].UserID}
+		}
+		return a.out.table([]string{"CURRENT", "NAME", "SERVER", "USER"}, rows)
+	}
+	return fmt.Errorf("unknown config command %q", args[0])
+}
+
+func runLogin(a *app, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("login", flag.ContinueOnError), args, 0, commands["login"].usage); err != nil {
+		return err
+	}
+	if err := a.login(); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.out.w, a.client.Token)
+	return nil
+}
+
+func runList(a *app, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	opts := &client.ListOptions{}
+	fs.StringVar(&opts.Tag, "tag", "", "only assets with this tag")
+	collection := fs.String("collection", "", "only assets of this collection")
+	if _, err := parseArgs(fs, args, 0, commands["list"].usage); err != nil {
+		return err
+	}
+	if *collection != "" {
+		id, err := uuid.Parse(*collection)
+		if err != nil {
+			return fmt.Errorf("invalid collection id %q", *collection)
+		}
+		opts.CollectionID = id
+	}
+	return a.call(func(c *client.Client) error {
+		assets, err := c.ListFavourites(a.ctx, opts)
+		if err != nil {
+			return err
+		}
+		return a.out.assets(assets)
+	})
+}
+
+func runSearch(a *app, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	opts := &client.ListOptions{}
+	fs.StringVar(&opts.Tag, "tag", "", "only assets with this tag")
+	rest, err := parseArgs(fs, args, 1, commands["search"].usage)
+	if err != nil {
+		return err
+	}
+	text := strings.ToLower(rest[0])
+	return a.call(func(c *client.Client) error {
+		assets, err := c.ListFavourites(a.ctx, opts)
+		if err != nil {
+			return err
+		}
+		found := assets[:0]
+		for _, asset := range assets {
+			haystack := strings.ToLower(summary(asset) + " " + strings.Join(asset.GetTags(), " "))
+			if strings.Contains(haystack, text) {
+				found = append(found, asset)
+			}
+		}
+		return a.out.assets(found)
+	})
+}
+
+// assetArg parses the ID argument of single asset commands
+func assetArg(name string, args []string, fs *flag.FlagSet) (uuid.UUID, error) {
+	if fs == nil {
+		fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	}
+	rest, err := parseArgs(fs, args, 1, commands[name].usage)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.Parse(rest[0])
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid asset id %q", rest[0])
+	}
+	return id, nil
+}
+
+func runGet(a *app, args []string) error {
+	id, err := assetArg("get", args, nil)
+	if err != nil {
+		return err
+	}
+	return a.call(func(c *client.Client) error {
+		asset, err := c.GetAsset(a.ctx, id)
+		if err != nil {
+			return err
+		}
+		return a.out.asset(asset)
+	})
+}
+
+func runEdit(a *app, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	description := fs.String("description", "", "the new description")
+	id, err := assetArg("edit", args, fs)
+	if err != nil {
+		return err
+	}
+	return a.call(func(c *client.Client) error {
+		asset, err := c.EditDescription(a.ctx, id, *description)
+		if err != nil {
+			return err
+		}
+		return a.out.asset(asset)
+	})
+}
+
+func runFavourite(favorite bool) func(a *app, args []string) error {
+	name := "unfavourite"
+	if favorite {
+		name = "favourite"
+	}
+	return func(a *app, args []string) error {
+		id, err := assetArg(name, args, nil)
+		if err != nil {
+			return err
+		}
+		return a.call(func(c *client.Client) error {
+			asset, err := c.SetFavourite(a.ctx, id, favorite)
+			if err != nil {
+				return err
+			}
+			return a.out.asset(asset)
+		})
+	}
+}
+
+func runToggle(a *app, args []string) error {
+	id, err := assetArg("toggle", args, nil)
+	if err != nil {
+		return err
+	}
+	return a.call(func(c *client.Client) error {
+		asset, err := c.ToggleFavourite(a.ctx, id)
+		if err != nil {
+			return err
+		}
+		return a.out.asset(asset)
+	})
+}
+
+func runDelete(a *app, args []string) error {
+	id, err := assetArg("delete", args, nil)
+	if err != nil {
+		return err
+	}
+	return a.call(func(c *client.Client) error {
+		return c.Delete(a.ctx, id)
+	})
+}
+
+func runAdd(a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected the asset type: chart, insight or audience")
+	}
+	kind := args[0]
+	fs := flag.NewFlagSet("add "+kind, flag.ContinueOnError)
+	description := fs.String("description", "", "description")
+	tags := fs.String("tags", "", "comma-separated tags")
+	favorite := fs.Bool("favorite", true, "mark the asset favourite")
+	var build func() (models.Asset, error)
+	switch kind {
+	case models.ChartType:
+		title := fs.String("title", "", "chart title")
+		xTitle := fs.String("x-title", "", "x axis title")
+		yTitle := fs.String("y-title", "", "y axis title")
+		data := fs.String("data", "", "comma-separated data points")
+		build = func() (models.Asset, error) {
+			chart := &models.Chart{Title: *title, XAxisTitle: *xTitle, YAxisTitle: *yTitle}
+			for _, field := range splitList(*data) {
+				v, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid data point %q", field)
+				}
+				chart.Data = append(chart.Data, v)
+			}
+			return chart, nil
+		}
+	case models.InsightType:
+		text := fs.String("text", "", "insight text, Markdown")
+		build = func() (models.Asset, error) { return &models.Insight{Text: *text}, nil }
+	case models.AudienceType:
+		rules := fs.String("rules", "", `audience expression, e.g. 'gender = "Female" AND age BETWEEN 25 AND 34'`)
+		build = func() (models.Asset, error) {
+			rule, err := models.ParseRule(*rules)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rules: %v", err)
+			}
+			return &models.Audience{Rules: rule}, nil
+		}
+	default:
+		return fmt.Errorf("unknown asset type %q, expected chart, insight or audience", kind)
+	}
+	if _, err := parseArgs(fs, args[1:], 0, "add "+kind+" [flags]"); err != nil {
+		return err
+	}
+	asset, err := build()
+	if err != nil {
+		return err
+	}
+	asset.SetDescription(*description)
+	asset.SetTags(splitList(*tags))
+	return a.call(func(c *client.Client) error {
+		var added models.Asset
+		var err error
+		switch v := asset.(type) {
+		case *models.Chart:
+			added, err = c.AddChart(a.ctx, v, *favorite)
+		case *models.Insight:
+			added, err = c.AddInsight(a.ctx, v, *favorite)
+		case *models.Audience:
+			added, err = c.AddAudience(a.ctx, v, *favorite)
+		}
+		if err != nil {
+			return err
+		}
+		return a.out.asset(added)
+	})
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			out = append(out, field)
+		}
+	}
+	return out
+}
+
+func runExport(a *app, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "jsonl", "jsonl or csv")
+	file := fs.String("file", "", "file to write instead of stdout")
+	if _, err := parseArgs(fs, args, 0, commands["export"].usage); err != nil {
+		return err
+	}
+	w := a.out.w
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return a.call(func(c *client.Client) error {
+		return c.Export(a.ctx, *format, w)
+	})
+}
+
+func runImport(a *app, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	var opts client.ImportOptions
+	fs.StringVar(&opts.Format, "format", "", "jsonl or csv, by default from the file extension")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "validate without creating anything")
+	fs.StringVar(&opts.OnConflict, "on-conflict", "", "for assets whose ID exists: skip, overwrite or duplicate")
+	rest, err := parseArgs(fs, args, 1, commands["import"].usage)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if rest[0] == "-" {
+		data, err = io.ReadAll(a.stdin)
+	} else {
+		data, err = os.ReadFile(rest[0])
+		if opts.Format == "" && strings.HasSuffix(strings.ToLower(rest[0]), ".csv") {
+			opts.Format = "csv"
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return a.call(func(c *client.Client) error {
+		report, err := c.Import(a.ctx, data, opts)
+		if err != nil {
+			return err
+		}
+		if a.out.format != "table" {
+			return a.out.structured(report)
+		}
+		err = a.out.table([]string{"DRY RUN", "CREATED", "OVERWRITTEN", "SKIPPED", "FAILED"}, [][]string{{
+			yesNo(report.DryRun), itoa(report.Created), itoa(report.Overwritten), itoa(report.Skipped), itoa(report.Failed),
+		}})
+		for _, result := range report.Results {
+			if result.Error != "" && err == nil {
+				_, err = fmt.Fprintf(a.out.w, "line %d: %s\n", result.Line, result.Error)
+			}
+		}
+		return err
+	})
+}
+
+func runEvents(a *app, args []string) error {
+	fs := flag.NewFlagSet("events", flag.ContinueOnError)
+	since := fs.Uint64("since", 0, "replay the events after this ID first")
+	if _, err := parseArgs(fs, args, 0, commands["events"].usage); err != nil {
+		return err
+	}
+	err := a.call(func(c *client.Client) error {
+		return c.Events(a.ctx, *since, func(ev client.Event) error {
+			if a.out.format != "table" {
+				return a.out.structured(ev)
+			}
+			if ev.Type == client.EventReset {
+				_, err := fmt.Fprintln(a.out.w, "reset: events were missed, reload the favourites")
+				return err
+			}
+			_, err := fmt.Fprintf(a.out.w, "%d\t%s\t%s\t%s\t%s\n", ev.ID, ev.At.Format("2006-01-02T15:04:05Z07:00"), ev.Type, ev.AssetType, ev.AssetID)
+			return err
+		})
+	})
+	if errors.Is(err, a.ctx.Err()) {
+		// Interrupted by the user
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a server and the user favctl acts as on it
+type Profile struct {
+	Server string `yaml:"server" json:"server"`
+	UserID string `yaml:"user_id" json:"user_id"`
+}
+
+// Config is the favctl configuration file
+type Config struct {
+	Current  string              `yaml:"current"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+const defaultServer = "http://localhost:8080"
+
+// configPath is the configuration file, in the user's configuration directory
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "favctl", "config.yaml"), nil
+}
+
+// tokenCachePath is the cache of tokens by profile, in the user's cache directory
+func tokenCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "favctl", "tokens.json"), nil
+}
+
+// loadConfig reads the configuration file; a missing file is an empty one
+func loadConfig() (*Config, error) {
+	cfg := &Config{Profiles: map[string]*Profile{}}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return writePrivate(path, data)
+}
+
+// writePrivate writes a file only the user can read, creating its directory
+func writePrivate(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// cachedToken returns the cached token of the profile unless it expires
+// within a minute
+func cachedToken(profile string) string {
+	path, err := tokenCachePath()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var tokens map[string]string
+	if json.Unmarshal(data, &tokens) != nil {
+		return ""
+	}
+	token := tokens[profile]
+	if exp, ok := tokenExpiry(token); !ok || time.Until(exp) < time.Minute {
+		return ""
+	}
+	return token
+}
+
+// cacheToken stores the token of the profile
+func cacheToken(profile, token string) error {
+	path, err := tokenCachePath()
+	if err != nil {
+		return err
+	}
+	tokens := map[string]string{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &tokens)
+	}
+	tokens[profile] = token
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return writePrivate(path, data)
+}
+
+// tokenExpiry reads the exp claim of a JWT. The signature is the server's
+// business, the claim only decides when to log in again.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
@@ -0,0 +1,204 @@
+// Command favctl manages favourites from the command line: it obtains
+// tokens, lists, searches, adds, edits and deletes assets, imports and
+// exports files and tails the event stream.
+//
+//	favctl config set prod -server https://favourites.example.com -user-id <UUID>
+//	favctl -profile prod -o yaml list -tag q3
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"platform-go-challenge/client"
+)
+
+// command is a favctl subcommand
+type command struct {
+	usage, summary string
+	run            func(a *app, args []string) error
+}
+
+// commands is filled in init, the commands refer to it for their usage
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"config":      {"config set NAME [-server URL] [-user-id UUID] | use NAME | list", "manage the server profiles", runConfig},
+		"login":       {"login", "obtain a token for the profile's user and print it", runLogin},
+		"list":        {"list [-tag TAG] [-collection UUID]", "list favourites", runList},
+		"search":      {"search [-tag TAG] TEXT", "find favourites whose title, text, rules, description or tags contain TEXT", runSearch},
+		"get":         {"get ID", "show an asset", runGet},
+		"add":         {"add chart|insight|audience [flags]", "create an asset, see favctl add -h", runAdd},
+		"edit":        {"edit ID -description TEXT", "change the description of an asset", runEdit},
+		"favourite":   {"favourite ID", "mark an asset favourite", runFavourite(true)},
+		"unfavourite": {"unfavourite ID", "unmark an asset favourite", runFavourite(false)},
+		"toggle":      {"toggle ID", "flip the favourite mark of an asset", runToggle},
+		"delete":      {"delete ID", "move an asset to the trash", runDelete},
+		"export":      {"export [-format jsonl|csv] [-file PATH]", "export every asset, to stdout by default", runExport},
+		"import":      {"import [-format jsonl|csv] [-dry-run] [-on-conflict skip|overwrite|duplicate] FILE", "import assets from a file, - for stdin", runImport},
+		"events":      {"events [-since ID]", "print the changes to the user's assets as they happen", runEvents},
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stdin); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "favctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// app is the state of one favctl run
+type app struct {
+	ctx         context.Context
+	cfg         *Config
+	profileName string
+	server      string
+	userID      string
+	out         *printer
+	stdin       io.Reader
+	client      *client.Client
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer, stdin io.Reader) error {
+	global := flag.NewFlagSet("favctl", flag.ContinueOnError)
+	profile := global.String("profile", "", "configuration profile, the current one by default")
+	server := global.String("server", "", "server URL, overriding the profile's")
+	userID := global.String("user-id", "", "user to act as, overriding the profile's")
+	output := global.String("o", "table", "output format: table, json or yaml")
+	global.Usage = func() { usage(global) }
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		usage(global)
+		return flag.ErrHelp
+	}
+	cmd, ok := commands[global.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see favctl -h", global.Arg(0))
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	a := &app{ctx: ctx, cfg: cfg, out: &printer{w: stdout, format: *output}, stdin: stdin}
+	if err := a.out.validate(); err != nil {
+		return err
+	}
+	a.profileName = firstOf(*profile, cfg.Current, "default")
+	p := cfg.Profiles[a.profileName]
+	if p == nil {
+		p = &Profile{}
+	}
+	a.server = firstOf(*server, p.Server, defaultServer)
+	a.userID = firstOf(*userID, p.UserID)
+	return cmd.run(a, global.Args()[1:])
+}
+
+func usage(global *flag.FlagSet) {
+	w := global.Output()
+	fmt.Fprintln(w, "Usage: favctl [flags] COMMAND [ARGS]")
+	fmt.Fprintln(w, "\nFlags:")
+	global.PrintDefaults()
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, commands[name].summary)
+	}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseArgs parses flags given before or after the positional arguments,
+// and checks the number of the latter
+func parseArgs(fs *flag.FlagSet, args []string, positional int, usage string) ([]string, error) {
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: favctl "+usage)
+		fs.PrintDefaults()
+	}
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(rest) != positional {
+		fs.Usage()
+		return nil, fmt.Errorf("expected %d arguments, got %d", positional, len(rest))
+	}
+	return rest, nil
+}
+
+// call runs fn with a client logged in as the profile's user, logging in
+// again once if the cached token is refused
+func (a *app) call(fn func(c *client.Client) error) error {
+	if a.client == nil {
+		a.client = client.New(a.server)
+		a.client.Token = cachedToken(a.tokenKey())
+	}
+	if a.client.Token == "" {
+		if err := a.login(); err != nil {
+			return err
+		}
+		return fn(a.client)
+	}
+	err := fn(a.client)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		if err := a.login(); err != nil {
+			return err
+		}
+		return fn(a.client)
+	}
+	return err
+}
+
+// tokenKey identifies the cached token of the server and user
+func (a *app) tokenKey() string {
+	return a.server + " " + a.userID
+}
+
+func (a *app) login() error {
+	if a.client == nil {
+		a.client = client.New(a.server)
+	}
+	id, err := uuid.Parse(a.userID)
+	if err != nil {
+		return fmt.Errorf("profile %q has no valid user, set one with favctl config set %s -user-id UUID", a.profileName, a.profileName)
+	}
+	token, err := a.client.Login(a.ctx, id)
+	if err != nil {
+		return err
+	}
+	return cacheToken(a.tokenKey(), token)
+}
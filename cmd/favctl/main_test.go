@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"platform-go-challenge/models"
+)
+
+// fakeServer serves the favourites of one user, counting logins
+type fakeServer struct {
+	*httptest.Server
+	logins  int
+	token   string
+	assets  []models.Asset
+	lastAdd map[string]interface{}
+}
+
+func fakeJWT(exp time.Time) string {
+	claims, _ := json.Marshal(map[string]int64{"exp": exp.Unix()})
+	return "e30." + base64.RawURLEncoding.EncodeToString(claims) + "." + uuid.NewString()
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	s := &fakeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			s.logins++
+			s.token = fakeJWT(time.Now().Add(time.Hour))
+			json.NewEncoder(w).Encode(map[string]string{"token": s.token})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+s.token {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/favourites":
+			if r.URL.Query().Get("offset") != "0" {
+				w.Write([]byte("[]"))
+				return
+			}
+			json.NewEncoder(w).Encode(s.assets)
+		case "/favourites/add":
+			json.NewDecoder(r.Body).Decode(&s.lastAdd)
+			w.WriteHeader(http.StatusCreated)
+			w.Write(mustJSON(s.lastAdd["asset"]))
+		case "/favourites/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "id: 7\nevent: created\ndata: {\"id\":7,\"type\":\"created\",\"asset_type\":\"chart\",\"at\":\"2024-01-02T03:04:05Z\"}\n\n")
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func mustJSON(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// setupHome points the configuration and cache directories at a temporary one
+func setupHome(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+}
+
+func favctl(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := run(context.Background(), args, &out, strings.NewReader(""))
+	return out.String(), err
+}
+
+func TestProfilesAndTokenCache(t *testing.T) {
+	setupHome(t)
+	server := newFakeServer(t)
+	server.assets = []models.Asset{
+		&models.Chart{ID: uuid.New(), Title: "Sales", Tags: []string{"q3"}, Favorite: true},
+		&models.Insight{ID: uuid.New(), Text: "Costs are up", Favorite: true},
+	}
+	if _, err := favctl(t, "config", "set", "local", "-server", server.URL, "-user-id", uuid.NewString()); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+	if _, err := favctl(t, "config", "set", "other", "-server", "http://other.invalid"); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+	out, _ := favctl(t, "config", "list")
+	if !strings.Contains(out, "*        local") || !strings.Contains(out, "other.invalid") {
+		t.Errorf("expected both profiles with local current, got\n%s", out)
+	}
+
+	out, err := favctl(t, "list")
+	if err != nil || !strings.Contains(out, "Sales") || !strings.Contains(out, "insight") {
+		t.Fatalf("unexpected list %v\n%s", err, out)
+	}
+	out, err = favctl(t, "-o", "json", "search", "COSTS")
+	var found []struct {
+		Type  string
+		Asset map[string]interface{}
+	}
+	if err != nil || json.Unmarshal([]byte(out), &found) != nil || len(found) != 1 || found[0].Type != "insight" {
+		t.Errorf("expected the insight found, got %v\n%s", err, out)
+	}
+	if server.logins != 1 {
+		t.Errorf("expected the token cached across runs, got %d logins", server.logins)
+	}
+
+	// A token the server no longer accepts is replaced
+	server.token = "rotated"
+	if _, err := favctl(t, "list"); err != nil || server.logins != 2 {
+		t.Errorf("expected a new login after a 401, got %v after %d logins", err, server.logins)
+	}
+	if _, err := favctl(t, "-profile", "other", "list"); err == nil || !strings.Contains(err.Error(), "no valid user") {
+		t.Errorf("expected an error for a profile without a user, got %v", err)
+	}
+}
+
+func TestAddAndOutputFormats(t *testing.T) {
+	setupHome(t)
+	server := newFakeServer(t)
+	base := []string{"-server", server.URL, "-user-id", uuid.NewString()}
+
+	out, err := favctl(t, append(base, "-o", "yaml", "add", "audience", "-rules", "gender = Female AND age >= 30", "-tags", "uk, women", "-favorite=false")...)
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if server.lastAdd["type"] != "audience" || server.lastAdd["favorite"] != false {
+		t.Errorf("unexpected request %v", server.lastAdd)
+	}
+	if !strings.Contains(out, "type: audience") || !strings.Contains(out, "- women") {
+		t.Errorf("unexpected YAML\n%s", out)
+	}
+	if _, err := favctl(t, append(base, "add", "audience", "-rules", "age IN (1)")...); err == nil {
+		t.Error("expected invalid rules rejected before sending")
+	}
+	if _, err := favctl(t, append(base, "-o", "xml", "list")...); err == nil {
+		t.Error("expected an unknown output format rejected")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	setupHome(t)
+	server := newFakeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	err := run(ctx, []string{"-server", server.URL, "-user-id", uuid.NewString(), "events"}, &out, nil)
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	if line, _, _ := strings.Cut(out.String(), "\n"); line != "7\t2024-01-02T03:04:05Z\tcreated\tchart\t00000000-0000-0000-0000-000000000000" {
+		t.Errorf("unexpected event line %q", line)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	"platform-go-challenge/models"
+)
+
+// typedAsset is how assets are printed as JSON or YAML, like the lines of
+// an export
+type typedAsset struct {
+	Type  string       `json:"type"`
+	Asset models.Asset `json:"asset"`
+}
+
+func typed(assets []models.Asset) []typedAsset {
+	out := make([]typedAsset, len(assets))
+	for n, asset := range assets {
+		out[n] = typedAsset{asset.GetType(), asset}
+	}
+	return out
+}
+
+// printer writes results in the chosen format: table, json or yaml
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func (p *printer) validate() error {
+	switch p.format {
+	case "table", "json", "yaml":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected table, json or yaml", p.format)
+}
+
+// structured writes v as JSON or YAML. YAML goes through JSON so both use
+// the same field names.
+func (p *printer) structured(v interface{}) error {
+	if p.format == "json" {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(p.w)
+	enc.SetIndent(2)
+	if err := enc.Encode(generic); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// table writes rows under a header, aligned in columns
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) assets(assets []models.Asset) error {
+	if p.format != "table" {
+		return p.structured(typed(assets))
+	}
+	rows := make([][]string, len(assets))
+	for n, asset := range assets {
+		rows[n] = []string{
+			asset.GetID().String(),
+			asset.GetType(),
+			yesNo(asset.IsFavorite()),
+			yesNo(asset.IsPinned()),
+			strings.Join(asset.GetTags(), ","),
+			truncate(summary(asset), 60),
+		}
+	}
+	return p.table([]string{"ID", "TYPE", "FAV", "PINNED", "TAGS", "SUMMARY"}, rows)
+}
+
+func (p *printer) asset(asset models.Asset) error {
+	if p.format != "table" {
+		return p.structured(typedAsset{asset.GetType(), asset})
+	}
+	return p.assets([]models.Asset{asset})
+}
+
+// summary is the text identifying an asset in tables and searches
+func summary(asset models.Asset) string {
+	var s string
+	switch a := asset.(type) {
+	case *models.Chart:
+		s = a.Title
+	case *models.Insight:
+		s = a.Text
+	case *models.Audience:
+		s = a.Rules.String()
+	}
+	if d := asset.GetDescription(); d != "" {
+		s += " (" + d + ")"
+	}
+	return s
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func itoa(n int) string { return strconv.Itoa(n) }
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// requireUser resolves the authenticated user, writing the error response if
+// there is none
+func requireUser(w http.ResponseWriter, r *http.Request, handler string) (*User, bool) {
+	userID := getUserIDFromContext(r)
+	if userID == uuid.Nil {
+		log.Printf("%s: invalid user_id from token", handler)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	user := store.GetTenantUser(getTenantIDFromContext(r), userID)
+	if user == nil {
+		log.Printf("%s: user not found %s", handler, userID)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
+
+// findCollection returns the user's collection with the given ID, or nil
+func findCollection(user *User, id uuid.UUID) *Collection {
+	return lookupCollection(store.CollectionsOf(user), id)
+}
+
+// lookupCollection returns the collection with the given ID, or nil
+func lookupCollection(collections []*Collection, id uuid.UUID) *Collection {
+	for _, c := range collections {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// hasAsset reports whether the collection contains the asset
+func (c *Collection) hasAsset(id uuid.UUID) bool {
+	for _, assetID := range c.AssetIDs {
+		if assetID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// collectionNameTaken reports whether another collection of the user already
+// has the name. The caller holds store.mu.
+func collectionNameTaken(user *User, name string, except uuid.UUID) bool {
+	for _, c := range user.Collections {
+		if c.ID != except && strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTag reports whether the asset carries the (normalized) tag
+func hasTag(asset Asset, tag string) bool {
+	for _, t := range asset.GetTags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// List the user's collections, or create one
+func handleCollections(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleCollections")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		collections := store.CollectionsOf(user)
+		log.Printf("handleCollections: returning %d collections for user %s", len(collections), user.ID)
+		json.NewEncoder(w).Encode(collections)
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("handleCollections: invalid request body: %v", err)
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			log.Printf("handleCollections: empty collection name")
+			http.Error(w, "Collection name is required", http.StatusBadRequest)
+			return
+		}
+		c := &Collection{ID: uuid.New(), Name: name, AssetIDs: []uuid.UUID{}, CreatedAt: time.Now().UTC()}
+		if err := store.AddCollection(user, c); err != nil {
+			log.Printf("handleCollections: duplicate collection name %q", name)
+			http.Error(w, "Collection name already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("handleCollections: created collection %s for user %s", c.ID, user.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+	default:
+		log.Printf("handleCollections: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Routes /collections/{id} and /collections/{id}/assets
+func handleCollectionByID(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleCollectionByID")
+	if !ok {
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/collections/"), "/"), "/")
+	collectionID, err := uuid.Parse(parts[0])
+	if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "assets") {
+		log.Printf("handleCollectionByID: unknown path %s", r.URL.Path)
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	// Grantees of a collection share read it, and with edit rename it and
+	// change its assets; deleting it stays with the owner
+	want := PermEdit
+	if r.Method == http.MethodGet {
+		want = PermRead
+	}
+	owner, c, err := resolveCollection(user, collectionID, want)
+	if errors.Is(err, errForbidden) || (err == nil && r.Method == http.MethodDelete && owner != user) {
+		log.Printf("handleCollectionByID: insufficient permission on collection %s", collectionID)
+		http.Error(w, "Insufficient permission on collection", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("handleCollectionByID: collection not found %s", collectionID)
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if len(parts) == 2 {
+		handleCollectionAssets(w, r, owner, c)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		assets := make([]Asset, 0, len(c.AssetIDs))
+		for _, id := range c.AssetIDs {
+			if asset := findAsset(owner, id); asset != nil {
+				assets = append(assets, asset)
+			}
+		}
+		resp := struct {
+			*Collection
+			Assets []Asset
+		}{Collection: c, Assets: assets}
+		json.NewEncoder(w).Encode(resp)
+	case http.MethodPut:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("handleCollectionByID: invalid request body: %v", err)
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			log.Printf("handleCollectionByID: empty collection name")
+			http.Error(w, "Collection name is required", http.StatusBadRequest)
+			return
+		}
+		renamed, err := store.RenameCollection(owner, c.ID, name)
+		if errors.Is(err, errCollectionExists) {
+			log.Printf("handleCollectionByID: duplicate collection name %q", name)
+			http.Error(w, "Collection name already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("handleCollectionByID: collection not found %s", c.ID)
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleCollectionByID: renamed collection %s to '%s'", c.ID, name)
+		json.NewEncoder(w).Encode(renamed)
+	case http.MethodDelete:
+		if !store.RemoveCollection(user, c.ID) {
+			log.Printf("handleCollectionByID: collection not found %s", c.ID)
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleCollectionByID: deleted collection %s for user %s", c.ID, user.ID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Printf("handleCollectionByID: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Adds (POST) or removes (DELETE) the asset_id asset to/from a collection of
+// owner; only the owner's assets can be added
+func handleCollectionAssets(w http.ResponseWriter, r *http.Request, owner *User, c *Collection) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		log.Printf("handleCollectionAssets: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	assetID, ok := parseAssetID(r, w)
+	if !ok {
+		log.Printf("handleCollectionAssets: invalid asset_id")
+		return
+	}
+	if r.Method == http.MethodDelete {
+		updated, err := store.RemoveCollectionAsset(owner, c.ID, assetID)
+		if err != nil {
+			log.Printf("handleCollectionAssets: asset %s not in collection %s: %v", assetID, c.ID, err)
+			http.Error(w, "Asset not found in collection", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleCollectionAssets: removed asset %s from collection %s", assetID, c.ID)
+		json.NewEncoder(w).Encode(updated)
+		return
+	}
+	updated, err := store.AddCollectionAsset(owner, c.ID, assetID)
+	if errors.Is(err, errCollectionNotFound) {
+		log.Printf("handleCollectionAssets: collection not found %s", c.ID)
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("handleCollectionAssets: asset not found %s", assetID)
+		http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+		return
+	}
+	log.Printf("handleCollectionAssets: asset %s in collection %s", assetID, c.ID)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// Replaces the tags of an asset
+func handleAssetTags(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	if r.Method != http.MethodPut {
+		log.Printf("handleAssetTags: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleAssetTags")
+	if !ok {
+		return
+	}
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("handleAssetTags: invalid request body: %v", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		log.Printf("handleAssetTags: invalid tags: %v", err)
+		http.Error(w, "Invalid tags: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	owner, asset, err := editAsset(user, assetID, func(a Asset) { a.SetTags(tags) })
+	if err != nil {
+		writeAccessError(w, "handleAssetTags", assetID, err)
+		return
+	}
+	log.Printf("handleAssetTags: set tags for asset %s to %v", assetID, tags)
+	recordRevision(owner, asset, user.ID, "tags")
+	notify(owner, EventUpdated, asset)
+	json.NewEncoder(w).Encode(asset)
+}
+
+// Autocompletes tags used by the user: GET /tags?prefix=ge&limit=10
+func handleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleTags: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleTags")
+	if !ok {
+		return
+	}
+	prefix := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("prefix")))
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	counts := make(map[string]int)
+	for _, asset := range store.FavouritesOf(user) {
+		for _, tag := range asset.GetTags() {
+			if strings.HasPrefix(tag, prefix) {
+				counts[tag]++
+			}
+		}
+	}
+	type tagCount struct {
+		Tag   string `json:"tag"`
+		Count int    `json:"count"`
+	}
+	tags := make([]tagCount, 0, len(counts))
+	for tag, n := range counts {
+		tags = append(tags, tagCount{Tag: tag, Count: n})
+	}
+	// Most used first, alphabetical among equals
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	json.NewEncoder(w).Encode(tags)
+}
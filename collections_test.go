@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// doRequest runs an authenticated request against handler and returns the recorder
+func doRequest(t *testing.T, handler http.HandlerFunc, token, method, target string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	AuthMiddleware(handler)(w, req)
+	return w
+}
+
+func TestCollections_CRUD(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Chart1", Favorite: true}
+	insight := &Insight{ID: uuid.New(), Text: "Insight1", Favorite: true}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart, insight}})
+	token, _ := GenerateJWT(userID)
+
+	w := doRequest(t, handleCollections, token, http.MethodPost, "/collections", map[string]string{"name": "Q3 report"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	var c Collection
+	if err := json.NewDecoder(w.Body).Decode(&c); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w := doRequest(t, handleCollections, token, http.MethodPost, "/collections", map[string]string{"name": "q3 REPORT"}); w.Code != http.StatusConflict {
+		t.Errorf("expected status %d for duplicate name, got %d", http.StatusConflict, w.Code)
+	}
+
+	base := "/collections/" + c.ID.String()
+	if w := doRequest(t, handleCollectionByID, token, http.MethodPost, base+"/assets?asset_id="+chart.ID.String(), nil); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d adding asset, got %d", http.StatusOK, w.Code)
+	}
+	if w := doRequest(t, handleCollectionByID, token, http.MethodPost, base+"/assets?asset_id="+uuid.New().String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d adding unknown asset, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Listing by collection only returns its assets
+	w = doRequest(t, handleFavourites, token, http.MethodGet, "/favourites?collection="+c.ID.String(), nil)
+	var list []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list) != 1 || list[0]["Title"] != "Chart1" {
+		t.Fatalf("expected only Chart1 in collection, got %v", list)
+	}
+
+	w = doRequest(t, handleCollectionByID, token, http.MethodPut, base, map[string]string{"name": "Q4 report"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d renaming, got %d", http.StatusOK, w.Code)
+	}
+	w = doRequest(t, handleCollectionByID, token, http.MethodGet, base, nil)
+	var got struct {
+		Name   string
+		Assets []map[string]interface{}
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got.Name != "Q4 report" || len(got.Assets) != 1 {
+		t.Errorf("unexpected collection %+v", got)
+	}
+
+	// Deleting the asset removes it from the collection
+	doRequest(t, handleDeleteFavourite, token, http.MethodDelete, "/favourites/delete?asset_id="+chart.ID.String(), nil)
+	if findCollection(store.GetUser(userID), c.ID).hasAsset(chart.ID) {
+		t.Error("deleted asset still in collection")
+	}
+
+	if w := doRequest(t, handleCollectionByID, token, http.MethodDelete, base, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d deleting, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := doRequest(t, handleCollectionByID, token, http.MethodGet, base, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d after delete, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestTags_FilterAndAutocomplete(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Chart1", Favorite: true}
+	audience := &Audience{ID: uuid.New(), Favorite: true, Tags: []string{"gen z"}}
+	insight := &Insight{ID: uuid.New(), Text: "Insight1", Favorite: true, Tags: []string{"gaming", "gen z"}}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart, audience, insight}})
+	token, _ := GenerateJWT(userID)
+
+	w := doRequest(t, handleFavouriteByID, token, http.MethodPut, "/favourites/"+chart.ID.String()+"/tags", map[string][]string{"tags": {"Gen Z", " Video "}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if tags := findAsset(store.GetUser(userID), chart.ID).GetTags(); len(tags) != 2 || tags[0] != "gen z" || tags[1] != "video" {
+		t.Errorf("unexpected chart tags %v", tags)
+	}
+
+	w = doRequest(t, handleFavourites, token, http.MethodGet, "/favourites?tag=GEN+Z", nil)
+	var list []map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 3 {
+		t.Errorf("expected 3 assets tagged 'gen z', got %d", len(list))
+	}
+
+	w = doRequest(t, handleTags, token, http.MethodGet, "/tags?prefix=g", nil)
+	var tags []struct {
+		Tag   string `json:"tag"`
+		Count int    `json:"count"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&tags); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(tags) != 2 || tags[0].Tag != "gen z" || tags[0].Count != 3 || tags[1].Tag != "gaming" {
+		t.Errorf("unexpected autocompletion %+v", tags)
+	}
+}
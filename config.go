@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server configuration. It is built from the defaults, a YAML
+// or TOML file, FAVOURITES_* environment variables and command-line flags,
+// each overriding the ones before.
+type Config struct {
+	HTTP    HTTPConfig    `yaml:"http" toml:"http"`
+	TLS     TLSConfig     `yaml:"tls" toml:"tls"`
+	GRPC    GRPCConfig    `yaml:"grpc" toml:"grpc"`
+	Auth    AuthConfig    `yaml:"auth" toml:"auth"`
+	Storage StorageConfig `yaml:"storage" toml:"storage"`
+	Trash   TrashConfig   `yaml:"trash" toml:"trash"`
+	Panel   PanelConfig   `yaml:"panel" toml:"panel"`
+	Log     LogConfig     `yaml:"log" toml:"log"`
+}
+
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr" toml:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// TLSConfig enables TLS on the HTTP and gRPC APIs when Cert is set. With a
+// ClientCA, callers may authenticate with a client certificate whose subject
+// ClientUsers maps to a user ID, instead of a token.
+type TLSConfig struct {
+	Cert              string            `yaml:"cert" toml:"cert"`
+	Key               string            `yaml:"key" toml:"key"`
+	ClientCA          string            `yaml:"client_ca" toml:"client_ca"`
+	RequireClientCert bool              `yaml:"require_client_cert" toml:"require_client_cert"`
+	ClientUsers       map[string]string `yaml:"client_users" toml:"client_users"`
+}
+
+type GRPCConfig struct {
+	Addr string `yaml:"addr" toml:"addr"`
+}
+
+type AuthConfig struct {
+	JWTSecret     string        `yaml:"jwt_secret" toml:"jwt_secret"`
+	TokenLifetime time.Duration `yaml:"token_lifetime" toml:"token_lifetime"`
+	AdminToken    string        `yaml:"admin_token" toml:"admin_token"`
+}
+
+type StorageConfig struct {
+	Snapshot         string        `yaml:"snapshot" toml:"snapshot"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval" toml:"snapshot_interval"`
+	WAL              string        `yaml:"wal" toml:"wal"`
+}
+
+type TrashConfig struct {
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+}
+
+type PanelConfig struct {
+	File string `yaml:"file" toml:"file"`
+}
+
+type LogConfig struct {
+	File         string `yaml:"file" toml:"file"`
+	UTC          bool   `yaml:"utc" toml:"utc"`
+	Microseconds bool   `yaml:"microseconds" toml:"microseconds"`
+}
+
+// defaultJWTSecret is only fit for development, the server warns when it is used
+const defaultJWTSecret = "supersecretkey"
+
+func defaultConfig() *Config {
+	cfg := &Config{}
+	cfg.HTTP.Addr = ":8080"
+	cfg.HTTP.ReadTimeout = 30 * time.Second
+	cfg.HTTP.ReadHeaderTimeout = 5 * time.Second
+	cfg.HTTP.WriteTimeout = time.Minute
+	cfg.HTTP.IdleTimeout = 2 * time.Minute
+	cfg.HTTP.MaxHeaderBytes = 1 << 20
+	cfg.HTTP.ShutdownTimeout = 30 * time.Second
+	cfg.Auth.JWTSecret = defaultJWTSecret
+	cfg.Auth.TokenLifetime = 24 * time.Hour
+	cfg.Storage.SnapshotInterval = 5 * time.Minute
+	cfg.Trash.Retention = 30 * 24 * time.Hour
+	return cfg
+}
+
+// setting is one configuration value, with its flag and whether a SIGHUP
+// can change it without a restart. Settings without a flag are read from the
+// file or the environment only, as the command line is visible to other users.
+type setting struct {
+	key        string
+	flag       string
+	usage      string
+	reloadable bool
+	field      func(cfg *Config) interface{}
+}
+
+var settings = []setting{
+	{"http.addr", "addr", "listen address of the HTTP API", false, func(c *Config) interface{} { return &c.HTTP.Addr }},
+	{"http.read_timeout", "read-timeout", "limit on reading a request, body included, 0 for none", false, func(c *Config) interface{} { return &c.HTTP.ReadTimeout }},
+	{"http.read_header_timeout", "read-header-timeout", "limit on reading the headers of a request, 0 for none", false, func(c *Config) interface{} { return &c.HTTP.ReadHeaderTimeout }},
+	{"http.write_timeout", "write-timeout", "limit on writing a response, 0 for none; event streams and WebSockets are exempt", false, func(c *Config) interface{} { return &c.HTTP.WriteTimeout }},
+	{"http.idle_timeout", "idle-timeout", "how long an idle keep-alive connection is kept open, 0 for none", false, func(c *Config) interface{} { return &c.HTTP.IdleTimeout }},
+	{"http.max_header_bytes", "max-header-bytes", "largest request headers accepted", false, func(c *Config) interface{} { return &c.HTTP.MaxHeaderBytes }},
+	{"http.shutdown_timeout", "shutdown-timeout", "how long a shutdown waits for in-flight requests", false, func(c *Config) interface{} { return &c.HTTP.ShutdownTimeout }},
+	{"tls.cert", "tls-cert", "PEM certificate chain served by the HTTP and gRPC APIs, TLS is disabled if empty; reloaded when the file changes", false, func(c *Config) interface{} { return &c.TLS.Cert }},
+	{"tls.key", "tls-key", "PEM private key of -tls-cert", false, func(c *Config) interface{} { return &c.TLS.Key }},
+	{"tls.client_ca", "tls-client-ca", "PEM bundle of the CAs whose client certificates are accepted instead of a token", false, func(c *Config) interface{} { return &c.TLS.ClientCA }},
+	{"tls.require_client_cert", "tls-require-client-cert", "refuse connections without a valid client certificate", false, func(c *Config) interface{} { return &c.TLS.RequireClientCert }},
+	{"grpc.addr", "grpc", "listen address of the gRPC API, disabled if empty", false, func(c *Config) interface{} { return &c.GRPC.Addr }},
+	{"auth.jwt_secret", "jwt-secret", "secret signing the tokens; prefer the file or the environment, flags are visible to other users", false, func(c *Config) interface{} { return &c.Auth.JWTSecret }},
+	{"auth.token_lifetime", "token-lifetime", "how long the tokens from /token are valid", true, func(c *Config) interface{} { return &c.Auth.TokenLifetime }},
+	{"auth.admin_token", "", "bearer token for the operator endpoints under /admin/, disabled if empty", true, func(c *Config) interface{} { return &c.Auth.AdminToken }},
+	{"storage.snapshot", "snapshot", "snapshot file restored at startup and written periodically", false, func(c *Config) interface{} { return &c.Storage.Snapshot }},
+	{"storage.snapshot_interval", "snapshot-interval", "how often to write the snapshot file and compact the write-ahead log, 0 to disable", false, func(c *Config) interface{} { return &c.Storage.SnapshotInterval }},
+	{"storage.wal", "wal", "write-ahead log file making every change durable; needs -snapshot", false, func(c *Config) interface{} { return &c.Storage.WAL }},
+	{"trash.retention", "trash-retention", "how long deleted assets can be restored from the trash", true, func(c *Config) interface{} { return &c.Trash.Retention }},
+	{"panel.file", "panel", "path to a respondent panel CSV used for audience sizing", false, func(c *Config) interface{} { return &c.Panel.File }},
+	{"log.file", "log-file", "file the log is appended to, stderr if empty", true, func(c *Config) interface{} { return &c.Log.File }},
+	{"log.utc", "log-utc", "log times in UTC", true, func(c *Config) interface{} { return &c.Log.UTC }},
+	{"log.microseconds", "log-microseconds", "log times with microseconds", true, func(c *Config) interface{} { return &c.Log.Microseconds }},
+}
+
+// envName is the environment variable of a setting, e.g. FAVOURITES_HTTP_ADDR
+func envName(key string) string {
+	return "FAVOURITES_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func setValue(p interface{}, s string) error {
+	switch p := p.(type) {
+	case *string:
+		*p = s
+	case *int:
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		*p = v
+	case *bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		*p = v
+	}
+	return nil
+}
+
+func formatValue(p interface{}) string {
+	switch p := p.(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *time.Duration:
+		return p.String()
+	}
+	return ""
+}
+
+// settingFlag is the flag.Value of a setting
+type settingFlag struct{ p interface{} }
+
+func (f *settingFlag) String() string {
+	if f == nil || f.p == nil {
+		return ""
+	}
+	return formatValue(f.p)
+}
+
+func (f *settingFlag) Set(s string) error { return setValue(f.p, s) }
+
+func (f *settingFlag) IsBoolFlag() bool {
+	_, ok := f.p.(*bool)
+	return ok
+}
+
+// configFlags is the command line of the server
+type configFlags struct {
+	fs    *flag.FlagSet
+	path  string
+	print bool
+}
+
+// newConfigFlags registers -config, -print-config and a flag per setting
+func newConfigFlags(fs *flag.FlagSet) *configFlags {
+	f := &configFlags{fs: fs}
+	fs.StringVar(&f.path, "config", "", "YAML or TOML configuration file, $FAVOURITES_CONFIG by default")
+	fs.BoolVar(&f.print, "print-config", false, "print the effective configuration, secrets masked, and exit")
+	defaults := defaultConfig()
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		fs.Var(&settingFlag{s.field(defaults)}, s.flag, s.usage)
+	}
+	return f
+}
+
+// load builds and validates the configuration from the defaults, the file,
+// the environment read with lookupEnv and the flags given on the command line
+func (f *configFlags) load(lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := defaultConfig()
+	path := f.path
+	if path == "" {
+		path, _ = lookupEnv("FAVOURITES_CONFIG")
+	}
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		name := envName(s.key)
+		if v, ok := lookupEnv(name); ok {
+			if err := setValue(s.field(cfg), v); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	flagged := map[string]string{}
+	f.fs.Visit(func(fl *flag.Flag) { flagged[fl.Name] = fl.Value.String() })
+	for _, s := range settings {
+		if v, ok := flagged[s.flag]; ok && s.flag != "" {
+			setValue(s.field(cfg), v)
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile overlays a configuration file on cfg, TOML if its extension is
+// .toml and YAML otherwise. Unknown settings are errors, so typos are not
+// silently ignored.
+func (cfg *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown setting %s", path, undecoded[0])
+		}
+		return nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// validate reports every invalid setting at once
+func (cfg *Config) validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(cfg.HTTP.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("http.addr: %v", err))
+	}
+	timeouts := []struct {
+		key string
+		d   time.Duration
+	}{
+		{"http.read_timeout", cfg.HTTP.ReadTimeout},
+		{"http.read_header_timeout", cfg.HTTP.ReadHeaderTimeout},
+		{"http.write_timeout", cfg.HTTP.WriteTimeout},
+		{"http.idle_timeout", cfg.HTTP.IdleTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative", t.key))
+		}
+	}
+	if cfg.HTTP.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("http.max_header_bytes: must be positive"))
+	}
+	if cfg.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("http.shutdown_timeout: must be positive"))
+	}
+	if (cfg.TLS.Cert == "") != (cfg.TLS.Key == "") {
+		errs = append(errs, errors.New("tls.cert, tls.key: set both or neither"))
+	}
+	if cfg.TLS.ClientCA != "" && cfg.TLS.Cert == "" {
+		errs = append(errs, errors.New("tls.client_ca: client certificates need tls.cert"))
+	}
+	if cfg.TLS.RequireClientCert && cfg.TLS.ClientCA == "" {
+		errs = append(errs, errors.New("tls.require_client_cert: needs tls.client_ca"))
+	}
+	if len(cfg.TLS.ClientUsers) > 0 && cfg.TLS.ClientCA == "" {
+		errs = append(errs, errors.New("tls.client_users: needs tls.client_ca"))
+	}
+	subjects := make([]string, 0, len(cfg.TLS.ClientUsers))
+	for subject := range cfg.TLS.ClientUsers {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	for _, subject := range subjects {
+		if _, err := uuid.Parse(cfg.TLS.ClientUsers[subject]); err != nil {
+			errs = append(errs, fmt.Errorf("tls.client_users: %q maps to an invalid user ID %q", subject, cfg.TLS.ClientUsers[subject]))
+		}
+	}
+	if cfg.GRPC.Addr != "" {
+		if _, _, err := net.SplitHostPort(cfg.GRPC.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("grpc.addr: %v", err))
+		}
+	}
+	if cfg.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("auth.jwt_secret: must not be empty"))
+	}
+	if cfg.Auth.TokenLifetime <= 0 {
+		errs = append(errs, errors.New("auth.token_lifetime: must be positive"))
+	}
+	if cfg.Storage.SnapshotInterval < 0 {
+		errs = append(errs, errors.New("storage.snapshot_interval: must not be negative"))
+	}
+	if cfg.Storage.WAL != "" && cfg.Storage.Snapshot == "" {
+		errs = append(errs, errors.New("storage.wal: the write-ahead log is compacted into the snapshot, it needs storage.snapshot"))
+	}
+	if cfg.Trash.Retention <= 0 {
+		errs = append(errs, errors.New("trash.retention: must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// print writes the configuration as YAML with the secrets masked
+func (cfg *Config) print(w io.Writer) error {
+	masked := *cfg
+	for _, secret := range []*string{&masked.Auth.JWTSecret, &masked.Auth.AdminToken} {
+		if *secret != "" {
+			*secret = "********"
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&masked); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+var (
+	// settingsMu guards the settings a SIGHUP reloads while requests read them
+	settingsMu sync.RWMutex
+	// currentConfig is the configuration in effect
+	currentConfig *Config
+	// logFile is the open log.file, closed when it is replaced
+	logFile *os.File
+)
+
+// applyConfig puts a loaded configuration in effect at startup
+func applyConfig(cfg *Config) error {
+	jwtSecret = []byte(cfg.Auth.JWTSecret)
+	snapshotPath = cfg.Storage.Snapshot
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	if err := applySettings(cfg); err != nil {
+		return err
+	}
+	currentConfig = cfg
+	if cfg.Auth.JWTSecret == defaultJWTSecret {
+		log.Println("Using the built-in JWT secret, set auth.jwt_secret in production")
+	}
+	return nil
+}
+
+// applySettings sets the reloadable settings; settingsMu must be held
+func applySettings(cfg *Config) error {
+	out := io.Writer(os.Stderr)
+	var file *os.File
+	if cfg.Log.File != "" {
+		f, err := os.OpenFile(cfg.Log.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return fmt.Errorf("log.file: %v", err)
+		}
+		out, file = f, f
+	}
+	flags := log.LstdFlags
+	if cfg.Log.UTC {
+		flags |= log.LUTC
+	}
+	if cfg.Log.Microseconds {
+		flags |= log.Lmicroseconds
+	}
+	log.SetOutput(out)
+	log.SetFlags(flags)
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = file
+	users := make(map[string]uuid.UUID, len(cfg.TLS.ClientUsers))
+	for subject, userID := range cfg.TLS.ClientUsers {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			return fmt.Errorf("tls.client_users: %v", err)
+		}
+		users[subject] = id
+	}
+	clientUsers = users
+	tokenLifetime = cfg.Auth.TokenLifetime
+	adminToken = cfg.Auth.AdminToken
+	trashRetention = cfg.Trash.Retention
+	return nil
+}
+
+// reloadConfig puts the reloadable settings of next in effect. The others
+// keep their value until a restart, with a warning if they changed.
+func reloadConfig(next *Config) error {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	var changed []string
+	for _, s := range settings {
+		old, value := formatValue(s.field(currentConfig)), formatValue(s.field(next))
+		if old == value {
+			continue
+		}
+		if !s.reloadable {
+			log.Printf("reloadConfig: %s changed, restart the server to apply it", s.key)
+			setValue(s.field(next), old)
+			continue
+		}
+		changed = append(changed, s.key)
+	}
+	if !reflect.DeepEqual(currentConfig.TLS.ClientUsers, next.TLS.ClientUsers) {
+		changed = append(changed, "tls.client_users")
+	}
+	if err := applySettings(next); err != nil {
+		return err
+	}
+	currentConfig = next
+	log.Printf("reloadConfig: configuration reloaded, changed %d settings %v", len(changed), changed)
+	return nil
+}
+
+// watchReload reloads the configuration on every SIGHUP, keeping the
+// current one if the new one is invalid
+func watchReload(f *configFlags) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		next, err := f.load(os.LookupEnv)
+		if err == nil {
+			err = reloadConfig(next)
+		}
+		if err != nil {
+			log.Printf("watchReload: keeping the current configuration: %v", err)
+		}
+	}
+}
+
+func currentAdminToken() string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return adminToken
+}
+
+func currentTrashRetention() time.Duration {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return trashRetention
+}
+
+func currentTokenLifetime() time.Duration {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return tokenLifetime
+}
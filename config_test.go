@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadTestConfig loads the configuration from args and env as the server would
+func loadTestConfig(t *testing.T, args []string, env map[string]string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := newConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parsing %v: %v", args, err)
+	}
+	return flags.load(func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	file := writeTestFile(t, "server.yaml", `
+http:
+  addr: ":9000"
+grpc:
+  addr: ":9443"
+trash:
+  retention: 48h
+auth:
+  admin_token: from-file
+`)
+	cfg, err := loadTestConfig(t, []string{"-config", file, "-shutdown-timeout", "2s"}, map[string]string{
+		"FAVOURITES_TRASH_RETENTION":       "72h",
+		"FAVOURITES_AUTH_ADMIN_TOKEN":      "from-env",
+		"FAVOURITES_HTTP_SHUTDOWN_TIMEOUT": "3s",
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.HTTP.Addr != ":9000" || cfg.GRPC.Addr != ":9443" {
+		t.Errorf("expected the addresses from the file, got %q and %q", cfg.HTTP.Addr, cfg.GRPC.Addr)
+	}
+	if cfg.Trash.Retention != 72*time.Hour {
+		t.Errorf("expected the environment over the file, got %v", cfg.Trash.Retention)
+	}
+	if cfg.Auth.AdminToken != "from-env" {
+		t.Errorf("expected the environment over the file, got %q", cfg.Auth.AdminToken)
+	}
+	if cfg.HTTP.ShutdownTimeout != 2*time.Second {
+		t.Errorf("expected the flag over the environment, got %v", cfg.HTTP.ShutdownTimeout)
+	}
+	if cfg.Auth.TokenLifetime != 24*time.Hour || cfg.Storage.SnapshotInterval != 5*time.Minute {
+		t.Errorf("expected the defaults for unset settings, got %+v", cfg)
+	}
+	if cfg, _ := loadTestConfig(t, nil, nil); cfg.GRPC.Addr != "" {
+		t.Errorf("expected gRPC disabled by default, got %q", cfg.GRPC.Addr)
+	}
+
+	// The file can come from the environment too, in TOML
+	toml := writeTestFile(t, "server.toml", "[http]\naddr = \":7000\"\n[log]\nutc = true\n")
+	cfg, err = loadTestConfig(t, nil, map[string]string{"FAVOURITES_CONFIG": toml})
+	if err != nil || cfg.HTTP.Addr != ":7000" || !cfg.Log.UTC {
+		t.Errorf("expected the TOML file loaded, got %v %+v", err, cfg)
+	}
+}
+
+func TestConfigRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"unknown YAML setting", []string{"-config", writeTestFile(t, "c.yaml", "htp:\n  addr: x\n")}, nil, "field htp not found"},
+		{"unknown TOML setting", []string{"-config", writeTestFile(t, "c.toml", "[http]\nadress = \":1\"\n")}, nil, "unknown setting http.adress"},
+		{"missing file", []string{"-config", filepath.Join(t.TempDir(), "none.yaml")}, nil, "no such file"},
+		{"invalid environment", nil, map[string]string{"FAVOURITES_LOG_UTC": "sometimes"}, "FAVOURITES_LOG_UTC"},
+		{"invalid address", []string{"-addr", "8080"}, nil, "http.addr"},
+		{"empty secret", nil, map[string]string{"FAVOURITES_AUTH_JWT_SECRET": ""}, "auth.jwt_secret"},
+		{"wal without snapshot", []string{"-wal", "store.wal"}, nil, "needs storage.snapshot"},
+		{"negative retention", []string{"-trash-retention", "-1h"}, nil, "trash.retention"},
+		{"certificate without key", []string{"-tls-cert", "server.crt"}, nil, "tls.cert, tls.key"},
+		{"required client certificate without CA", []string{"-tls-cert", "server.crt", "-tls-key", "server.key", "-tls-require-client-cert"}, nil, "needs tls.client_ca"},
+		{"client user without UUID", []string{"-config", writeTestFile(t, "users.yaml", "tls:\n  cert: s.crt\n  key: s.key\n  client_ca: ca.crt\n  client_users:\n    CN=reporting: nobody\n")}, nil, `"CN=reporting" maps to an invalid user ID`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, tt.args, tt.env)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPrintConfigMasksSecrets(t *testing.T) {
+	cfg, err := loadTestConfig(t, []string{"-jwt-secret", "s3cret-signing-key"}, map[string]string{"FAVOURITES_AUTH_ADMIN_TOKEN": "op-token"})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	var out bytes.Buffer
+	if err := cfg.print(&out); err != nil {
+		t.Fatalf("print: %v", err)
+	}
+	if strings.Contains(out.String(), "s3cret") || strings.Contains(out.String(), "op-token") {
+		t.Errorf("expected the secrets masked\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "retention: 720h0m0s") {
+		t.Errorf("expected the effective settings printed\n%s", out.String())
+	}
+	if cfg.Auth.JWTSecret != "s3cret-signing-key" {
+		t.Error("expected printing to leave the configuration unchanged")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	oldSecret, oldRetention, oldLifetime, oldAdmin := jwtSecret, trashRetention, tokenLifetime, adminToken
+	t.Cleanup(func() {
+		jwtSecret, trashRetention, tokenLifetime, adminToken = oldSecret, oldRetention, oldLifetime, oldAdmin
+		currentConfig = nil
+	})
+	cfg, err := loadTestConfig(t, []string{"-jwt-secret", "first-secret"}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := applyConfig(cfg); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	next, _ := loadTestConfig(t, []string{"-jwt-secret", "second-secret", "-trash-retention", "1h"}, map[string]string{"FAVOURITES_AUTH_ADMIN_TOKEN": "reloaded"})
+	if err := reloadConfig(next); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if currentAdminToken() != "reloaded" || currentTrashRetention() != time.Hour {
+		t.Errorf("expected the safe settings reloaded, got %q and %v", currentAdminToken(), currentTrashRetention())
+	}
+	if string(jwtSecret) != "first-secret" || currentConfig.Auth.JWTSecret != "first-secret" {
+		t.Errorf("expected the secret to need a restart, got %q", jwtSecret)
+	}
+
+	// A log file that cannot be opened keeps the settings in effect
+	bad, _ := loadTestConfig(t, []string{"-log-file", filepath.Join(t.TempDir(), "missing", "server.log")}, map[string]string{"FAVOURITES_AUTH_ADMIN_TOKEN": "bad"})
+	if err := reloadConfig(bad); err == nil || currentAdminToken() != "reloaded" {
+		t.Errorf("expected the reload refused, got %v with %q", err, currentAdminToken())
+	}
+}
+
+func TestAdminTokenIsNotAFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	newConfigFlags(fs)
+	if err := fs.Parse([]string{"-admin-token", "visible-in-ps"}); err == nil {
+		t.Error("expected -admin-token rejected")
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types of the change stream
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	// Changes detailing an updated event
+	ChangeFavorited   = "favorited"
+	ChangeUnfavorited = "unfavorited"
+	// EventReset tells a resuming client that events were missed and it
+	// should reload its favourites
+	EventReset = "reset"
+)
+
+const (
+	eventBufferSize   = 256
+	subscriberBacklog = 64
+	heartbeatInterval = 15 * time.Second
+	// sseWriteWait bounds each write to a stream, which is exempt from the
+	// server's write timeout
+	sseWriteWait = 10 * time.Second
+)
+
+// Event is a change to one of a user's assets
+type Event struct {
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	Change    string          `json:"change,omitempty"`
+	UserID    uuid.UUID       `json:"-"`
+	AssetID   uuid.UUID       `json:"asset_id"`
+	AssetType string          `json:"asset_type,omitempty"`
+	Asset     json.RawMessage `json:"asset,omitempty"`
+	// CollectionIDs are the owner's collections holding the asset, or that
+	// held it before it was deleted
+	CollectionIDs []uuid.UUID `json:"collection_ids,omitempty"`
+	At            time.Time   `json:"at"`
+}
+
+// userEvents is the recent events of a user, oldest first, and the ID of the
+// newest event that no longer fits
+type userEvents struct {
+	ring    []Event
+	evicted uint64
+}
+
+// Hub fans events out to the subscribers of each user and keeps the last
+// eventBufferSize events per user so reconnecting clients can resume. The
+// buffer does not survive a restart, so the IDs of each boot start above
+// epoch, the boot time in microseconds: an ID from an earlier boot tells the
+// client missed events. Microseconds keep the IDs exact in JavaScript.
+type Hub struct {
+	mu     sync.Mutex
+	epoch  uint64
+	nextID uint64
+	recent map[uuid.UUID]*userEvents
+	subs   map[uuid.UUID]map[chan Event]struct{}
+	closed bool
+}
+
+// NewHub returns an empty hub
+func NewHub() *Hub {
+	epoch := uint64(time.Now().UnixMicro())
+	return &Hub{epoch: epoch, nextID: epoch, recent: make(map[uuid.UUID]*userEvents), subs: make(map[uuid.UUID]map[chan Event]struct{})}
+}
+
+var events = NewHub()
+
+// Publish numbers the event and delivers it to the user's subscribers. A
+// subscriber too slow to keep up is dropped; it can resume from the buffer.
+func (h *Hub) Publish(ev Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	ev.ID = h.nextID
+	recent := h.recent[ev.UserID]
+	if recent == nil {
+		recent = &userEvents{}
+		h.recent[ev.UserID] = recent
+	}
+	recent.ring = append(recent.ring, ev)
+	if len(recent.ring) > eventBufferSize {
+		recent.evicted = recent.ring[0].ID
+		recent.ring = append(recent.ring[:0:0], recent.ring[1:]...)
+	}
+	for ch := range h.subs[ev.UserID] {
+		select {
+		case ch <- ev:
+		default:
+			delete(h.subs[ev.UserID], ch)
+			close(ch)
+		}
+	}
+	return ev
+}
+
+// Subscribe registers a subscriber for the user's events and returns the
+// buffered events after lastID. complete is false when some events after
+// lastID were already evicted or lastID is not from this boot.
+func (h *Hub) Subscribe(userID uuid.UUID, lastID uint64) (ch chan Event, missed []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch = make(chan Event, subscriberBacklog)
+	if h.closed {
+		close(ch)
+		return ch, nil, true
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan Event]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	complete = lastID == 0 || (lastID > h.epoch && lastID <= h.nextID)
+	if recent := h.recent[userID]; recent != nil {
+		complete = complete && lastID >= recent.evicted
+		for _, ev := range recent.ring {
+			if ev.ID > lastID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	return ch, missed, complete
+}
+
+// Unsubscribe removes a subscriber, unless the hub already dropped it
+func (h *Hub) Unsubscribe(userID uuid.UUID, ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[userID][ch]; ok {
+		delete(h.subs[userID], ch)
+		close(ch)
+	}
+}
+
+// Close ends every subscription, for shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for userID, subs := range h.subs {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(h.subs, userID)
+	}
+}
+
+// notify queues an event about the owner's asset; it is published once the
+// mutation commits
+func notify(owner *User, typ string, asset Asset) {
+	notifyChange(owner, typ, "", asset)
+}
+
+// notifyChange is notify for an event detailing what changed
+func notifyChange(owner *User, typ, change string, asset Asset) {
+	ev := Event{Type: typ, Change: change, UserID: owner.ID, AssetID: asset.GetID(), AssetType: asset.GetType(), At: time.Now().UTC()}
+	for _, c := range store.CollectionsOf(owner) {
+		if c.hasAsset(ev.AssetID) {
+			ev.CollectionIDs = append(ev.CollectionIDs, c.ID)
+		}
+	}
+	if typ == EventDeleted {
+		for _, entry := range store.TrashOf(owner) {
+			if entry.Asset.GetID() == ev.AssetID {
+				ev.CollectionIDs = entry.CollectionIDs
+			}
+		}
+	} else {
+		raw, err := json.Marshal(asset)
+		if err != nil {
+			log.Printf("notifyChange: cannot encode asset %s: %v", asset.GetID(), err)
+			return
+		}
+		ev.Asset = raw
+	}
+	store.queueEvent(ev)
+}
+
+// queueEvent holds an event until the current mutation commits
+func (s *Storage) queueEvent(ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, ev)
+}
+
+// writeEvent writes an event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
+
+// Streams created/updated/deleted events for the user's assets as
+// Server-Sent Events. Clients resume with the Last-Event-ID header (or the
+// last_event_id query parameter); a reset event means events were missed.
+func handleFavouriteEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleFavouriteEvents: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleFavouriteEvents")
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Printf("handleFavouriteEvents: streaming unsupported")
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	lastHeader := r.Header.Get("Last-Event-ID")
+	if lastHeader == "" {
+		lastHeader = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastHeader != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(lastHeader, 10, 64); err != nil {
+			log.Printf("handleFavouriteEvents: invalid Last-Event-ID %q", lastHeader)
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The stream outlives the server's read and write timeouts, each write
+	// gets its own deadline instead
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	extendWrite := func() { rc.SetWriteDeadline(time.Now().Add(sseWriteWait)) }
+	extendWrite()
+
+	ch, missed, complete := events.Subscribe(user.ID, lastID)
+	defer events.Unsubscribe(user.ID, ch)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	log.Printf("handleFavouriteEvents: user %s subscribed after event %d", user.ID, lastID)
+
+	if lastHeader != "" && !complete {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", EventReset)
+	}
+	for _, ev := range missed {
+		if writeEvent(w, ev) != nil {
+			return
+		}
+		lastID = ev.ID
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, open := <-ch:
+			if !open {
+				return
+			}
+			// skip what the buffer replay already sent
+			if ev.ID <= lastID {
+				continue
+			}
+			extendWrite()
+			if writeEvent(w, ev) != nil {
+				return
+			}
+			lastID = ev.ID
+			flusher.Flush()
+		case <-heartbeat.C:
+			extendWrite()
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
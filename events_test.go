@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHub_ResumeFromBuffer(t *testing.T) {
+	hub := NewHub()
+	userID := uuid.New()
+	for i := 0; i < eventBufferSize+10; i++ {
+		hub.Publish(Event{Type: EventUpdated, UserID: userID})
+	}
+	hub.Publish(Event{Type: EventCreated, UserID: uuid.New()})
+
+	ch, missed, complete := hub.Subscribe(userID, hub.epoch+eventBufferSize)
+	if !complete || len(missed) != 10 || missed[0].ID != hub.epoch+eventBufferSize+1 {
+		t.Errorf("expected 10 buffered events from %d, got %d (complete %v)", hub.epoch+eventBufferSize+1, len(missed), complete)
+	}
+	hub.Unsubscribe(userID, ch)
+	if _, _, complete := hub.Subscribe(userID, hub.epoch+5); complete {
+		t.Error("expected resume past the buffer to be incomplete")
+	}
+}
+
+func TestHub_ResumeAcrossRestart(t *testing.T) {
+	before := NewHub()
+	userID := uuid.New()
+	last := before.Publish(Event{Type: EventUpdated, UserID: userID}).ID
+
+	// A restarted hub numbers its events above those of the last boot, and
+	// a client resuming from the last boot has missed events
+	time.Sleep(time.Millisecond)
+	after := NewHub()
+	if _, _, complete := after.Subscribe(userID, last); complete {
+		t.Error("expected resume from an earlier boot to be incomplete")
+	}
+	if ev := after.Publish(Event{Type: EventUpdated, UserID: userID}); ev.ID <= last {
+		t.Errorf("expected IDs above %d after the restart, got %d", last, ev.ID)
+	}
+	if _, _, complete := after.Subscribe(userID, after.nextID+1); complete {
+		t.Error("expected resume from an unknown ID to be incomplete")
+	}
+}
+
+func TestHub_DropsSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	userID := uuid.New()
+	ch, _, _ := hub.Subscribe(userID, 0)
+	for i := 0; i <= subscriberBacklog; i++ {
+		hub.Publish(Event{Type: EventUpdated, UserID: userID})
+	}
+	received := 0
+	for range ch {
+		received++
+	}
+	if received != subscriberBacklog {
+		t.Errorf("expected %d events before the drop, got %d", subscriberBacklog, received)
+	}
+	hub.Unsubscribe(userID, ch)
+}
+
+// readEvent reads the next event of a stream, skipping comments
+func readEvent(t *testing.T, reader *bufio.Reader) (id uint64, typ string, ev Event) {
+	t.Helper()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id, _ = strconv.ParseUint(line[4:], 10, 64)
+		case strings.HasPrefix(line, "event: "):
+			typ = line[7:]
+		case strings.HasPrefix(line, "data: "):
+			json.Unmarshal([]byte(line[6:]), &ev)
+		case line == "" && typ != "":
+			return id, typ, ev
+		}
+	}
+}
+
+func openStream(t *testing.T, url, token, lastID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected stream response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestHandleFavouriteEvents(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+	server := httptest.NewServer(AuthMiddleware(handleFavouriteEvents))
+	defer server.Close()
+
+	stream := openStream(t, server.URL, token, "")
+	chart := &Chart{ID: uuid.New(), Title: "Sales"}
+	doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{"type": ChartType, "asset": chart})
+	doRequest(t, handleEditFavourite, token, http.MethodPut, "/favourites/edit?asset_id="+chart.ID.String(), map[string]string{"description": "edited"})
+	doRequest(t, handleDeleteFavourite, token, http.MethodDelete, "/favourites/delete?asset_id="+chart.ID.String(), nil)
+
+	createdID, typ, ev := readEvent(t, stream)
+	if typ != EventCreated || ev.AssetID != chart.ID || ev.AssetType != ChartType || len(ev.Asset) == 0 {
+		t.Errorf("unexpected first event %s %+v", typ, ev)
+	}
+	for _, want := range []string{EventUpdated, EventDeleted} {
+		if _, typ, ev := readEvent(t, stream); typ != want || ev.AssetID != chart.ID {
+			t.Errorf("expected %s event, got %s %+v", want, typ, ev)
+		}
+	}
+
+	// Resuming after the first event replays the rest from the buffer
+	resumed := openStream(t, server.URL, token, strconv.FormatUint(createdID, 10))
+	if id, typ, _ := readEvent(t, resumed); typ != EventUpdated || id != createdID+1 {
+		t.Errorf("expected updated event %d on resume, got %s %d", createdID+1, typ, id)
+	}
+}
+
+func TestHandleFavouriteEvents_NotPublishedOnFailure(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+	ch, _, _ := events.Subscribe(userID, 0)
+	defer events.Unsubscribe(userID, ch)
+
+	w := doRequest(t, handleDeleteFavourite, token, http.MethodDelete, "/favourites/delete?asset_id="+uuid.New().String(), nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+}
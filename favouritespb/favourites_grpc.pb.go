@@ -0,0 +1,369 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: favourites/v1/favourites.proto
+
+package favouritespb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Favourites_ListFavourites_FullMethodName   = "/favourites.v1.Favourites/ListFavourites"
+	Favourites_StreamFavourites_FullMethodName = "/favourites.v1.Favourites/StreamFavourites"
+	Favourites_GetFavourite_FullMethodName     = "/favourites.v1.Favourites/GetFavourite"
+	Favourites_AddFavourite_FullMethodName     = "/favourites.v1.Favourites/AddFavourite"
+	Favourites_UpdateFavourite_FullMethodName  = "/favourites.v1.Favourites/UpdateFavourite"
+	Favourites_ToggleFavourite_FullMethodName  = "/favourites.v1.Favourites/ToggleFavourite"
+	Favourites_DeleteFavourite_FullMethodName  = "/favourites.v1.Favourites/DeleteFavourite"
+)
+
+// FavouritesClient is the client API for Favourites service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Favourites serves the same assets as the HTTP API. Calls authenticate with
+// the JWT of POST /token in the "authorization: Bearer <token>" metadata.
+type FavouritesClient interface {
+	// ListFavourites returns a page of the assets marked favourite, in display
+	// order, like GET /favourites
+	ListFavourites(ctx context.Context, in *ListFavouritesRequest, opts ...grpc.CallOption) (*ListFavouritesResponse, error)
+	// StreamFavourites streams every matching asset, for large collections
+	StreamFavourites(ctx context.Context, in *StreamFavouritesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Asset], error)
+	GetFavourite(ctx context.Context, in *GetFavouriteRequest, opts ...grpc.CallOption) (*Asset, error)
+	AddFavourite(ctx context.Context, in *AddFavouriteRequest, opts ...grpc.CallOption) (*Asset, error)
+	// UpdateFavourite replaces an asset's content, like PUT /favourites/{id}
+	UpdateFavourite(ctx context.Context, in *UpdateFavouriteRequest, opts ...grpc.CallOption) (*Asset, error)
+	ToggleFavourite(ctx context.Context, in *ToggleFavouriteRequest, opts ...grpc.CallOption) (*Asset, error)
+	// DeleteFavourite moves an asset to the trash
+	DeleteFavourite(ctx context.Context, in *DeleteFavouriteRequest, opts ...grpc.CallOption) (*DeleteFavouriteResponse, error)
+}
+
+type favouritesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFavouritesClient(cc grpc.ClientConnInterface) FavouritesClient {
+	return &favouritesClient{cc}
+}
+
+func (c *favouritesClient) ListFavourites(ctx context.Context, in *ListFavouritesRequest, opts ...grpc.CallOption) (*ListFavouritesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFavouritesResponse)
+	err := c.cc.Invoke(ctx, Favourites_ListFavourites_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *favouritesClient) StreamFavourites(ctx context.Context, in *StreamFavouritesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Asset], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Favourites_ServiceDesc.Streams[0], Favourites_StreamFavourites_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamFavouritesRequest, Asset]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Favourites_StreamFavouritesClient = grpc.ServerStreamingClient[Asset]
+
+func (c *favouritesClient) GetFavourite(ctx context.Context, in *GetFavouriteRequest, opts ...grpc.CallOption) (*Asset, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Asset)
+	err := c.cc.Invoke(ctx, Favourites_GetFavourite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *favouritesClient) AddFavourite(ctx context.Context, in *AddFavouriteRequest, opts ...grpc.CallOption) (*Asset, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Asset)
+	err := c.cc.Invoke(ctx, Favourites_AddFavourite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *favouritesClient) UpdateFavourite(ctx context.Context, in *UpdateFavouriteRequest, opts ...grpc.CallOption) (*Asset, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Asset)
+	err := c.cc.Invoke(ctx, Favourites_UpdateFavourite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *favouritesClient) ToggleFavourite(ctx context.Context, in *ToggleFavouriteRequest, opts ...grpc.CallOption) (*Asset, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Asset)
+	err := c.cc.Invoke(ctx, Favourites_ToggleFavourite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *favouritesClient) DeleteFavourite(ctx context.Context, in *DeleteFavouriteRequest, opts ...grpc.CallOption) (*DeleteFavouriteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteFavouriteResponse)
+	err := c.cc.Invoke(ctx, Favourites_DeleteFavourite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FavouritesServer is the server API for Favourites service.
+// All implementations must embed UnimplementedFavouritesServer
+// for forward compatibility.
+//
+// Favourites serves the same assets as the HTTP API. Calls authenticate with
+// the JWT of POST /token in the "authorization: Bearer <token>" metadata.
+type FavouritesServer interface {
+	// ListFavourites returns a page of the assets marked favourite, in display
+	// order, like GET /favourites
+	ListFavourites(context.Context, *ListFavouritesRequest) (*ListFavouritesResponse, error)
+	// StreamFavourites streams every matching asset, for large collections
+	StreamFavourites(*StreamFavouritesRequest, grpc.ServerStreamingServer[Asset]) error
+	GetFavourite(context.Context, *GetFavouriteRequest) (*Asset, error)
+	AddFavourite(context.Context, *AddFavouriteRequest) (*Asset, error)
+	// UpdateFavourite replaces an asset's content, like PUT /favourites/{id}
+	UpdateFavourite(context.Context, *UpdateFavouriteRequest) (*Asset, error)
+	ToggleFavourite(context.Context, *ToggleFavouriteRequest) (*Asset, error)
+	// DeleteFavourite moves an asset to the trash
+	DeleteFavourite(context.Context, *DeleteFavouriteRequest) (*DeleteFavouriteResponse, error)
+	mustEmbedUnimplementedFavouritesServer()
+}
+
+// UnimplementedFavouritesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFavouritesServer struct{}
+
+func (UnimplementedFavouritesServer) ListFavourites(context.Context, *ListFavouritesRequest) (*ListFavouritesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFavourites not implemented")
+}
+func (UnimplementedFavouritesServer) StreamFavourites(*StreamFavouritesRequest, grpc.ServerStreamingServer[Asset]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamFavourites not implemented")
+}
+func (UnimplementedFavouritesServer) GetFavourite(context.Context, *GetFavouriteRequest) (*Asset, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFavourite not implemented")
+}
+func (UnimplementedFavouritesServer) AddFavourite(context.Context, *AddFavouriteRequest) (*Asset, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddFavourite not implemented")
+}
+func (UnimplementedFavouritesServer) UpdateFavourite(context.Context, *UpdateFavouriteRequest) (*Asset, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateFavourite not implemented")
+}
+func (UnimplementedFavouritesServer) ToggleFavourite(context.Context, *ToggleFavouriteRequest) (*Asset, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ToggleFavourite not implemented")
+}
+func (UnimplementedFavouritesServer) DeleteFavourite(context.Context, *DeleteFavouriteRequest) (*DeleteFavouriteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFavourite not implemented")
+}
+func (UnimplementedFavouritesServer) mustEmbedUnimplementedFavouritesServer() {}
+func (UnimplementedFavouritesServer) testEmbeddedByValue()                    {}
+
+// UnsafeFavouritesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FavouritesServer will
+// result in compilation errors.
+type UnsafeFavouritesServer interface {
+	mustEmbedUnimplementedFavouritesServer()
+}
+
+func RegisterFavouritesServer(s grpc.ServiceRegistrar, srv FavouritesServer) {
+	// If the following call pancis, it indicates UnimplementedFavouritesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Favourites_ServiceDesc, srv)
+}
+
+func _Favourites_ListFavourites_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFavouritesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FavouritesServer).ListFavourites(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Favourites_ListFavourites_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FavouritesServer).ListFavourites(ctx, req.(*ListFavouritesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Favourites_StreamFavourites_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamFavouritesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FavouritesServer).StreamFavourites(m, &grpc.GenericServerStream[StreamFavouritesRequest, Asset]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Favourites_StreamFavouritesServer = grpc.ServerStreamingServer[Asset]
+
+func _Favourites_GetFavourite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFavouriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FavouritesServer).GetFavourite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Favourites_GetFavourite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FavouritesServer).GetFavourite(ctx, req.(*GetFavouriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Favourites_AddFavourite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddFavouriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FavouritesServer).AddFavourite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Favourites_AddFavourite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FavouritesServer).AddFavourite(ctx, req.(*AddFavouriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Favourites_UpdateFavourite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateFavouriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FavouritesServer).UpdateFavourite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Favourites_UpdateFavourite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FavouritesServer).UpdateFavourite(ctx, req.(*UpdateFavouriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Favourites_ToggleFavourite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ToggleFavouriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FavouritesServer).ToggleFavourite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Favourites_ToggleFavourite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FavouritesServer).ToggleFavourite(ctx, req.(*ToggleFavouriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Favourites_DeleteFavourite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFavouriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FavouritesServer).DeleteFavourite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Favourites_DeleteFavourite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FavouritesServer).DeleteFavourite(ctx, req.(*DeleteFavouriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Favourites_ServiceDesc is the grpc.ServiceDesc for Favourites service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Favourites_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "favourites.v1.Favourites",
+	HandlerType: (*FavouritesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListFavourites",
+			Handler:    _Favourites_ListFavourites_Handler,
+		},
+		{
+			MethodName: "GetFavourite",
+			Handler:    _Favourites_GetFavourite_Handler,
+		},
+		{
+			MethodName: "AddFavourite",
+			Handler:    _Favourites_AddFavourite_Handler,
+		},
+		{
+			MethodName: "UpdateFavourite",
+			Handler:    _Favourites_UpdateFavourite_Handler,
+		},
+		{
+			MethodName: "ToggleFavourite",
+			Handler:    _Favourites_ToggleFavourite_Handler,
+		},
+		{
+			MethodName: "DeleteFavourite",
+			Handler:    _Favourites_DeleteFavourite_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamFavourites",
+			Handler:       _Favourites_StreamFavourites_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "favourites/v1/favourites.proto",
+}
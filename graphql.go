@@ -0,0 +1,705 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+const graphqlSchemaSDL = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	# assets lists the user's assets in display order
+	assets(filter: AssetFilter, first: Int, after: String): AssetConnection!
+	# favourites lists the assets marked favourite, like GET /favourites
+	favourites(filter: AssetFilter, first: Int, after: String): AssetConnection!
+	# asset returns one of the user's assets or one shared with them
+	asset(id: ID!): Asset
+}
+
+type Mutation {
+	addAsset(input: AssetInput!): Asset!
+	editAsset(id: ID!, description: String!): Asset!
+	toggleFavourite(id: ID!, favorite: Boolean!): Asset!
+	# deleteAsset moves an asset to the trash and returns its ID
+	deleteAsset(id: ID!): ID!
+}
+
+interface Asset {
+	id: ID!
+	type: String!
+	description: String!
+	favorite: Boolean!
+	tags: [String!]!
+	position: Float!
+	pinned: Boolean!
+}
+
+type Chart implements Asset {
+	id: ID!
+	type: String!
+	description: String!
+	favorite: Boolean!
+	tags: [String!]!
+	position: Float!
+	pinned: Boolean!
+	title: String!
+	xAxisTitle: String!
+	yAxisTitle: String!
+	data: [Float!]!
+}
+
+type Insight implements Asset {
+	id: ID!
+	type: String!
+	description: String!
+	favorite: Boolean!
+	tags: [String!]!
+	position: Float!
+	pinned: Boolean!
+	text: String!
+	sources: [Source!]!
+	# relatedAssets returns the first linked assets, at most 10
+	relatedAssets(first: Int): [Asset!]!
+}
+
+type Audience implements Asset {
+	id: ID!
+	type: String!
+	description: String!
+	favorite: Boolean!
+	tags: [String!]!
+	position: Float!
+	pinned: Boolean!
+	# rules is an audience expression, null for an empty audience
+	rules: String
+}
+
+type Source {
+	title: String!
+	url: String!
+}
+
+type AssetConnection {
+	totalCount: Int!
+	nodes: [Asset!]!
+	pageInfo: PageInfo!
+}
+
+type PageInfo {
+	endCursor: String
+	hasNextPage: Boolean!
+}
+
+input AssetFilter {
+	type: String
+	favorite: Boolean
+	tag: String
+	collectionId: ID
+}
+
+# AssetInput takes exactly one of chart, insight and audience
+input AssetInput {
+	id: ID
+	description: String
+	favorite: Boolean
+	tags: [String!]
+	chart: ChartInput
+	insight: InsightInput
+	audience: AudienceInput
+}
+
+input ChartInput {
+	title: String!
+	xAxisTitle: String
+	yAxisTitle: String
+	data: [Float!]
+}
+
+input InsightInput {
+	text: String!
+	sources: [SourceInput!]
+	relatedAssets: [ID!]
+}
+
+input SourceInput {
+	title: String!
+	url: String!
+}
+
+input AudienceInput {
+	rules: String
+}
+`
+
+const (
+	graphqlDefaultPageSize = 50
+	graphqlMaxPageSize     = 100
+	graphqlMaxDepth        = 10
+	graphqlMaxRelated      = 10
+	graphqlMaxBody         = 64 << 10
+)
+
+// graphqlMaxCost bounds the estimated cost of a query, see graphqlCost
+var graphqlMaxCost = 2000
+
+// graphqlListSizes are the sizes assumed for list fields without a first
+// argument when estimating the cost of a query
+var graphqlListSizes = map[string]int{
+	"assets":        graphqlDefaultPageSize,
+	"favourites":    graphqlDefaultPageSize,
+	"relatedAssets": graphqlMaxRelated,
+	"sources":       10,
+}
+
+var graphqlSchema = graphql.MustParseSchema(graphqlSchemaSDL, &graphqlResolver{}, graphql.MaxDepth(graphqlMaxDepth))
+
+// Runs a GraphQL query or mutation, sent as JSON in a POST body or, for
+// queries only, as GET query parameters
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				log.Printf("handleGraphQL: invalid variables: %v", err)
+				writeGraphQLError(w, http.StatusBadRequest, "Invalid variables")
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, graphqlMaxBody)).Decode(&req); err != nil {
+			log.Printf("handleGraphQL: invalid request body: %v", err)
+			writeGraphQLError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+	default:
+		log.Printf("handleGraphQL: method not allowed %s", r.Method)
+		writeGraphQLError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	kind, cost, err := graphqlCost(req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		log.Printf("handleGraphQL: invalid query: %v", err)
+		writeGraphQLError(w, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	if kind == "mutation" && r.Method != http.MethodPost {
+		log.Printf("handleGraphQL: mutation sent with %s", r.Method)
+		writeGraphQLError(w, http.StatusMethodNotAllowed, "Mutations must be sent with POST")
+		return
+	}
+	if cost > graphqlMaxCost {
+		log.Printf("handleGraphQL: query cost %d exceeds %d", cost, graphqlMaxCost)
+		writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf("Query too complex: cost %d exceeds %d", cost, graphqlMaxCost))
+		return
+	}
+	resp := graphqlSchema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeGraphQLError rejects a request with a GraphQL error response
+func writeGraphQLError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": []map[string]string{{"message": message}}})
+}
+
+type graphqlResolver struct{}
+
+type assetFilter struct {
+	Type         *string
+	Favorite     *bool
+	Tag          *string
+	CollectionID *graphql.ID
+}
+
+type pageArgs struct {
+	Filter *assetFilter
+	First  *int32
+	After  *string
+}
+
+func (r *graphqlResolver) Assets(ctx context.Context, args pageArgs) (*assetConnection, error) {
+	return listAssets(ctx, args, false)
+}
+
+func (r *graphqlResolver) Favourites(ctx context.Context, args pageArgs) (*assetConnection, error) {
+	return listAssets(ctx, args, true)
+}
+
+// listAssets returns a page of the user's assets matching the filter. The
+// cursor is the offset of the next page.
+func listAssets(ctx context.Context, args pageArgs, favourites bool) (*assetConnection, error) {
+	user := userFromContext(ctx)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	filter := args.Filter
+	if filter == nil {
+		filter = &assetFilter{}
+	}
+	var collection *Collection
+	if filter.CollectionID != nil {
+		if id, err := uuid.Parse(string(*filter.CollectionID)); err == nil {
+			collection = findCollection(user, id)
+		}
+		if collection == nil {
+			return nil, errors.New("collection not found")
+		}
+	}
+	tag := ""
+	if filter.Tag != nil {
+		tag = strings.ToLower(strings.TrimSpace(*filter.Tag))
+	}
+	assets := make([]Asset, 0)
+	for _, asset := range sortedFavourites(user) {
+		if (favourites && !asset.IsFavorite()) || (filter.Favorite != nil && asset.IsFavorite() != *filter.Favorite) {
+			continue
+		}
+		if (filter.Type != nil && asset.GetType() != *filter.Type) || (collection != nil && !collection.hasAsset(asset.GetID())) || (tag != "" && !hasTag(asset, tag)) {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+	size := graphqlDefaultPageSize
+	if args.First != nil {
+		if *args.First < 0 {
+			return nil, errors.New("first cannot be negative")
+		}
+		size = min(int(*args.First), graphqlMaxPageSize)
+	}
+	start := 0
+	if args.After != nil {
+		var err error
+		if start, err = strconv.Atoi(*args.After); err != nil || start < 0 {
+			return nil, errors.New("invalid after cursor")
+		}
+	}
+	start = min(start, len(assets))
+	end := min(start+size, len(assets))
+	return &assetConnection{owner: user, assets: assets, start: start, end: end}, nil
+}
+
+func (r *graphqlResolver) Asset(ctx context.Context, args struct{ ID graphql.ID }) (*assetResolver, error) {
+	user := userFromContext(ctx)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	assetID, err := uuid.Parse(string(args.ID))
+	if err != nil {
+		return nil, errors.New("invalid asset id")
+	}
+	owner, asset, err := resolveAsset(user, assetID, PermRead)
+	if errors.Is(err, errAssetNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("insufficient permission on asset")
+	}
+	return &assetResolver{asset: asset, owner: owner}, nil
+}
+
+type assetInput struct {
+	ID          *graphql.ID
+	Description *string
+	Favorite    *bool
+	Tags        *[]string
+	Chart       *struct {
+		Title      string
+		XAxisTitle *string
+		YAxisTitle *string
+		Data       *[]float64
+	}
+	Insight *struct {
+		Text    string
+		Sources *[]struct {
+			Title string
+			URL   string
+		}
+		RelatedAssets *[]graphql.ID
+	}
+	Audience *struct {
+		Rules *string
+	}
+}
+
+// decode validates the input like the body of POST /favourites/add
+func (in assetInput) decode(user *User) (Asset, error) {
+	fields := map[string]interface{}{}
+	if in.ID != nil {
+		fields["ID"] = *in.ID
+	}
+	if in.Description != nil {
+		fields["Description"] = *in.Description
+	}
+	if in.Tags != nil {
+		fields["Tags"] = *in.Tags
+	}
+	var kinds []string
+	if c := in.Chart; c != nil {
+		kinds = append(kinds, ChartType)
+		fields["Title"], fields["XAxisTitle"], fields["YAxisTitle"], fields["Data"] = c.Title, c.XAxisTitle, c.YAxisTitle, c.Data
+	}
+	if i := in.Insight; i != nil {
+		kinds = append(kinds, InsightType)
+		fields["Text"], fields["Sources"], fields["RelatedAssets"] = i.Text, i.Sources, i.RelatedAssets
+	}
+	if a := in.Audience; a != nil {
+		kinds = append(kinds, AudienceType)
+		if a.Rules != nil && *a.Rules != "" {
+			fields["Rules"] = *a.Rules
+		}
+	}
+	if len(kinds) != 1 {
+		return nil, errors.New("input needs exactly one of chart, insight and audience")
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	asset, err := decodeAsset(kinds[0], raw, store.FavouritesOf(user))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s asset: %v", kinds[0], err)
+	}
+	asset.SetFavorite(in.Favorite != nil && *in.Favorite)
+	return asset, nil
+}
+
+func (r *graphqlResolver) AddAsset(ctx context.Context, args struct{ Input assetInput }) (*assetResolver, error) {
+	user := userFromContext(ctx)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	asset, err := args.Input.decode(user)
+	if err != nil {
+		log.Printf("addAsset: %v", err)
+		return nil, err
+	}
+	if err := store.AddAsset(user, asset); err != nil {
+		log.Printf("addAsset: duplicate asset %s", asset.GetID())
+		return nil, errors.New("an asset with the same ID already exists")
+	}
+	recordRevision(user, asset, user.ID, "create")
+	notify(user, EventCreated, asset)
+	log.Printf("addAsset: asset added for user %s, type %s, id %s", user.ID, asset.GetType(), asset.GetID())
+	return &assetResolver{asset: asset, owner: user}, nil
+}
+
+// editableAsset applies edit to an asset the user may edit
+func editableAsset(ctx context.Context, id graphql.ID, edit func(Asset)) (*User, *User, Asset, error) {
+	user := userFromContext(ctx)
+	if user == nil {
+		return nil, nil, nil, errors.New("user not found")
+	}
+	assetID, err := uuid.Parse(string(id))
+	if err != nil {
+		return nil, nil, nil, errors.New("invalid asset id")
+	}
+	owner, asset, err := editAsset(user, assetID, edit)
+	if errors.Is(err, errForbidden) {
+		return nil, nil, nil, errors.New("insufficient permission on asset")
+	}
+	if err != nil {
+		return nil, nil, nil, errors.New("asset not found")
+	}
+	return user, owner, asset, nil
+}
+
+func (r *graphqlResolver) EditAsset(ctx context.Context, args struct {
+	ID          graphql.ID
+	Description string
+}) (*assetResolver, error) {
+	user, owner, asset, err := editableAsset(ctx, args.ID, func(a Asset) { a.SetDescription(args.Description) })
+	if err != nil {
+		log.Printf("editAsset: %v", err)
+		return nil, err
+	}
+	recordRevision(owner, asset, user.ID, "description")
+	notify(owner, EventUpdated, asset)
+	log.Printf("editAsset: updated description for asset %s to '%s'", asset.GetID(), args.Description)
+	return &assetResolver{asset: asset, owner: owner}, nil
+}
+
+func (r *graphqlResolver) ToggleFavourite(ctx context.Context, args struct {
+	ID       graphql.ID
+	Favorite bool
+}) (*assetResolver, error) {
+	user, owner, asset, err := editableAsset(ctx, args.ID, func(a Asset) { a.SetFavorite(args.Favorite) })
+	if err != nil {
+		log.Printf("toggleFavourite: %v", err)
+		return nil, err
+	}
+	recordRevision(owner, asset, user.ID, "favorite")
+	change := ChangeUnfavorited
+	if args.Favorite {
+		change = ChangeFavorited
+	}
+	notifyChange(owner, EventUpdated, change, asset)
+	log.Printf("toggleFavourite: updated favorite for asset %s to %v", asset.GetID(), args.Favorite)
+	return &assetResolver{asset: asset, owner: owner}, nil
+}
+
+func (r *graphqlResolver) DeleteAsset(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	user := userFromContext(ctx)
+	if user == nil {
+		return "", errors.New("user not found")
+	}
+	assetID, err := uuid.Parse(string(args.ID))
+	if err != nil {
+		return "", errors.New("invalid asset id")
+	}
+	asset := findAsset(user, assetID)
+	if asset == nil || !store.TrashAsset(user, assetID, time.Now().UTC()) {
+		log.Printf("deleteAsset: asset not found %s", assetID)
+		return "", errors.New("asset not found in favourites")
+	}
+	notify(user, EventDeleted, asset)
+	log.Printf("deleteAsset: asset %s moved to trash for user %s", assetID, user.ID)
+	return args.ID, nil
+}
+
+type assetConnection struct {
+	owner      *User
+	assets     []Asset
+	start, end int
+}
+
+func (c *assetConnection) TotalCount() int32 { return int32(len(c.assets)) }
+
+func (c *assetConnection) Nodes() []*assetResolver {
+	nodes := make([]*assetResolver, 0, c.end-c.start)
+	for _, asset := range c.assets[c.start:c.end] {
+		nodes = append(nodes, &assetResolver{asset: asset, owner: c.owner})
+	}
+	return nodes
+}
+
+func (c *assetConnection) PageInfo() *pageInfo {
+	info := &pageInfo{hasNextPage: c.end < len(c.assets)}
+	if info.hasNextPage {
+		cursor := strconv.Itoa(c.end)
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+type pageInfo struct {
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (p *pageInfo) EndCursor() *string { return p.endCursor }
+func (p *pageInfo) HasNextPage() bool  { return p.hasNextPage }
+
+// assetResolver resolves the Asset interface; owner is the user the asset
+// belongs to, whose assets related insights link to
+type assetResolver struct {
+	asset Asset
+	owner *User
+}
+
+func (r *assetResolver) ID() graphql.ID      { return graphql.ID(r.asset.GetID().String()) }
+func (r *assetResolver) Type() string        { return r.asset.GetType() }
+func (r *assetResolver) Description() string { return r.asset.GetDescription() }
+func (r *assetResolver) Favorite() bool      { return r.asset.IsFavorite() }
+func (r *assetResolver) Position() float64   { return r.asset.GetPosition() }
+func (r *assetResolver) Pinned() bool        { return r.asset.IsPinned() }
+
+func (r *assetResolver) Tags() []string {
+	if tags := r.asset.GetTags(); tags != nil {
+		return tags
+	}
+	return []string{}
+}
+
+func (r *assetResolver) ToChart() (*chartResolver, bool) {
+	c, ok := r.asset.(*Chart)
+	return &chartResolver{r, c}, ok
+}
+
+func (r *assetResolver) ToInsight() (*insightResolver, bool) {
+	i, ok := r.asset.(*Insight)
+	return &insightResolver{r, i}, ok
+}
+
+func (r *assetResolver) ToAudience() (*audienceResolver, bool) {
+	a, ok := r.asset.(*Audience)
+	return &audienceResolver{r, a}, ok
+}
+
+type chartResolver struct {
+	*assetResolver
+	chart *Chart
+}
+
+func (r *chartResolver) Title() string      { return r.chart.Title }
+func (r *chartResolver) XAxisTitle() string { return r.chart.XAxisTitle }
+func (r *chartResolver) YAxisTitle() string { return r.chart.YAxisTitle }
+
+func (r *chartResolver) Data() []float64 {
+	if r.chart.Data != nil {
+		return r.chart.Data
+	}
+	return []float64{}
+}
+
+type insightResolver struct {
+	*assetResolver
+	insight *Insight
+}
+
+func (r *insightResolver) Text() string { return r.insight.Text }
+
+func (r *insightResolver) Sources() []*sourceResolver {
+	sources := make([]*sourceResolver, len(r.insight.Sources))
+	for n := range r.insight.Sources {
+		sources[n] = &sourceResolver{&r.insight.Sources[n]}
+	}
+	return sources
+}
+
+// RelatedAssets resolves the first linked assets that still exist, at most
+// graphqlMaxRelated so the cost estimate holds
+func (r *insightResolver) RelatedAssets(args struct{ First *int32 }) []*assetResolver {
+	limit := graphqlMaxRelated
+	if args.First != nil {
+		limit = max(0, min(int(*args.First), graphqlMaxRelated))
+	}
+	related := make([]*assetResolver, 0, min(limit, len(r.insight.RelatedAssets)))
+	for _, id := range r.insight.RelatedAssets {
+		if len(related) == limit {
+			break
+		}
+		if asset := findAsset(r.owner, id); asset != nil {
+			related = append(related, &assetResolver{asset: asset, owner: r.owner})
+		}
+	}
+	return related
+}
+
+type sourceResolver struct{ source *Source }
+
+func (r *sourceResolver) Title() string { return r.source.Title }
+func (r *sourceResolver) URL() string   { return r.source.URL }
+
+type audienceResolver struct {
+	*assetResolver
+	audience *Audience
+}
+
+func (r *audienceResolver) Rules() *string {
+	if r.audience.Rules == nil {
+		return nil
+	}
+	rules := r.audience.Rules.String()
+	return &rules
+}
+
+// graphqlCost returns the kind (query, mutation or subscription) of the
+// operation to run and its estimated cost before running it. Every field
+// costs 1, times the sizes of the lists it is nested in: the first argument
+// of a list, or its size in graphqlListSizes, at most its limit. Fragments
+// are expanded and variables take their defaults. graph-gophers keeps its
+// query parser internal, so the query is parsed with gqlparser.
+func graphqlCost(query, operationName string, variables map[string]interface{}) (string, int, error) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(doc.Operations) == 0 {
+		return "", 0, errors.New("no operation")
+	}
+	op := doc.Operations.ForName(operationName)
+	if op == nil {
+		if operationName == "" {
+			return "", 0, errors.New("operationName is required for a document with several operations")
+		}
+		return "", 0, fmt.Errorf("no operation %q", operationName)
+	}
+	vars := make(map[string]interface{}, len(op.VariableDefinitions))
+	for _, def := range op.VariableDefinitions {
+		if v, ok := variables[def.Variable]; ok {
+			vars[def.Variable] = v
+		} else if def.DefaultValue != nil {
+			vars[def.Variable], _ = def.DefaultValue.Value(nil)
+		}
+	}
+	c := &gqlCoster{fragments: doc.Fragments, variables: vars, expanding: map[string]bool{}}
+	return string(op.Operation), c.cost(op.SelectionSet, 1), nil
+}
+
+type gqlCoster struct {
+	fragments ast.FragmentDefinitionList
+	variables map[string]interface{}
+	expanding map[string]bool
+}
+
+func (c *gqlCoster) cost(selection ast.SelectionSet, multiplier int) int {
+	total := 0
+	for _, sel := range selection {
+		switch sel := sel.(type) {
+		case *ast.FragmentSpread:
+			// A cycle is invalid and rejected by the schema, count it once
+			fragment := c.fragments.ForName(sel.Name)
+			if fragment == nil || c.expanding[sel.Name] {
+				continue
+			}
+			c.expanding[sel.Name] = true
+			total += c.cost(fragment.SelectionSet, multiplier)
+			delete(c.expanding, sel.Name)
+		case *ast.InlineFragment:
+			total += c.cost(sel.SelectionSet, multiplier)
+		case *ast.Field:
+			total += multiplier + c.cost(sel.SelectionSet, min(multiplier*c.listSize(sel), graphqlMaxCost+1))
+		}
+		// Stop before the multipliers overflow
+		if total > graphqlMaxCost {
+			return total
+		}
+	}
+	return total
+}
+
+// listSize returns the number of items assumed for the field
+func (c *gqlCoster) listSize(f *ast.Field) int {
+	size, ok := graphqlListSizes[f.Name]
+	if !ok {
+		return 1
+	}
+	limit := graphqlMaxPageSize
+	if f.Name == "relatedAssets" {
+		limit = graphqlMaxRelated
+	}
+	if arg := f.Arguments.ForName("first"); arg != nil {
+		switch n, _ := arg.Value.Value(c.variables); n := n.(type) {
+		case int64:
+			size = int(min(n, int64(limit)))
+		case float64:
+			size = int(min(n, float64(limit)))
+		}
+	}
+	return max(1, min(size, limit))
+}
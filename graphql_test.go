@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type graphqlResult struct {
+	Data   map[string]json.RawMessage
+	Errors []struct{ Message string }
+}
+
+func doGraphQL(t *testing.T, token, query string, variables map[string]interface{}) (int, graphqlResult) {
+	t.Helper()
+	w := doRequest(t, handleGraphQL, token, http.MethodPost, "/graphql", map[string]interface{}{"query": query, "variables": variables})
+	var res graphqlResult
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return w.Code, res
+}
+
+func TestGraphQL_QueryInterfaceAndPages(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Sales", Data: []float64{1, 2}, Favorite: true, Position: 1}
+	audience := &Audience{ID: uuid.New(), Tags: []string{"uk"}, Position: 2}
+	insight := &Insight{ID: uuid.New(), Text: "Up", RelatedAssets: []uuid.UUID{chart.ID}, Favorite: true, Position: 3}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart, audience, insight}})
+	token, _ := GenerateJWT(userID)
+
+	code, res := doGraphQL(t, token, `query Page($after: String) {
+		favourites(first: 1, after: $after) {
+			totalCount
+			pageInfo { endCursor hasNextPage }
+			nodes {
+				id
+				... on Chart { title data }
+				...related
+			}
+		}
+	}
+	fragment related on Insight { relatedAssets { id type } }`, map[string]interface{}{"after": "1"})
+	if code != http.StatusOK || len(res.Errors) != 0 {
+		t.Fatalf("unexpected response %d %+v", code, res.Errors)
+	}
+	var page struct {
+		TotalCount int
+		PageInfo   struct {
+			EndCursor   *string
+			HasNextPage bool
+		}
+		Nodes []struct {
+			ID            string
+			RelatedAssets []struct{ ID, Type string }
+		}
+	}
+	json.Unmarshal(res.Data["favourites"], &page)
+	if page.TotalCount != 2 || page.PageInfo.HasNextPage || len(page.Nodes) != 1 || page.Nodes[0].ID != insight.ID.String() {
+		t.Fatalf("unexpected page %+v", page)
+	}
+	if related := page.Nodes[0].RelatedAssets; len(related) != 1 || related[0].Type != ChartType {
+		t.Errorf("expected the related chart, got %+v", related)
+	}
+
+	_, res = doGraphQL(t, token, `{ assets(filter: {tag: "UK"}) { nodes { type } } }`, nil)
+	if !strings.Contains(string(res.Data["assets"]), `"audience"`) || strings.Contains(string(res.Data["assets"]), `"chart"`) {
+		t.Errorf("expected only the tagged audience, got %s", res.Data["assets"])
+	}
+}
+
+func TestGraphQL_Mutations(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+
+	_, res := doGraphQL(t, token, `mutation($input: AssetInput!) { addAsset(input: $input) { id ... on Audience { rules } } }`,
+		map[string]interface{}{"input": map[string]interface{}{"favorite": true, "audience": map[string]string{"rules": `age >= 18`}}})
+	var added struct{ ID, Rules string }
+	json.Unmarshal(res.Data["addAsset"], &added)
+	if len(res.Errors) != 0 || added.Rules != "age >= 18" {
+		t.Fatalf("unexpected add %+v %+v", added, res.Errors)
+	}
+	_, res = doGraphQL(t, token, `mutation($id: ID!) {
+		editAsset(id: $id, description: "Adults") { description }
+		toggleFavourite(id: $id, favorite: false) { favorite }
+	}`, map[string]interface{}{"id": added.ID})
+	if len(res.Errors) != 0 {
+		t.Fatalf("unexpected errors %+v", res.Errors)
+	}
+	asset := store.GetUser(userID).Favourites[0]
+	if asset.GetDescription() != "Adults" || asset.IsFavorite() {
+		t.Errorf("expected the asset edited and unfavourited, got %+v", asset)
+	}
+	_, res = doGraphQL(t, token, `mutation($id: ID!) { deleteAsset(id: $id) }`, map[string]interface{}{"id": added.ID})
+	if len(res.Errors) != 0 || len(store.GetUser(userID).Trash) != 1 {
+		t.Errorf("expected the asset trashed, got %+v", res.Errors)
+	}
+	_, res = doGraphQL(t, token, `mutation { addAsset(input: {chart: {title: "A"}, audience: {}}) { id } }`, nil)
+	if len(res.Errors) != 1 {
+		t.Errorf("expected an error for an input of two kinds, got %+v", res)
+	}
+
+	// Mutations are not accepted over GET
+	req := httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(`mutation { deleteAsset(id: "x") }`), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	AuthMiddleware(handleGraphQL)(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestGraphQL_ComplexityLimit(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+
+	query := `{ assets(first: 100) { nodes { ... on Insight { relatedAssets { id ... on Insight { relatedAssets { id } } } } } } }`
+	code, res := doGraphQL(t, token, query, nil)
+	if code != http.StatusBadRequest || len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, "too complex") {
+		t.Errorf("expected the query rejected as too complex, got %d %+v", code, res.Errors)
+	}
+	code, _ = doGraphQL(t, token, `query($n: Int) { assets(first: $n) { nodes { ... on Insight { relatedAssets { id } } } } }`, map[string]interface{}{"n": 5})
+	if code != http.StatusOK {
+		t.Errorf("expected a small page accepted, got %d", code)
+	}
+}
+
+func TestGraphQL_RelatedAssetsCapped(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	insight := &Insight{ID: uuid.New(), Text: "Up"}
+	assets := []Asset{insight}
+	for i := 0; i < graphqlMaxRelated+5; i++ {
+		chart := &Chart{ID: uuid.New(), Title: "Sales"}
+		insight.RelatedAssets = append(insight.RelatedAssets, chart.ID)
+		assets = append(assets, chart)
+	}
+	store.AddUser(&User{ID: userID, Favourites: assets})
+	token, _ := GenerateJWT(userID)
+
+	for query, want := range map[string]int{
+		`query($id: ID!) { asset(id: $id) { ... on Insight { relatedAssets { id } } } }`:             graphqlMaxRelated,
+		`query($id: ID!) { asset(id: $id) { ... on Insight { relatedAssets(first: 100) { id } } } }`: graphqlMaxRelated,
+		`query($id: ID!) { asset(id: $id) { ... on Insight { relatedAssets(first: 3) { id } } } }`:   3,
+	} {
+		code, res := doGraphQL(t, token, query, map[string]interface{}{"id": insight.ID.String()})
+		var asset struct{ RelatedAssets []struct{ ID string } }
+		json.Unmarshal(res.Data["asset"], &asset)
+		if code != http.StatusOK || len(asset.RelatedAssets) != want {
+			t.Errorf("%s: expected %d related assets, got %d %+v", query, want, len(asset.RelatedAssets), res.Errors)
+		}
+	}
+}
+
+func TestGraphQLCost(t *testing.T) {
+	cases := []struct {
+		query string
+		kind  string
+		cost  int
+	}{
+		{`{ asset(id: "1") { id type } }`, "query", 3},
+		{`query { assets(first: 2) { totalCount nodes { id } } }`, "query", 1 + 2 + 2 + 2},
+		{`{ ...f } fragment f on Query { favourites { totalCount } }`, "query", 1 + 50},
+		{`mutation M { toggleFavourite(id: "1", favorite: true) { id } }`, "mutation", 2},
+		{`# comment
+		{ a: asset(id: "1") @include(if: true) { id, b: type } }`, "query", 3},
+		// Variables without a value take their defaults
+		{`query($n: Int = 80) { assets(first: $n) { nodes { id } } }`, "query", 1 + 80 + 80},
+		{`{ asset(id: "1") { ... on Insight { relatedAssets(first: 500) { id } } } }`, "query", 1 + 1 + graphqlMaxRelated},
+	}
+	for _, c := range cases {
+		kind, cost, err := graphqlCost(c.query, "", nil)
+		if err != nil || kind != c.kind || cost != c.cost {
+			t.Errorf("graphqlCost(%q) = %s, %d, %v, want %s, %d", c.query, kind, cost, err, c.kind, c.cost)
+		}
+	}
+	for _, query := range []string{``, `{ asset(id: "1") { id }`, `query A { id } query B { id }`, `{ ... { id } `} {
+		if _, _, err := graphqlCost(query, "", nil); err == nil {
+			t.Errorf("expected an error for %q", query)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"platform-go-challenge/favouritespb"
+)
+
+const (
+	grpcDefaultPageSize = 50
+	grpcMaxPageSize     = 500
+)
+
+// grpcServer implements the Favourites gRPC service over the same store and
+// helpers as the HTTP handlers
+type grpcServer struct {
+	favouritespb.UnimplementedFavouritesServer
+}
+
+// newGRPCServer returns a server for the Favourites service authenticating
+// every call with its JWT or client certificate, over TLS unless tlsConfig
+// is nil
+func newGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(grpcAuthUnary), grpc.StreamInterceptor(grpcAuthStream)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	s := grpc.NewServer(opts...)
+	favouritespb.RegisterFavouritesServer(s, &grpcServer{})
+	return s
+}
+
+// grpcAuthenticate reads the "authorization: Bearer <token>" metadata, or
+// the client certificate without it, and adds the identity to the context,
+// as AuthMiddleware does for HTTP
+func grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if p, ok := peer.FromContext(ctx); ok && len(values) == 0 {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			userID, tenantID, err := identityFromCertificate(&info.State)
+			if err != nil {
+				return nil, status.Error(codes.Unauthenticated, "unknown client certificate")
+			}
+			ctx = contextWithUserID(ctx, userID)
+			return context.WithValue(ctx, tenantIDKey, tenantID), nil
+		}
+	}
+	if len(values) != 1 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	userID, tenantID, err := parseUserToken(strings.TrimPrefix(values[0], "Bearer "))
+	if err != nil || userID == uuid.Nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	ctx = contextWithUserID(ctx, userID)
+	return context.WithValue(ctx, tenantIDKey, tenantID), nil
+}
+
+func grpcAuthUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAuthenticate(ctx)
+	if err != nil {
+		log.Printf("grpcAuthUnary: rejected %s: %v", info.FullMethod, err)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcAuthStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthenticate(ss.Context())
+	if err != nil {
+		log.Printf("grpcAuthStream: rejected %s: %v", info.FullMethod, err)
+		return err
+	}
+	return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authedStream carries the authenticated context into a streaming call
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context { return s.ctx }
+
+// grpcUser returns the caller, like requireUser
+func grpcUser(ctx context.Context) (*User, error) {
+	user := userFromContext(ctx)
+	if user == nil {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return user, nil
+}
+
+// grpcMutate runs a mutation of the caller and returns once it is in the
+// write-ahead log, like serveMutation
+func grpcMutate(ctx context.Context, fn func(user *User) error) error {
+	user, err := grpcUser(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(user)
+	store.writeMu.Lock()
+	defer store.writeMu.Unlock()
+	if commitErr := store.commit(); commitErr != nil {
+		log.Printf("grpcMutate: cannot log change: %v", commitErr)
+		return status.Error(codes.Internal, "could not persist the change")
+	}
+	return err
+}
+
+func grpcAssetID(id string) (uuid.UUID, error) {
+	assetID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid asset_id")
+	}
+	return assetID, nil
+}
+
+// grpcAccessError maps a resolveAsset error to a status
+func grpcAccessError(err error) error {
+	if errors.Is(err, errForbidden) {
+		return status.Error(codes.PermissionDenied, "insufficient permission on asset")
+	}
+	return status.Error(codes.NotFound, "asset not found")
+}
+
+// grpcFavourites lists the user's favourite assets in display order, filtered
+// like GET /favourites
+func grpcFavourites(user *User, collectionID, tag string) ([]Asset, error) {
+	var collection *Collection
+	if collectionID != "" {
+		id, err := uuid.Parse(collectionID)
+		if err == nil {
+			collection = findCollection(user, id)
+		}
+		if collection == nil {
+			return nil, status.Error(codes.NotFound, "collection not found")
+		}
+	}
+	favs := make([]Asset, 0)
+	for _, asset := range sortedFavourites(user) {
+		if !asset.IsFavorite() || (collection != nil && !collection.hasAsset(asset.GetID())) || (tag != "" && !hasTag(asset, tag)) {
+			continue
+		}
+		favs = append(favs, asset)
+	}
+	return favs, nil
+}
+
+func (s *grpcServer) ListFavourites(ctx context.Context, req *favouritespb.ListFavouritesRequest) (*favouritespb.ListFavouritesResponse, error) {
+	user, err := grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	favs, err := grpcFavourites(user, req.CollectionId, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+	size := int(req.PageSize)
+	switch {
+	case size < 0:
+		return nil, status.Error(codes.InvalidArgument, "page_size cannot be negative")
+	case size == 0:
+		size = grpcDefaultPageSize
+	case size > grpcMaxPageSize:
+		size = grpcMaxPageSize
+	}
+	// the page token is the offset of the page
+	start := 0
+	if req.PageToken != "" {
+		if start, err = strconv.Atoi(req.PageToken); err != nil || start < 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+	}
+	start = min(start, len(favs))
+	end := min(start+size, len(favs))
+	resp := &favouritespb.ListFavouritesResponse{Assets: make([]*favouritespb.Asset, 0, end-start)}
+	for _, asset := range favs[start:end] {
+		resp.Assets = append(resp.Assets, assetToProto(asset))
+	}
+	if end < len(favs) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+	log.Printf("ListFavourites: returning %d assets for user %s", len(resp.Assets), user.ID)
+	return resp, nil
+}
+
+func (s *grpcServer) StreamFavourites(req *favouritespb.StreamFavouritesRequest, stream favouritespb.Favourites_StreamFavouritesServer) error {
+	user, err := grpcUser(stream.Context())
+	if err != nil {
+		return err
+	}
+	favs, err := grpcFavourites(user, req.CollectionId, req.Tag)
+	if err != nil {
+		return err
+	}
+	for _, asset := range favs {
+		if err := stream.Send(assetToProto(asset)); err != nil {
+			return err
+		}
+	}
+	log.Printf("StreamFavourites: streamed %d assets for user %s", len(favs), user.ID)
+	return nil
+}
+
+func (s *grpcServer) GetFavourite(ctx context.Context, req *favouritespb.GetFavouriteRequest) (*favouritespb.Asset, error) {
+	user, err := grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	assetID, err := grpcAssetID(req.AssetId)
+	if err != nil {
+		return nil, err
+	}
+	_, asset, err := resolveAsset(user, assetID, PermRead)
+	if err != nil {
+		return nil, grpcAccessError(err)
+	}
+	return assetToProto(asset), nil
+}
+
+func (s *grpcServer) AddFavourite(ctx context.Context, req *favouritespb.AddFavouriteRequest) (*favouritespb.Asset, error) {
+	typ, raw, err := assetFromProto(req.Asset)
+	if err != nil {
+		return nil, err
+	}
+	var added Asset
+	err = grpcMutate(ctx, func(user *User) error {
+		asset, err := decodeAsset(typ, raw, store.FavouritesOf(user))
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid %s asset: %v", typ, err)
+		}
+		if err := store.AddAsset(user, asset); err != nil {
+			return status.Error(codes.AlreadyExists, "an asset with the same ID is in favourites")
+		}
+		recordRevision(user, asset, user.ID, "create")
+		notify(user, EventCreated, asset)
+		log.Printf("AddFavourite: asset added for user %s, type %s, id %s", user.ID, typ, asset.GetID())
+		added = asset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return assetToProto(added), nil
+}
+
+func (s *grpcServer) UpdateFavourite(ctx context.Context, req *favouritespb.UpdateFavouriteRequest) (*favouritespb.Asset, error) {
+	typ, raw, err := assetFromProto(req.Asset)
+	if err != nil {
+		return nil, err
+	}
+	assetID, err := grpcAssetID(req.Asset.Id)
+	if err != nil {
+		return nil, err
+	}
+	var updated Asset
+	err = grpcMutate(ctx, func(user *User) error {
+		owner, _, err := resolveAsset(user, assetID, PermEdit)
+		if err != nil {
+			return grpcAccessError(err)
+		}
+		asset, err := store.UpdateAsset(owner, assetID, func(current Asset, favourites []Asset) (Asset, error) {
+			if typ != current.GetType() {
+				return nil, status.Errorf(codes.InvalidArgument, "asset is a %s, not a %s", current.GetType(), typ)
+			}
+			asset, err := decodeAsset(typ, raw, favourites)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s asset: %v", typ, err)
+			}
+			return asset, nil
+		})
+		if errors.Is(err, errAssetNotFound) {
+			return status.Error(codes.NotFound, "asset not found")
+		}
+		if err != nil {
+			return err
+		}
+		recordRevision(owner, asset, user.ID, "put")
+		notify(owner, EventUpdated, asset)
+		log.Printf("UpdateFavourite: asset %s updated by user %s", assetID, user.ID)
+		updated = asset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return assetToProto(updated), nil
+}
+
+func (s *grpcServer) ToggleFavourite(ctx context.Context, req *favouritespb.ToggleFavouriteRequest) (*favouritespb.Asset, error) {
+	assetID, err := grpcAssetID(req.AssetId)
+	if err != nil {
+		return nil, err
+	}
+	var toggled *favouritespb.Asset
+	err = grpcMutate(ctx, func(user *User) error {
+		owner, asset, err := editAsset(user, assetID, func(a Asset) { a.SetFavorite(req.Favorite) })
+		if err != nil {
+			return grpcAccessError(err)
+		}
+		recordRevision(owner, asset, user.ID, "favorite")
+		change := ChangeUnfavorited
+		if req.Favorite {
+			change = ChangeFavorited
+		}
+		notifyChange(owner, EventUpdated, change, asset)
+		log.Printf("ToggleFavourite: favorite of asset %s set to %v", assetID, req.Favorite)
+		toggled = assetToProto(asset)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toggled, nil
+}
+
+func (s *grpcServer) DeleteFavourite(ctx context.Context, req *favouritespb.DeleteFavouriteRequest) (*favouritespb.DeleteFavouriteResponse, error) {
+	assetID, err := grpcAssetID(req.AssetId)
+	if err != nil {
+		return nil, err
+	}
+	err = grpcMutate(ctx, func(user *User) error {
+		asset := findAsset(user, assetID)
+		if asset == nil || !store.TrashAsset(user, assetID, time.Now().UTC()) {
+			return status.Error(codes.NotFound, "asset not found in favourites")
+		}
+		notify(user, EventDeleted, asset)
+		log.Printf("DeleteFavourite: asset %s moved to trash for user %s", assetID, user.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &favouritespb.DeleteFavouriteResponse{}, nil
+}
+
+// assetToProto converts an asset into its protobuf message
+func assetToProto(asset Asset) *favouritespb.Asset {
+	pb := &favouritespb.Asset{
+		Id:          asset.GetID().String(),
+		Type:        asset.GetType(),
+		Description: asset.GetDescription(),
+		Favorite:    asset.IsFavorite(),
+		Tags:        asset.GetTags(),
+		Position:    asset.GetPosition(),
+		Pinned:      asset.IsPinned(),
+	}
+	switch a := asset.(type) {
+	case *Chart:
+		pb.Kind = &favouritespb.Asset_Chart{Chart: &favouritespb.Chart{Title: a.Title, XAxisTitle: a.XAxisTitle, YAxisTitle: a.YAxisTitle, Data: a.Data}}
+	case *Insight:
+		insight := &favouritespb.Insight{Text: a.Text}
+		for _, source := range a.Sources {
+			insight.Sources = append(insight.Sources, &favouritespb.Source{Title: source.Title, Url: source.URL})
+		}
+		for _, id := range a.RelatedAssets {
+			insight.RelatedAssets = append(insight.RelatedAssets, id.String())
+		}
+		pb.Kind = &favouritespb.Asset_Insight{Insight: insight}
+	case *Audience:
+		audience := &favouritespb.Audience{}
+		if a.Rules != nil {
+			audience.Rules = a.Rules.String()
+		}
+		pb.Kind = &favouritespb.Asset_Audience{Audience: audience}
+	}
+	return pb
+}
+
+// assetFromProto returns the type and JSON of an asset message, for
+// decodeAsset to validate like the body of POST /favourites/add
+func assetFromProto(pb *favouritespb.Asset) (string, json.RawMessage, error) {
+	if pb == nil {
+		return "", nil, status.Error(codes.InvalidArgument, "asset is required")
+	}
+	fields := map[string]interface{}{"Description": pb.Description, "Favorite": pb.Favorite, "Tags": pb.Tags}
+	if pb.Id != "" {
+		fields["ID"] = pb.Id
+	}
+	var typ string
+	switch kind := pb.Kind.(type) {
+	case *favouritespb.Asset_Chart:
+		typ = ChartType
+		fields["Title"], fields["XAxisTitle"], fields["YAxisTitle"], fields["Data"] = kind.Chart.GetTitle(), kind.Chart.GetXAxisTitle(), kind.Chart.GetYAxisTitle(), kind.Chart.GetData()
+	case *favouritespb.Asset_Insight:
+		typ = InsightType
+		sources := make([]Source, 0, len(kind.Insight.GetSources()))
+		for _, source := range kind.Insight.GetSources() {
+			sources = append(sources, Source{Title: source.Title, URL: source.Url})
+		}
+		fields["Text"], fields["Sources"], fields["RelatedAssets"] = kind.Insight.GetText(), sources, kind.Insight.GetRelatedAssets()
+	case *favouritespb.Asset_Audience:
+		typ = AudienceType
+		if rules := kind.Audience.GetRules(); rules != "" {
+			fields["Rules"] = rules
+		}
+	default:
+		return "", nil, status.Error(codes.InvalidArgument, "asset needs a chart, insight or audience")
+	}
+	if pb.Type != "" && pb.Type != typ {
+		return "", nil, status.Errorf(codes.InvalidArgument, "type %s does not match a %s", pb.Type, typ)
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return "", nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return typ, raw, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"platform-go-challenge/favouritespb"
+)
+
+// dialGRPC serves the gRPC API in memory and returns a client for it
+func dialGRPC(t *testing.T) favouritespb.FavouritesClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := newGRPCServer(nil)
+	go server.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+	return favouritespb.NewFavouritesClient(conn)
+}
+
+func grpcContext(t *testing.T, userID uuid.UUID) context.Context {
+	t.Helper()
+	token, _ := GenerateJWT(userID)
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPC_RejectsMissingToken(t *testing.T) {
+	resetStore()
+	client := dialGRPC(t)
+	_, err := client.ListFavourites(context.Background(), &favouritespb.ListFavouritesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	stream, _ := client.StreamFavourites(context.Background(), &favouritespb.StreamFavouritesRequest{})
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated on the stream, got %v", err)
+	}
+}
+
+func TestGRPC_AddToggleDelete(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	client := dialGRPC(t)
+	ctx := grpcContext(t, userID)
+
+	added, err := client.AddFavourite(ctx, &favouritespb.AddFavouriteRequest{Asset: &favouritespb.Asset{
+		Description: "Target group",
+		Favorite:    true,
+		Kind:        &favouritespb.Asset_Audience{Audience: &favouritespb.Audience{Rules: `age BETWEEN 18 AND 24`}},
+	}})
+	if err != nil {
+		t.Fatalf("adding: %v", err)
+	}
+	if added.Type != AudienceType || added.GetAudience().GetRules() == "" {
+		t.Errorf("unexpected asset %+v", added)
+	}
+	if _, err := client.AddFavourite(ctx, &favouritespb.AddFavouriteRequest{Asset: added}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists, got %v", err)
+	}
+
+	toggled, err := client.ToggleFavourite(ctx, &favouritespb.ToggleFavouriteRequest{AssetId: added.Id, Favorite: false})
+	if err != nil || toggled.Favorite {
+		t.Fatalf("toggling: %v %+v", err, toggled)
+	}
+	resp, _ := client.ListFavourites(ctx, &favouritespb.ListFavouritesRequest{})
+	if len(resp.Assets) != 0 {
+		t.Errorf("expected no favourites after toggling off, got %d", len(resp.Assets))
+	}
+
+	if _, err := client.DeleteFavourite(ctx, &favouritespb.DeleteFavouriteRequest{AssetId: added.Id}); err != nil {
+		t.Fatalf("deleting: %v", err)
+	}
+	if _, err := client.GetFavourite(ctx, &favouritespb.GetFavouriteRequest{AssetId: added.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound after deleting, got %v", err)
+	}
+	if len(store.GetUser(userID).Trash) != 1 {
+		t.Error("expected the asset in the trash")
+	}
+}
+
+func TestGRPC_ListPagesAndStream(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	user := &User{ID: userID}
+	for i := 0; i < 5; i++ {
+		user.Favourites = append(user.Favourites, &Chart{ID: uuid.New(), Title: "Sales", Favorite: true, Position: float64(i + 1)})
+	}
+	user.Favourites = append(user.Favourites, &Chart{ID: uuid.New(), Title: "Hidden", Position: 6})
+	store.AddUser(user)
+	client := dialGRPC(t)
+	ctx := grpcContext(t, userID)
+
+	var ids []string
+	req := &favouritespb.ListFavouritesRequest{PageSize: 2}
+	for pages := 0; ; pages++ {
+		resp, err := client.ListFavourites(ctx, req)
+		if err != nil {
+			t.Fatalf("listing: %v", err)
+		}
+		for _, asset := range resp.Assets {
+			ids = append(ids, asset.Id)
+		}
+		if resp.NextPageToken == "" {
+			if pages != 2 {
+				t.Errorf("expected 3 pages, got %d", pages+1)
+			}
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if len(ids) != 5 || ids[0] != user.Favourites[0].GetID().String() {
+		t.Errorf("unexpected listing %v", ids)
+	}
+
+	stream, err := client.StreamFavourites(ctx, &favouritespb.StreamFavouritesRequest{})
+	if err != nil {
+		t.Fatalf("streaming: %v", err)
+	}
+	streamed := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("receiving: %v", err)
+		}
+		streamed++
+	}
+	if streamed != 5 {
+		t.Errorf("expected 5 streamed favourites, got %d", streamed)
+	}
+}
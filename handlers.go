@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -33,14 +36,92 @@ func parseAssetID(r *http.Request, w http.ResponseWriter) (uuid.UUID, bool) {
 	return assetID, true
 }
 
-func setupRoutes() {
-	http.HandleFunc("/token", TokenHandler)
-	http.HandleFunc("/favourites", AuthMiddleware(handleFavourites))
-	http.HandleFunc("/favourites/add", AuthMiddleware(handleAddFavourite))
-	http.HandleFunc("/favourites/remove", AuthMiddleware(handleRemoveFavourite))
-	http.HandleFunc("/favourites/edit", AuthMiddleware(handleEditFavourite))
-	http.HandleFunc("/favourites/delete", AuthMiddleware(handleDeleteFavourite))
+func setupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/token", TokenHandler)
+	mux.HandleFunc("/openapi.json", handleOpenAPI)
+	mux.HandleFunc("/favourites", AuthMiddleware(handleFavourites))
+	mux.HandleFunc("/favourites/add", AuthMiddleware(handleAddFavourite))
+	mux.HandleFunc("/favourites/remove", AuthMiddleware(handleRemoveFavourite))
+	mux.HandleFunc("/favourites/edit", AuthMiddleware(handleEditFavourite))
+	mux.HandleFunc("/favourites/delete", AuthMiddleware(handleDeleteFavourite))
+	mux.HandleFunc("/favourites/export", AuthMiddleware(handleExportFavourites))
+	mux.HandleFunc("/favourites/events", AuthMiddleware(handleFavouriteEvents))
+	mux.HandleFunc("/favourites/import", AuthMiddleware(handleImportFavourites))
+	mux.HandleFunc("/favourites/", AuthMiddleware(handleFavouriteByID))
+	mux.HandleFunc("/collections", AuthMiddleware(handleCollections))
+	mux.HandleFunc("/collections/", AuthMiddleware(handleCollectionByID))
+	mux.HandleFunc("/tags", AuthMiddleware(handleTags))
+	mux.HandleFunc("/shares", AuthMiddleware(handleShares))
+	mux.HandleFunc("/shares/with-me", AuthMiddleware(handleSharedWithMe))
+	mux.HandleFunc("/shares/", AuthMiddleware(handleShareByID))
+	mux.HandleFunc("/links/", AuthMiddleware(handleLinkByID))
+	mux.HandleFunc("/shared/", handleSharedLink)
+	mux.HandleFunc("/trash", AuthMiddleware(handleTrash))
+	mux.HandleFunc("/trash/restore", AuthMiddleware(handleTrashRestore))
+	mux.HandleFunc("/graphql", AuthMiddleware(handleGraphQL))
+	mux.HandleFunc("/ws", wsTokenFromQuery(AuthMiddleware(handleWebSocket)))
+	mux.HandleFunc("/webhooks", AuthMiddleware(handleWebhooks))
+	mux.HandleFunc("/webhooks/", AuthMiddleware(handleWebhookByID))
+	mux.HandleFunc("/admin/snapshot", AdminMiddleware(handleAdminSnapshot))
+	mux.HandleFunc("/admin/webhooks", AdminMiddleware(handleAdminWebhooks))
+	mux.HandleFunc("/admin/webhooks/", AdminMiddleware(handleAdminWebhookByID))
+	mux.HandleFunc("/orgs", AuthMiddleware(handleOrgs))
+	mux.HandleFunc("/orgs/members", AuthMiddleware(handleOrgMembers))
+	mux.HandleFunc("/orgs/invitations", AuthMiddleware(handleOrgInvitations))
+	mux.HandleFunc("/orgs/invitations/", AuthMiddleware(handleOrgInvitations))
+	mux.HandleFunc("/teams", AuthMiddleware(handleTeams))
+	mux.HandleFunc("/teams/", AuthMiddleware(handleTeamByID))
+}
 
+// parseFavouritePath splits /favourites/{id}/{action} into the asset ID and action
+func parseFavouritePath(r *http.Request, w http.ResponseWriter) (uuid.UUID, string, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/favourites/"), "/"), "/")
+	assetID, err := uuid.Parse(parts[0])
+	if err != nil || len(parts) > 2 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return uuid.UUID{}, "", false
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	return assetID, action, true
+}
+
+// Routes requests addressed to a single asset, /favourites/{id}/...
+func handleFavouriteByID(w http.ResponseWriter, r *http.Request) {
+	assetID, action, ok := parseFavouritePath(r, w)
+	if !ok {
+		log.Printf("handleFavouriteByID: unknown path %s", r.URL.Path)
+		return
+	}
+	switch action {
+	case "":
+		if r.Method == http.MethodPut || r.Method == http.MethodPatch {
+			handleUpdateFavourite(w, r, assetID)
+			return
+		}
+		handleGetFavourite(w, r, assetID)
+	case "size":
+		handleAudienceSize(w, r, assetID)
+	case "tags":
+		handleAssetTags(w, r, assetID)
+	case "move":
+		handleMoveFavourite(w, r, assetID)
+	case "pin":
+		handlePinFavourite(w, r, assetID)
+	case "links":
+		handleAssetLinks(w, r, assetID)
+	case "history":
+		handleAssetHistory(w, r, assetID)
+	case "diff":
+		handleAssetDiff(w, r, assetID)
+	case "rollback":
+		handleAssetRollback(w, r, assetID)
+	default:
+		log.Printf("handleFavouriteByID: unknown action %q", action)
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
 }
 
 // List all the assets of the user with Favorite == true
@@ -51,18 +132,39 @@ func handleFavourites(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	user := store.GetUser(userID)
+	user := store.GetTenantUser(getTenantIDFromContext(r), userID)
 	if user == nil {
 		log.Printf("handleFavourites: user not found %s", userID)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
-	// Only return assets with Favorite == true
+	// Optional filters: assets of a collection and/or carrying a tag
+	var collection *Collection
+	if c := r.URL.Query().Get("collection"); c != "" {
+		collectionID, err := uuid.Parse(c)
+		if err == nil {
+			collection = findCollection(user, collectionID)
+		}
+		if collection == nil {
+			log.Printf("handleFavourites: collection not found %s", c)
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+	}
+	tag := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+	// Only return assets with Favorite == true, pinned first then in user-defined order
 	favs := make([]Asset, 0)
-	for _, asset := range user.Favourites {
-		if asset.IsFavorite() {
-			favs = append(favs, asset)
+	for _, asset := range sortedFavourites(user) {
+		if !asset.IsFavorite() {
+			continue
+		}
+		if collection != nil && !collection.hasAsset(asset.GetID()) {
+			continue
+		}
+		if tag != "" && !hasTag(asset, tag) {
+			continue
 		}
+		favs = append(favs, asset)
 	}
 	log.Printf("handleFavourites: returning %d assets for user %s", len(favs), userID)
 	// Pagination: limit and offset query params
@@ -87,6 +189,11 @@ func handleFavourites(w http.ResponseWriter, r *http.Request) {
 		end = start + limit
 	}
 	paged := favs[start:end]
+	// embed=related inlines the assets insights link to instead of their IDs
+	if r.URL.Query().Get("embed") == "related" {
+		json.NewEncoder(w).Encode(embedRelated(user, paged))
+		return
+	}
 	json.NewEncoder(w).Encode(paged)
 }
 
@@ -99,7 +206,7 @@ func handleAddFavourite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	user := store.GetUser(userID)
+	user := store.GetTenantUser(getTenantIDFromContext(r), userID)
 	if user == nil {
 		log.Printf("handleAddFavourite: user not found %s", userID)
 		http.Error(w, "User not found", http.StatusNotFound)
@@ -115,54 +222,27 @@ func handleAddFavourite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	var asset Asset
-	switch req.Type {
-	case ChartType:
-		log.Printf("Adding Chart asset: %s\n", req.Asset)
-		var c Chart
-		if err := json.Unmarshal(req.Asset, &c); err != nil {
-			log.Printf("handleAddFavourite: invalid chart asset: %v", err)
-			http.Error(w, "Invalid chart asset", http.StatusBadRequest)
-			return
-		}
-		if c.ID == uuid.Nil {
-			c.ID = uuid.New()
-		}
-		c.Favorite = req.Favorite
-		asset = &c
-	case InsightType:
-		log.Printf("Adding Insight asset: %s\n", req.Asset)
-		var i Insight
-		if err := json.Unmarshal(req.Asset, &i); err != nil {
-			log.Printf("handleAddFavourite: invalid insight asset: %v", err)
-			http.Error(w, "Invalid insight asset", http.StatusBadRequest)
-			return
-		}
-		if i.ID == uuid.Nil {
-			i.ID = uuid.New()
-		}
-		i.Favorite = req.Favorite
-		asset = &i
-	case AudienceType:
-		log.Printf("Adding Audience asset: %s\n", req.Asset)
-		var a Audience
-		if err := json.Unmarshal(req.Asset, &a); err != nil {
-			log.Printf("handleAddFavourite: invalid audience asset: %v", err)
-			http.Error(w, "Invalid audience asset", http.StatusBadRequest)
-			return
-		}
-		if a.ID == uuid.Nil {
-			a.ID = uuid.New()
-		}
-		a.Favorite = req.Favorite
-		asset = &a
-	default:
+	log.Printf("Adding %s asset: %s\n", req.Type, req.Asset)
+	asset, err := decodeAsset(req.Type, req.Asset, store.FavouritesOf(user))
+	if errors.Is(err, errUnknownAssetType) {
 		log.Printf("handleAddFavourite: unknown asset type %s", req.Type)
 		http.Error(w, "Unknown asset type", http.StatusBadRequest)
 		return
 	}
+	if err != nil {
+		log.Printf("handleAddFavourite: invalid %s asset: %v", req.Type, err)
+		http.Error(w, "Invalid "+req.Type+" asset: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	asset.SetFavorite(req.Favorite)
+	if err := store.AddAsset(user, asset); err != nil {
+		log.Printf("handleAddFavourite: duplicate asset %s", asset.GetID())
+		http.Error(w, "An asset with the same ID is in favourites", http.StatusConflict)
+		return
+	}
 	log.Printf("handleAddFavourite: asset added for user %s, type %s, id %s", userID, req.Type, asset.GetID())
-	user.Favourites = append(user.Favourites, asset)
+	recordRevision(user, asset, userID, "create")
+	notify(user, EventCreated, asset)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(asset)
 }
@@ -185,7 +265,7 @@ func handleRemoveFavourite(w http.ResponseWriter, r *http.Request) {
 		log.Printf("handleRemoveFavourite: invalid asset_id")
 		return
 	}
-	user := store.GetUser(userID)
+	user := store.GetTenantUser(getTenantIDFromContext(r), userID)
 	if user == nil {
 		log.Printf("handleRemoveFavourite: user not found %s", userID)
 		http.Error(w, "User not found", http.StatusNotFound)
@@ -199,17 +279,20 @@ func handleRemoveFavourite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	for _, fav := range user.Favourites {
-		if fav.GetID() == assetID {
-			log.Printf("handleRemoveFavourite: updating favorite for asset %s to %v", assetID, req.Favorite)
-			fav.SetFavorite(req.Favorite)
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(fav)
-			return
-		}
+	owner, fav, err := editAsset(user, assetID, func(a Asset) { a.SetFavorite(req.Favorite) })
+	if err != nil {
+		writeAccessError(w, "handleRemoveFavourite", assetID, err)
+		return
 	}
-	log.Printf("handleRemoveFavourite: asset not found %s", assetID)
-	http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+	log.Printf("handleRemoveFavourite: updated favorite for asset %s to %v", assetID, req.Favorite)
+	recordRevision(owner, fav, userID, "favorite")
+	change := ChangeUnfavorited
+	if req.Favorite {
+		change = ChangeFavorited
+	}
+	notifyChange(owner, EventUpdated, change, fav)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(fav)
 }
 
 // Edits the description of an asset in general
@@ -230,7 +313,7 @@ func handleEditFavourite(w http.ResponseWriter, r *http.Request) {
 		log.Printf("handleEditFavourite: invalid asset_id")
 		return
 	}
-	user := store.GetUser(userID)
+	user := store.GetTenantUser(getTenantIDFromContext(r), userID)
 	if user == nil {
 		log.Printf("handleEditFavourite: user not found %s", userID)
 		http.Error(w, "User not found", http.StatusNotFound)
@@ -244,20 +327,20 @@ func handleEditFavourite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	for _, fav := range user.Favourites {
-		if fav.GetID() == assetID {
-			log.Printf("handleEditFavourite: updating description for asset %s to '%s'", assetID, req.Description)
-			fav.SetDescription(req.Description)
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(fav)
-			return
-		}
+	owner, fav, err := editAsset(user, assetID, func(a Asset) { a.SetDescription(req.Description) })
+	if err != nil {
+		writeAccessError(w, "handleEditFavourite", assetID, err)
+		return
 	}
-	log.Printf("handleEditFavourite: asset not found %s", assetID)
-	http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+	log.Printf("handleEditFavourite: updated description for asset %s to '%s'", assetID, req.Description)
+	recordRevision(owner, fav, userID, "description")
+	notify(owner, EventUpdated, fav)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(fav)
 }
 
-// Deletes an asset in general
+// Deletes an asset by moving it to the user's trash, from where it can be
+// restored until the retention period ends
 func handleDeleteFavourite(w http.ResponseWriter, r *http.Request) {
 	userID := getUserIDFromContext(r)
 	if userID == uuid.Nil {
@@ -270,29 +353,85 @@ func handleDeleteFavourite(w http.ResponseWriter, r *http.Request) {
 		log.Printf("handleDeleteFavourite: invalid asset_id")
 		return
 	}
-	user := store.GetUser(userID)
+	user := store.GetTenantUser(getTenantIDFromContext(r), userID)
 	if user == nil {
 		log.Printf("handleDeleteFavourite: user not found %s", userID)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
-	found := false
-	newFavs := make([]Asset, 0, len(user.Favourites))
-	for _, fav := range user.Favourites {
-		if fav.GetID() == assetID {
-			log.Printf("handleDeleteFavourite: deleting asset %s for user %s", assetID, userID)
-			found = true
-			continue
-		}
-		newFavs = append(newFavs, fav)
-	}
-	if !found {
+	asset := findAsset(user, assetID)
+	if asset == nil || !store.TrashAsset(user, assetID, time.Now().UTC()) {
 		log.Printf("handleDeleteFavourite: asset not found %s", assetID)
 		http.Error(w, "Asset not found in favourites", http.StatusNotFound)
 		return
 	}
-	user.Favourites = newFavs
-	log.Printf("handleDeleteFavourite: asset deleted, %d assets remain for user %s", len(user.Favourites), userID)
+	notify(user, EventDeleted, asset)
+	remaining := store.FavouritesOf(user)
+	log.Printf("handleDeleteFavourite: asset %s moved to trash, %d assets remain for user %s", assetID, len(remaining), userID)
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(user.Favourites)
+	json.NewEncoder(w).Encode(remaining)
+}
+
+// Sizes an audience against the respondent panel
+func handleAudienceSize(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleAudienceSize: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := getUserIDFromContext(r)
+	if userID == uuid.Nil {
+		log.Printf("handleAudienceSize: invalid user_id from token")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user := store.GetTenantUser(getTenantIDFromContext(r), userID)
+	if user == nil {
+		log.Printf("handleAudienceSize: user not found %s", userID)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if panel == nil {
+		log.Printf("handleAudienceSize: no respondent panel loaded")
+		http.Error(w, "No respondent panel loaded", http.StatusServiceUnavailable)
+		return
+	}
+	_, fav, err := resolveAsset(user, assetID, PermRead)
+	if err != nil {
+		writeAccessError(w, "handleAudienceSize", assetID, err)
+		return
+	}
+	audience, ok := fav.(*Audience)
+	if !ok {
+		log.Printf("handleAudienceSize: asset %s is a %s", assetID, fav.GetType())
+		http.Error(w, "Asset is not an audience", http.StatusBadRequest)
+		return
+	}
+	size := panel.Size(audience.Rules)
+	log.Printf("handleAudienceSize: audience %s matches %d of %d respondents", assetID, size.Respondents, size.TotalRespondents)
+	resp := struct {
+		AssetID uuid.UUID `json:"asset_id"`
+		AudienceSize
+	}{AssetID: assetID, AudienceSize: size}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Returns a single asset, owned by or shared with the user
+func handleGetFavourite(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleGetFavourite: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleGetFavourite")
+	if !ok {
+		return
+	}
+	_, fav, err := resolveAsset(user, assetID, PermRead)
+	if err != nil {
+		writeAccessError(w, "handleGetFavourite", assetID, err)
+		return
+	}
+	json.NewEncoder(w).Encode(fav)
 }
@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 
 	"bytes"
@@ -15,6 +17,14 @@ func resetStore() {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 	store.users = make(map[uuid.UUID]*User)
+	store.shares = make(map[uuid.UUID]*Share)
+	store.links = make(map[uuid.UUID]*ShareLink)
+	store.orgs = make(map[uuid.UUID]*Organisation)
+	store.teams = make(map[uuid.UUID]*Team)
+	store.webhooks = make(map[uuid.UUID]*Webhook)
+	store.deliveries = make(map[uuid.UUID]*Delivery)
+	store.wal, store.pending, store.dirtyUsers, store.dirtyTeams, store.events = nil, nil, nil, nil, nil
+	linkAttempts = newAttemptLimiter()
 }
 
 func TestHandleFavourites(t *testing.T) {
@@ -433,3 +443,44 @@ func TestHandleDeleteFavourite_DeleteAsset(t *testing.T) {
 		t.Errorf("expected remaining asset to be 'Insight4', got %v", respList2[0]["Text"])
 	}
 }
+
+func TestConcurrentReadsAndMutations(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Sales", Favorite: true}
+	audience := &Audience{ID: uuid.New(), Favorite: true}
+	collection := &Collection{ID: uuid.New(), Name: "Report", AssetIDs: []uuid.UUID{chart.ID}}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart, audience}, Collections: []*Collection{collection}})
+	token, _ := GenerateJWT(userID)
+
+	// Mutations no longer run one at a time, and reads take no lock for
+	// their whole duration: run both side by side under the race detector
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				doRequest(t, handleEditFavourite, token, http.MethodPut, "/favourites/edit?asset_id="+chart.ID.String(), map[string]string{"description": fmt.Sprint(i, j)})
+				doRequest(t, handleFavouriteByID, token, http.MethodPut, "/favourites/"+chart.ID.String()+"/pin", map[string]bool{"pinned": j%2 == 0})
+				doRequest(t, handleFavouriteByID, token, http.MethodPost, "/favourites/"+audience.ID.String()+"/move", map[string]uuid.UUID{"before": chart.ID})
+				doRequest(t, handleCollectionByID, token, http.MethodPost, "/collections/"+collection.ID.String()+"/assets?asset_id="+audience.ID.String(), nil)
+				doRequest(t, handleCollectionByID, token, http.MethodDelete, "/collections/"+collection.ID.String()+"/assets?asset_id="+audience.ID.String(), nil)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if w := doRequest(t, handleFavourites, token, http.MethodGet, "/favourites?collection="+collection.ID.String(), nil); w.Code != http.StatusOK {
+					t.Errorf("expected status %d listing, got %d", http.StatusOK, w.Code)
+				}
+				doRequest(t, handleCollectionByID, token, http.MethodGet, "/collections/"+collection.ID.String(), nil)
+				doRequest(t, handleTags, token, http.MethodGet, "/tags", nil)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := findAsset(store.GetUser(userID), chart.ID).GetDescription(); got == "" {
+		t.Errorf("expected a description from one of the edits")
+	}
+}
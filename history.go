@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxRevisions bounds the history kept per asset
+const maxRevisions = 100
+
+// Revision is a snapshot of an asset taken after a mutation. Ordering
+// (position and pin) is not versioned: moving or pinning records nothing.
+type Revision struct {
+	Number       int             `json:"revision"`
+	AuthorID     uuid.UUID       `json:"author_id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Action       string          `json:"action"`
+	RestoredFrom int             `json:"restored_from,omitempty"` // set by rollbacks
+	Asset        json.RawMessage `json:"asset"`
+}
+
+// FieldChange is the change of one asset field between two revisions; Old or
+// New is omitted when the field did not exist on that side
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old,omitempty"`
+	New   json.RawMessage `json:"new,omitempty"`
+}
+
+// unversionedFields are left out of diffs and kept as they are on rollback
+var unversionedFields = map[string]bool{"Position": true, "Pinned": true}
+
+// newRevision snapshots the asset, returning nil if it cannot be encoded
+func newRevision(asset Asset, author uuid.UUID, action string) *Revision {
+	snapshot, err := json.Marshal(asset)
+	if err != nil {
+		log.Printf("newRevision: cannot snapshot asset %s: %v", asset.GetID(), err)
+		return nil
+	}
+	return &Revision{AuthorID: author, CreatedAt: time.Now().UTC(), Action: action, Asset: snapshot}
+}
+
+// recordRevision snapshots the asset into its owner's history
+func recordRevision(owner *User, asset Asset, author uuid.UUID, action string) {
+	if rev := newRevision(asset, author, action); rev != nil {
+		store.AddRevision(owner, asset.GetID(), rev)
+	}
+}
+
+// findRevision returns the revision with the given number, or nil
+func findRevision(history []*Revision, number int) *Revision {
+	for _, rev := range history {
+		if rev.Number == number {
+			return rev
+		}
+	}
+	return nil
+}
+
+// diffRevisions compares two asset snapshots field by field, in field order
+func diffRevisions(from, to json.RawMessage) ([]FieldChange, error) {
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(from, &before); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &after); err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(before)+len(after))
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	changes := make([]FieldChange, 0)
+	for _, field := range fields {
+		if unversionedFields[field] || bytes.Equal(before[field], after[field]) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, Old: before[field], New: after[field]})
+	}
+	return changes, nil
+}
+
+// Lists the revisions of an asset, newest first, each with its changes
+// against the previous revision
+func handleAssetHistory(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleAssetHistory: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleAssetHistory")
+	if !ok {
+		return
+	}
+	owner, _, err := resolveAsset(user, assetID, PermRead)
+	if err != nil {
+		writeAccessError(w, "handleAssetHistory", assetID, err)
+		return
+	}
+	type revisionView struct {
+		*Revision
+		Changes []FieldChange `json:"changes"`
+	}
+	history := store.RevisionsOf(owner, assetID)
+	views := make([]revisionView, 0, len(history))
+	for n := len(history) - 1; n >= 0; n-- {
+		view := revisionView{Revision: history[n], Changes: []FieldChange{}}
+		if n > 0 {
+			if view.Changes, err = diffRevisions(history[n-1].Asset, history[n].Asset); err != nil {
+				log.Printf("handleAssetHistory: cannot diff revision %d: %v", history[n].Number, err)
+				http.Error(w, "Corrupt revision", http.StatusInternalServerError)
+				return
+			}
+		}
+		views = append(views, view)
+	}
+	log.Printf("handleAssetHistory: returning %d revisions of asset %s", len(views), assetID)
+	json.NewEncoder(w).Encode(views)
+}
+
+// Diffs two revisions of an asset: GET /favourites/{id}/diff?from=1&to=3.
+// Without to, the latest revision is used.
+func handleAssetDiff(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleAssetDiff: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleAssetDiff")
+	if !ok {
+		return
+	}
+	owner, _, err := resolveAsset(user, assetID, PermRead)
+	if err != nil {
+		writeAccessError(w, "handleAssetDiff", assetID, err)
+		return
+	}
+	history := store.RevisionsOf(owner, assetID)
+	if len(history) == 0 {
+		log.Printf("handleAssetDiff: asset %s has no history", assetID)
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	fromNum, err := strconv.Atoi(query.Get("from"))
+	if err != nil {
+		log.Printf("handleAssetDiff: invalid from %q", query.Get("from"))
+		http.Error(w, "Invalid from revision", http.StatusBadRequest)
+		return
+	}
+	toNum := history[len(history)-1].Number
+	if s := query.Get("to"); s != "" {
+		if toNum, err = strconv.Atoi(s); err != nil {
+			log.Printf("handleAssetDiff: invalid to %q", s)
+			http.Error(w, "Invalid to revision", http.StatusBadRequest)
+			return
+		}
+	}
+	from, to := findRevision(history, fromNum), findRevision(history, toNum)
+	if from == nil || to == nil {
+		log.Printf("handleAssetDiff: revision %d or %d not found for asset %s", fromNum, toNum, assetID)
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	changes, err := diffRevisions(from.Asset, to.Asset)
+	if err != nil {
+		log.Printf("handleAssetDiff: cannot diff revisions: %v", err)
+		http.Error(w, "Corrupt revision", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"from": fromNum, "to": toNum, "changes": changes})
+}
+
+// Restores an asset to a prior revision, POST {"revision": n}. The rollback
+// is itself recorded as a new revision; the asset keeps its current ordering.
+func handleAssetRollback(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	if r.Method != http.MethodPost {
+		log.Printf("handleAssetRollback: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleAssetRollback")
+	if !ok {
+		return
+	}
+	var req struct {
+		Revision int `json:"revision"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("handleAssetRollback: invalid request body: %v", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	owner, current, err := resolveAsset(user, assetID, PermEdit)
+	if err != nil {
+		writeAccessError(w, "handleAssetRollback", assetID, err)
+		return
+	}
+	rev := findRevision(store.RevisionsOf(owner, assetID), req.Revision)
+	if rev == nil {
+		log.Printf("handleAssetRollback: revision %d not found for asset %s", req.Revision, assetID)
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	restored, err := decodeAsset(current.GetType(), rev.Asset, store.FavouritesOf(owner))
+	if err != nil {
+		log.Printf("handleAssetRollback: revision %d of asset %s no longer valid: %v", rev.Number, assetID, err)
+		http.Error(w, "Revision can no longer be applied: "+err.Error(), http.StatusConflict)
+		return
+	}
+	restored.SetPosition(current.GetPosition())
+	restored.SetPinned(current.IsPinned())
+	if !store.ReplaceAsset(owner, restored) {
+		log.Printf("handleAssetRollback: asset %s disappeared", assetID)
+		http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+		return
+	}
+	if back := newRevision(restored, user.ID, "rollback"); back != nil {
+		back.RestoredFrom = rev.Number
+		store.AddRevision(owner, assetID, back)
+	}
+	notify(owner, EventUpdated, restored)
+	log.Printf("handleAssetRollback: asset %s rolled back to revision %d by user %s", assetID, rev.Number, user.ID)
+	json.NewEncoder(w).Encode(restored)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHistory_RecordDiffAndRollback(t *testing.T) {
+	resetStore()
+	userID, editorID := uuid.New(), uuid.New()
+	store.AddUser(&User{ID: userID})
+	store.AddUser(&User{ID: editorID})
+	token, _ := GenerateJWT(userID)
+	editorToken, _ := GenerateJWT(editorID)
+
+	w := doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{
+		"type": ChartType, "favorite": true, "asset": map[string]string{"Title": "Sales", "Description": "first"},
+	})
+	var chart Chart
+	json.NewDecoder(w.Body).Decode(&chart)
+	store.PutShare(&Share{ID: uuid.New(), OwnerID: userID, GranteeID: editorID, AssetID: chart.ID, Permission: PermEdit})
+
+	doRequest(t, handleEditFavourite, editorToken, http.MethodPut, "/favourites/edit?asset_id="+chart.ID.String(), map[string]string{"description": "second"})
+	doRequest(t, handleRemoveFavourite, token, http.MethodPut, "/favourites/remove?asset_id="+chart.ID.String(), map[string]bool{"favorite": false})
+
+	base := "/favourites/" + chart.ID.String()
+	w = doRequest(t, handleFavouriteByID, token, http.MethodGet, base+"/history", nil)
+	var history []struct {
+		Revision
+		Changes []FieldChange `json:"changes"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 revisions, got %d", len(history))
+	}
+	if history[0].Number != 3 || history[0].Action != "favorite" || history[1].AuthorID != editorID {
+		t.Errorf("unexpected history %+v", history)
+	}
+	if len(history[1].Changes) != 1 || history[1].Changes[0].Field != "Description" ||
+		string(history[1].Changes[0].Old) != `"first"` || string(history[1].Changes[0].New) != `"second"` {
+		t.Errorf("unexpected changes %+v", history[1].Changes)
+	}
+
+	w = doRequest(t, handleFavouriteByID, token, http.MethodGet, base+"/diff?from=1&to=3", nil)
+	var diff struct {
+		Changes []FieldChange
+	}
+	json.NewDecoder(w.Body).Decode(&diff)
+	if len(diff.Changes) != 2 {
+		t.Errorf("expected Description and Favorite to differ, got %+v", diff.Changes)
+	}
+
+	w = doRequest(t, handleFavouriteByID, token, http.MethodPost, base+"/rollback", map[string]int{"revision": 1})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	restored := findAsset(store.GetUser(userID), chart.ID).(*Chart)
+	if restored.Description != "first" || !restored.Favorite {
+		t.Errorf("expected revision 1 restored, got %+v", restored)
+	}
+	if revs := store.RevisionsOf(store.GetUser(userID), chart.ID); len(revs) != 4 || revs[3].RestoredFrom != 1 {
+		t.Errorf("expected rollback recorded as revision 4, got %d revisions", len(revs))
+	}
+	if w := doRequest(t, handleFavouriteByID, token, http.MethodPost, base+"/rollback", map[string]int{"revision": 9}); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for unknown revision, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const maxTagLength = 64
+
+// reference definitions: [label]: url
+var mdLinkDefinition = regexp.MustCompile(`(?m)^( {0,3}\[[^\]\n]+\]:[ \t]*)(\S+)`)
+
+// sanitizeMarkdown reduces text to the safe Markdown subset stored for
+// insights: raw HTML is escaped so it renders as text, link and image targets
+// are restricted to http(s), mailto and relative URLs, and control characters
+// are dropped.
+func sanitizeMarkdown(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' && r != '\t' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, text)
+	text = strings.ReplaceAll(text, "\r", "")
+	text = strings.ReplaceAll(text, "<", "&lt;")
+	text = sanitizeInlineLinks(text)
+	return mdLinkDefinition.ReplaceAllStringFunc(text, func(m string) string {
+		parts := mdLinkDefinition.FindStringSubmatch(m)
+		if isSafeURL(parts[2]) {
+			return m
+		}
+		return parts[1] + "#"
+	})
+}
+
+// sanitizeInlineLinks replaces the whole target of inline links and images
+// that are not safe with "#". Targets may contain balanced parentheses, e.g.
+// https://en.wikipedia.org/wiki/Go_(programming_language). Every "](" starts a
+// target whatever the label before it, as labels may nest brackets and images.
+func sanitizeInlineLinks(text string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "](")
+		if start < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:start+2])
+		text = text[start+2:]
+		end := linkTargetEnd(text)
+		if isSafeURL(text[:end]) {
+			b.WriteString(text[:end])
+		} else {
+			b.WriteString("#")
+			if end == len(text) || text[end] != ')' {
+				b.WriteString(")")
+			}
+		}
+		text = text[end:]
+	}
+}
+
+// linkTargetEnd returns the index of the parenthesis closing a link target,
+// or of the end of the line when it is not closed
+func linkTargetEnd(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '\n':
+			return i
+		}
+	}
+	return len(text)
+}
+
+// isSafeURL reports whether a link target is relative or uses an allowed
+// scheme. Browsers decode entities and ignore control characters and
+// whitespace in URLs, so "java&#115;cript:" is checked as "javascript:".
+func isSafeURL(raw string) bool {
+	for {
+		decoded := html.UnescapeString(raw)
+		if decoded == raw {
+			break
+		}
+		raw = decoded
+	}
+	raw = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, raw)
+	raw = strings.TrimLeft(raw, "<")
+	// A scheme is whatever comes before a colon that precedes any path,
+	// query or fragment
+	i := strings.IndexAny(raw, ":/?#")
+	if i < 0 || raw[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(raw[:i]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// normalizeTags trims and lower-cases tags, dropping empty and duplicate ones
+func normalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out, nil
+}
+
+// validateInsight sanitizes the insight text and checks its sources and its
+// links against the assets it may be related to
+func validateInsight(existing []Asset, i *Insight) error {
+	i.Text = sanitizeMarkdown(i.Text)
+	for _, src := range i.Sources {
+		u, err := url.Parse(src.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("source %q must have an absolute http(s) URL", src.URL)
+		}
+	}
+	seen := make(map[uuid.UUID]bool, len(i.RelatedAssets))
+	related := make([]uuid.UUID, 0, len(i.RelatedAssets))
+	for _, id := range i.RelatedAssets {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		asset := lookupAsset(existing, id)
+		if asset == nil {
+			return fmt.Errorf("related asset %s not found", id)
+		}
+		if asset.GetType() != ChartType && asset.GetType() != AudienceType {
+			return fmt.Errorf("related asset %s is a %s, only charts and audiences can be linked", id, asset.GetType())
+		}
+		related = append(related, id)
+	}
+	i.RelatedAssets = related
+	return nil
+}
+
+// findAsset returns the user's asset with the given ID, or nil
+func findAsset(user *User, id uuid.UUID) Asset {
+	return lookupAsset(store.FavouritesOf(user), id)
+}
+
+// lookupAsset returns the asset with the given ID, or nil
+func lookupAsset(assets []Asset, id uuid.UUID) Asset {
+	for _, asset := range assets {
+		if asset.GetID() == id {
+			return asset
+		}
+	}
+	return nil
+}
+
+// insightView is the /favourites representation of an insight with its
+// related assets embedded
+type insightView struct {
+	*Insight
+	Related []Asset
+}
+
+// embedRelated replaces insights with views embedding their related assets
+func embedRelated(user *User, assets []Asset) []interface{} {
+	out := make([]interface{}, len(assets))
+	for n, asset := range assets {
+		insight, ok := asset.(*Insight)
+		if !ok {
+			out[n] = asset
+			continue
+		}
+		view := insightView{Insight: insight, Related: make([]Asset, 0, len(insight.RelatedAssets))}
+		for _, id := range insight.RelatedAssets {
+			if related := findAsset(user, id); related != nil {
+				view.Related = append(view.Related, related)
+			}
+		}
+		out[n] = view
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSanitizeMarkdown(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"**Bold** and _italic_\n- item", "**Bold** and _italic_\n- item"},
+		{"<script>alert(1)</script>", "&lt;script>alert(1)&lt;/script>"},
+		{"[GWI](https://www.gwi.com)", "[GWI](https://www.gwi.com)"},
+		{"[click](javascript:alert(1))", "[click](#)"},
+		{"[x](java&#115;cript:alert(1)) after", "[x](#) after"},
+		{"[x](&#x6A;ava&Tab;script&colon;alert(1))", "[x](#)"},
+		{"[x]( JaVa\tScRiPt:alert(1) \"t\")", "[x](#)"},
+		{"[x](<javascript:alert(1)>)", "[x](#)"},
+		{"[x](javascript:alert(1)\nmore", "[x](#)\nmore"},
+		{"[![img](x.png)](javascript:alert(1))", "[![img](x.png)](#)"},
+		{"[a [b] c](javascript:alert(1))", "[a [b] c](#)"},
+		{"[Go](https://en.wikipedia.org/wiki/Go_(programming_language))", "[Go](https://en.wikipedia.org/wiki/Go_(programming_language))"},
+		{"[mail](mailto:team@example.com)", "[mail](mailto:team@example.com)"},
+		{"![img](data:image/png;base64,xx)", "![img](#)"},
+		{"[rel](/charts/1 \"title\")", "[rel](/charts/1 \"title\")"},
+		{"[x]: vbscript:run\n[y]: https://ok", "[x]: #\n[y]: https://ok"},
+		{"[z]: vb&#115;cript:run", "[z]: #"},
+		{"a\x00b\r\nc", "ab\nc"},
+	}
+	for _, tc := range cases {
+		if got := sanitizeMarkdown(tc.in); got != tc.want {
+			t.Errorf("sanitizeMarkdown(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestHandleAddFavourite_InsightEnrichment(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Chart1", Favorite: true}
+	other := &Insight{ID: uuid.New(), Text: "Other", Favorite: true}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart, other}})
+	token, _ := GenerateJWT(userID)
+
+	add := func(insight map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"type": InsightType, "favorite": true, "asset": insight})
+		req := httptest.NewRequest(http.MethodPost, "/favourites/add", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		AuthMiddleware(handleAddFavourite)(w, req)
+		return w
+	}
+
+	w := add(map[string]interface{}{
+		"text":          "Gen Z <b>loves</b> [short video](javascript:void(0))",
+		"sources":       []map[string]string{{"title": "GWI Core", "url": "https://www.gwi.com/core"}},
+		"tags":          []string{" Gen Z ", "video", "gen z"},
+		"relatedAssets": []string{chart.ID.String()},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var resp Insight
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Text != "Gen Z &lt;b>loves&lt;/b> [short video](#)" {
+		t.Errorf("text not sanitized: %q", resp.Text)
+	}
+	if len(resp.Tags) != 2 || resp.Tags[0] != "gen z" || resp.Tags[1] != "video" {
+		t.Errorf("unexpected tags %v", resp.Tags)
+	}
+	if len(resp.Sources) != 1 || len(resp.RelatedAssets) != 1 || resp.RelatedAssets[0] != chart.ID {
+		t.Errorf("unexpected sources %v or related assets %v", resp.Sources, resp.RelatedAssets)
+	}
+
+	invalid := []map[string]interface{}{
+		{"text": "x", "sources": []map[string]string{{"url": "ftp://example.com"}}},
+		{"text": "x", "relatedAssets": []string{uuid.New().String()}},
+		{"text": "x", "relatedAssets": []string{other.ID.String()}},
+	}
+	for _, insight := range invalid {
+		if w := add(insight); w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for %v, got %d", http.StatusBadRequest, insight, w.Code)
+		}
+	}
+
+	// embed=related inlines the linked chart
+	req := httptest.NewRequest(http.MethodGet, "/favourites?embed=related", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	wList := httptest.NewRecorder()
+	AuthMiddleware(handleFavourites)(wList, req)
+	var list []map[string]interface{}
+	if err := json.NewDecoder(wList.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("expected 3 favourites, got %d", len(list))
+	}
+	related, ok := list[2]["Related"].([]interface{})
+	if !ok || len(related) != 1 {
+		t.Fatalf("expected 1 embedded related asset, got %v", list[2]["Related"])
+	}
+	if title := related[0].(map[string]interface{})["Title"]; title != "Chart1" {
+		t.Errorf("expected embedded chart 'Chart1', got %v", title)
+	}
+	if _, ok := list[1]["Related"]; !ok {
+		t.Error("expected insights without links to embed an empty list")
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	defaultLinkLifetime = 7 * 24 * time.Hour
+	maxLinkLifetime     = 30 * 24 * time.Hour
+	passwordIterations  = 100000
+
+	// password guesses allowed per link and per client IP before a lockout
+	maxPasswordFailures = 5
+	passwordLockout     = time.Minute
+	maxPasswordLockout  = time.Hour
+)
+
+// ShareLink is a public, expiring link to a single asset. The link itself is
+// the signed token; only its metadata is stored so the owner can revoke it.
+type ShareLink struct {
+	ID                uuid.UUID `json:"id"`
+	OwnerID           uuid.UUID `json:"owner_id"`
+	AssetID           uuid.UUID `json:"asset_id"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	PasswordProtected bool      `json:"password_protected"`
+	CreatedAt         time.Time `json:"created_at"`
+	passwordSalt      []byte
+	passwordHash      []byte
+}
+
+// setPassword stores a salted PBKDF2-HMAC-SHA256 hash of the password
+func (l *ShareLink) setPassword(password string) error {
+	l.passwordSalt = make([]byte, 16)
+	if _, err := rand.Read(l.passwordSalt); err != nil {
+		return err
+	}
+	l.passwordHash = hashPassword(password, l.passwordSalt)
+	l.PasswordProtected = true
+	return nil
+}
+
+// checkPassword reports whether the password opens the link
+func (l *ShareLink) checkPassword(password string) bool {
+	if !l.PasswordProtected {
+		return true
+	}
+	hash := hashPassword(password, l.passwordSalt)
+	return subtle.ConstantTimeCompare(hash, l.passwordHash) == 1
+}
+
+// hashPassword derives the 32 byte PBKDF2-HMAC-SHA256 key of the password
+func hashPassword(password string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(password), salt, passwordIterations, sha256.Size, sha256.New)
+}
+
+// attemptLimiter counts failed password attempts per key, e.g. a link or a
+// client IP. Once a key reaches maxPasswordFailures it is locked out, for
+// passwordLockout doubling with every further failure up to
+// maxPasswordLockout. Keys are forgotten a lockout after their last failure.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	failures map[string]*attempts
+	now      func() time.Time
+}
+
+type attempts struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func newAttemptLimiter() *attemptLimiter {
+	return &attemptLimiter{failures: make(map[string]*attempts), now: time.Now}
+}
+
+// linkAttempts limits the password guesses on /shared/{token}
+var linkAttempts = newAttemptLimiter()
+
+// retryAfter returns how long the first locked key stays locked, or 0
+func (l *attemptLimiter) retryAfter(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for _, key := range keys {
+		if a, ok := l.failures[key]; ok && now.Before(a.lockedUntil) {
+			return a.lockedUntil.Sub(now)
+		}
+	}
+	return 0
+}
+
+// fail records a failed attempt against every key
+func (l *attemptLimiter) fail(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for key, a := range l.failures {
+		if now.Sub(a.last) > maxPasswordLockout && now.After(a.lockedUntil) {
+			delete(l.failures, key)
+		}
+	}
+	for _, key := range keys {
+		a, ok := l.failures[key]
+		if !ok {
+			a = &attempts{}
+			l.failures[key] = a
+		}
+		a.count++
+		a.last = now
+		if a.count >= maxPasswordFailures {
+			lockout := maxPasswordLockout
+			if shift := a.count - maxPasswordFailures; shift < 16 {
+				lockout = min(passwordLockout<<shift, maxPasswordLockout)
+			}
+			a.lockedUntil = now.Add(lockout)
+		}
+	}
+}
+
+// succeed clears the failures of the keys
+func (l *attemptLimiter) succeed(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		delete(l.failures, key)
+	}
+}
+
+// clientIP returns the IP of the request's peer
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Creates (POST) or lists (GET) the public links of an asset
+func handleAssetLinks(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	user, ok := requireUser(w, r, "handleAssetLinks")
+	if !ok {
+		return
+	}
+	if findAsset(user, assetID) == nil {
+		log.Printf("handleAssetLinks: asset not found %s", assetID)
+		http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(store.LinksOf(user.ID, assetID))
+	case http.MethodPost:
+		var req struct {
+			ExpiresIn string `json:"expires_in"`
+			Password  string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("handleAssetLinks: invalid request body: %v", err)
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		lifetime := defaultLinkLifetime
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 || d > maxLinkLifetime {
+				log.Printf("handleAssetLinks: invalid expires_in %q", req.ExpiresIn)
+				http.Error(w, "expires_in must be a duration up to "+maxLinkLifetime.String(), http.StatusBadRequest)
+				return
+			}
+			lifetime = d
+		}
+		now := time.Now().UTC()
+		link := &ShareLink{
+			ID:        uuid.New(),
+			OwnerID:   user.ID,
+			AssetID:   assetID,
+			ExpiresAt: now.Add(lifetime).Truncate(time.Second),
+			CreatedAt: now,
+		}
+		if req.Password != "" {
+			if err := link.setPassword(req.Password); err != nil {
+				log.Printf("handleAssetLinks: hashing password: %v", err)
+				http.Error(w, "Could not create link", http.StatusInternalServerError)
+				return
+			}
+		}
+		token, err := GenerateShareToken(link.ID, link.ExpiresAt)
+		if err != nil {
+			log.Printf("handleAssetLinks: signing link: %v", err)
+			http.Error(w, "Could not create link", http.StatusInternalServerError)
+			return
+		}
+		store.PutLink(link)
+		log.Printf("handleAssetLinks: created link %s for asset %s, expires %s", link.ID, assetID, link.ExpiresAt)
+		resp := struct {
+			*ShareLink
+			Token string `json:"token"`
+			URL   string `json:"url"`
+		}{ShareLink: link, Token: token, URL: "/shared/" + token}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	default:
+		log.Printf("handleAssetLinks: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Revokes a public link
+func handleLinkByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		log.Printf("handleLinkByID: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleLinkByID")
+	if !ok {
+		return
+	}
+	linkID, err := uuid.Parse(strings.Trim(strings.TrimPrefix(r.URL.Path, "/links/"), "/"))
+	if err != nil {
+		log.Printf("handleLinkByID: unknown path %s", r.URL.Path)
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	link := store.GetLink(linkID)
+	if link == nil || link.OwnerID != user.ID {
+		log.Printf("handleLinkByID: link not found %s", linkID)
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	store.RemoveLink(linkID)
+	log.Printf("handleLinkByID: link %s revoked by user %s", linkID, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Serves the read-only view of a shared asset without authentication:
+// GET /shared/{token}, with the password in the X-Share-Password header if set
+func handleSharedLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleSharedLink: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	linkID, err := parseShareToken(strings.Trim(strings.TrimPrefix(r.URL.Path, "/shared/"), "/"))
+	if err != nil {
+		log.Printf("handleSharedLink: invalid or expired token")
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	link := store.GetLink(linkID)
+	if link == nil || time.Now().After(link.ExpiresAt) {
+		log.Printf("handleSharedLink: link %s revoked or expired", linkID)
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	if link.PasswordProtected {
+		keys := []string{"link:" + linkID.String(), "ip:" + clientIP(r)}
+		if wait := linkAttempts.retryAfter(keys...); wait > 0 {
+			log.Printf("handleSharedLink: too many password attempts for link %s from %s", linkID, clientIP(r))
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			http.Error(w, "Too many password attempts", http.StatusTooManyRequests)
+			return
+		}
+		if !link.checkPassword(r.Header.Get("X-Share-Password")) {
+			log.Printf("handleSharedLink: wrong password for link %s", linkID)
+			linkAttempts.fail(keys...)
+			http.Error(w, "Password required", http.StatusUnauthorized)
+			return
+		}
+		// the client's failures stay, so guessing other links is still limited
+		linkAttempts.succeed(keys[0])
+	}
+	owner := store.GetUser(link.OwnerID)
+	if owner == nil {
+		log.Printf("handleSharedLink: owner not found %s", link.OwnerID)
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	asset := findAsset(owner, link.AssetID)
+	if asset == nil {
+		log.Printf("handleSharedLink: asset not found %s", link.AssetID)
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	resp := struct {
+		Type      string    `json:"type"`
+		Asset     Asset     `json:"asset"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{Type: asset.GetType(), Asset: asset, ExpiresAt: link.ExpiresAt}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
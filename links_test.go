@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestHashPassword(t *testing.T) {
+	// Hashes stored in earlier snapshots were derived the same way, so they
+	// still verify
+	salt := []byte("salt")
+	if !bytes.Equal(hashPassword("password", salt), hashPassword("password", salt)) || bytes.Equal(hashPassword("password", salt), hashPassword("Password", salt)) {
+		t.Error("expected the hash to depend only on the password and salt")
+	}
+	if got := hex.EncodeToString(pbkdf2.Key([]byte("password"), salt, 1, sha256.Size, sha256.New)); got != "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b" {
+		t.Errorf("unexpected PBKDF2-HMAC-SHA256 key %s", got)
+	}
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	now := time.Now()
+	l := newAttemptLimiter()
+	l.now = func() time.Time { return now }
+	for i := 0; i < maxPasswordFailures-1; i++ {
+		l.fail("link", "ip")
+	}
+	if wait := l.retryAfter("link"); wait != 0 {
+		t.Fatalf("expected no lockout before %d failures, got %v", maxPasswordFailures, wait)
+	}
+	l.fail("link", "ip")
+	if wait := l.retryAfter("other", "ip"); wait != passwordLockout {
+		t.Errorf("expected a %v lockout, got %v", passwordLockout, wait)
+	}
+	l.fail("link")
+	if wait := l.retryAfter("link"); wait != 2*passwordLockout {
+		t.Errorf("expected the lockout doubled, got %v", wait)
+	}
+	for i := 0; i < 20; i++ {
+		l.fail("link")
+	}
+	if wait := l.retryAfter("link"); wait != maxPasswordLockout {
+		t.Errorf("expected the lockout capped at %v, got %v", maxPasswordLockout, wait)
+	}
+
+	now = now.Add(maxPasswordLockout + time.Second)
+	if wait := l.retryAfter("link", "ip"); wait != 0 {
+		t.Errorf("expected the lockout over, got %v", wait)
+	}
+	l.fail("new")
+	if len(l.failures) != 1 {
+		t.Errorf("expected stale keys forgotten, got %d keys", len(l.failures))
+	}
+	l.succeed("new")
+	if len(l.failures) != 0 {
+		t.Errorf("expected a success to clear the key, got %d keys", len(l.failures))
+	}
+}
+
+func getShared(url, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if password != "" {
+		req.Header.Set("X-Share-Password", password)
+	}
+	w := httptest.NewRecorder()
+	handleSharedLink(w, req)
+	return w
+}
+
+func TestShareLinks(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Public chart", Favorite: true}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart}})
+	token, _ := GenerateJWT(userID)
+
+	create := func(body map[string]string) (ShareLink, string) {
+		w := doRequest(t, handleFavouriteByID, token, http.MethodPost, "/favourites/"+chart.ID.String()+"/links", body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		var resp struct {
+			ShareLink
+			URL string `json:"url"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.ShareLink, resp.URL
+	}
+
+	open, openURL := create(map[string]string{"expires_in": "1h"})
+	if time.Until(open.ExpiresAt) > time.Hour || open.PasswordProtected {
+		t.Errorf("unexpected link %+v", open)
+	}
+	w := getShared(openURL, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var view struct {
+		Type  string
+		Asset map[string]interface{}
+	}
+	json.NewDecoder(w.Body).Decode(&view)
+	if view.Type != ChartType || view.Asset["Title"] != "Public chart" {
+		t.Errorf("unexpected shared view %+v", view)
+	}
+
+	protected, protectedURL := create(map[string]string{"password": "s3cret"})
+	if !protected.PasswordProtected {
+		t.Error("expected link to be password protected")
+	}
+	if w := getShared(protectedURL, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without password, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := getShared(protectedURL, "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d with wrong password, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := getShared(protectedURL, "s3cret"); w.Code != http.StatusOK {
+		t.Errorf("expected status %d with password, got %d", http.StatusOK, w.Code)
+	}
+
+	// Guessing locks the link out, even for the right password
+	for i := 2; i < maxPasswordFailures; i++ {
+		getShared(protectedURL, "guess")
+	}
+	w = getShared(protectedURL, "s3cret")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected status %d with a Retry-After after %d failures, got %d", http.StatusTooManyRequests, maxPasswordFailures, w.Code)
+	}
+	linkAttempts = newAttemptLimiter()
+
+	// A user token is not a share link, and tampered tokens are rejected
+	if w := getShared("/shared/"+token, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a user token, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := getShared(openURL+"x", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a tampered token, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Expired links are rejected by their signature
+	expiredToken, _ := GenerateShareToken(open.ID, time.Now().Add(-time.Minute))
+	if w := getShared("/shared/"+expiredToken, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an expired link, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = doRequest(t, handleFavouriteByID, token, http.MethodGet, "/favourites/"+chart.ID.String()+"/links", nil)
+	var links []ShareLink
+	json.NewDecoder(w.Body).Decode(&links)
+	if len(links) != 2 {
+		t.Fatalf("expected 2 links, got %d", len(links))
+	}
+
+	if w := doRequest(t, handleLinkByID, token, http.MethodDelete, "/links/"+open.ID.String(), nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d revoking, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := getShared(openURL, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d after revoke, got %d", http.StatusNotFound, w.Code)
+	}
+
+	for _, expiresIn := range []string{"forever", "-1h", "9999h"} {
+		w := doRequest(t, handleFavouriteByID, token, http.MethodPost, "/favourites/"+chart.ID.String()+"/links", map[string]string{"expires_in": expiresIn})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for expires_in %q, got %d", http.StatusBadRequest, expiresIn, w.Code)
+		}
+	}
+}
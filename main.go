@@ -1,18 +1,140 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/google/uuid"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	flags := newConfigFlags(flag.CommandLine)
+	flag.Parse()
+	cfg, err := flags.load(os.LookupEnv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if flags.print {
+		if err := cfg.print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := applyConfig(cfg); err != nil {
+		log.Fatalf("Applying configuration: %v", err)
+	}
+	go watchReload(flags)
+	if cfg.Panel.File != "" {
+		p, err := LoadPanelFile(cfg.Panel.File)
+		if err != nil {
+			log.Fatalf("Loading respondent panel: %v", err)
+		}
+		panel = p
+		log.Printf("Loaded %d respondents from %s\n", len(p.respondents), cfg.Panel.File)
+	}
+	if snapshotPath != "" {
+		info, err := RestoreSnapshot(snapshotPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			log.Printf("No snapshot at %s yet, starting empty\n", snapshotPath)
+		case err != nil:
+			log.Fatalf("Restoring snapshot: %v", err)
+		default:
+			log.Printf("Restored %d users from %s\n", info.Users, snapshotPath)
+		}
+	}
+	if walPath := cfg.Storage.WAL; walPath != "" {
+		records, err := ReplayWAL(walPath)
+		if err != nil {
+			log.Fatalf("Replaying write-ahead log: %v", err)
+		}
+		log.Printf("Replayed %d records from %s\n", records, walPath)
+		wal, err := OpenWAL(walPath)
+		if err != nil {
+			log.Fatalf("Opening write-ahead log: %v", err)
+		}
+		store.wal = wal
+	}
+	if snapshotPath != "" && cfg.Storage.SnapshotInterval > 0 {
+		go runAutoSnapshot(ctx, snapshotPath, cfg.Storage.SnapshotInterval)
+	}
 	// Add a default user for demo/testing
 	defaultID := uuid.New()
 	log.Printf("Default user_id: %s\n", defaultID)
+	store.writeMu.Lock()
 	store.AddUser(&User{ID: defaultID})
-	setupRoutes()
-	log.Println("Server running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	if err := store.commit(); err != nil {
+		log.Fatalf("Logging default user: %v", err)
+	}
+	store.writeMu.Unlock()
+	go runTrashPurger(ctx, trashPurgeInterval)
+	go runWebhookDispatcher(ctx, webhookDispatchEvery)
+	mux := http.NewServeMux()
+	setupRoutes(mux)
+	var tlsConfig *tls.Config
+	if cfg.TLS.Cert != "" {
+		certs, err := newCertReloader(cfg.TLS.Cert, cfg.TLS.Key)
+		if err != nil {
+			log.Fatalf("Loading TLS certificate: %v", err)
+		}
+		if tlsConfig, err = newTLSConfig(cfg.TLS, certs); err != nil {
+			log.Fatalf("Configuring TLS: %v", err)
+		}
+		go certs.run(ctx, certCheckInterval)
+	}
+	var grpcSrv *grpc.Server
+	if cfg.GRPC.Addr != "" {
+		lis, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			log.Fatalf("Listening for gRPC: %v", err)
+		}
+		log.Printf("gRPC running on %s\n", cfg.GRPC.Addr)
+		if tlsConfig == nil {
+			log.Println("Serving gRPC without TLS, set tls.cert and tls.key so tokens are not sent in the clear")
+		}
+		grpcSrv = newGRPCServer(tlsConfig)
+		go func() {
+			if err := grpcSrv.Serve(lis); err != nil {
+				log.Fatalf("Serving gRPC: %v", err)
+			}
+		}()
+	}
+	srv := newHTTPServer(cfg.HTTP, validateAPI(mux))
+	srv.TLSConfig = tlsConfig
+	lis, err := net.Listen("tcp", cfg.HTTP.Addr)
+	if err != nil {
+		log.Fatalf("Listening for HTTP: %v", err)
+	}
+	if tlsConfig != nil {
+		log.Printf("Server running on %s with TLS\n", cfg.HTTP.Addr)
+	} else {
+		log.Printf("Server running on %s\n", cfg.HTTP.Addr)
+	}
+	go func() {
+		if err := serveHTTP(srv, lis); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Serving HTTP: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	// A second signal kills the server without waiting
+	stop()
+	log.Printf("Shutting down, waiting up to %v for in-flight requests\n", cfg.HTTP.ShutdownTimeout)
+	shutdownServers(srv, grpcSrv, cfg.HTTP.ShutdownTimeout)
+	if err := flushStorage(); err != nil {
+		log.Fatalf("Flushing storage: %v", err)
+	}
+	log.Println("Server stopped")
 }
@@ -1,80 +1,65 @@
 package main
 
-import "github.com/google/uuid"
+import (
+	"time"
 
-// AssetType represents the type of asset
-const (
-	ChartType    = "chart"
-	InsightType  = "insight"
-	AudienceType = "audience"
-)
-
-type Asset interface {
-	GetID() uuid.UUID
-	GetType() string
-	GetDescription() string
-	SetDescription(desc string)
-	IsFavorite() bool
-	SetFavorite(isFav bool)
-}
+	"github.com/google/uuid"
 
-type Chart struct {
-	ID          uuid.UUID
-	Title       string
-	XAxisTitle  string
-	YAxisTitle  string
-	Data        []float64
-	Description string
-	Favorite    bool
-}
-
-func (c *Chart) GetID() uuid.UUID           { return c.ID }
-func (c *Chart) GetType() string            { return ChartType }
-func (c *Chart) GetDescription() string     { return c.Description }
-func (c *Chart) SetDescription(desc string) { c.Description = desc }
-func (c *Chart) IsFavorite() bool           { return c.Favorite }
-func (c *Chart) SetFavorite(isFav bool)     { c.Favorite = isFav }
+	"platform-go-challenge/models"
+)
 
-type Insight struct {
-	ID          uuid.UUID
-	Text        string
-	Description string
-	Favorite    bool
-}
+// The assets live in the models package, shared with the Go client
+type (
+	Asset      = models.Asset
+	Chart      = models.Chart
+	Insight    = models.Insight
+	Source     = models.Source
+	Audience   = models.Audience
+	Gender     = models.Gender
+	Rule       = models.Rule
+	RuleOp     = models.RuleOp
+	Respondent = models.Respondent
+)
 
-func (i *Insight) GetID() uuid.UUID           { return i.ID }
-func (i *Insight) GetType() string            { return InsightType }
-func (i *Insight) GetDescription() string     { return i.Description }
-func (i *Insight) SetDescription(desc string) { i.Description = desc }
-func (i *Insight) IsFavorite() bool           { return i.Favorite }
-func (i *Insight) SetFavorite(isFav bool)     { i.Favorite = isFav }
+// AssetType represents the type of asset
+const (
+	ChartType    = models.ChartType
+	InsightType  = models.InsightType
+	AudienceType = models.AudienceType
+)
 
-type Gender string
+const (
+	OpAnd   = models.OpAnd
+	OpOr    = models.OpOr
+	OpNot   = models.OpNot
+	OpIn    = models.OpIn
+	OpRange = models.OpRange
+)
 
+// Respondent attributes an audience rule can test
 const (
-	Male   Gender = "Male"
-	Female Gender = "Female"
+	AttrGender      = models.AttrGender
+	AttrCountry     = models.AttrCountry
+	AttrAge         = models.AttrAge
+	AttrSocialHours = models.AttrSocialHours
+	AttrPurchases   = models.AttrPurchases
 )
 
-type Audience struct {
-	ID           uuid.UUID
-	Gender       Gender
-	BirthCountry string
-	AgeGroup     string
-	SocialHours  int
-	Purchases    int
-	Description  string
-	Favorite     bool
+// Collection is a user-defined folder of assets
+type Collection struct {
+	ID        uuid.UUID
+	Name      string
+	AssetIDs  []uuid.UUID
+	CreatedAt time.Time
 }
 
-func (a *Audience) GetID() uuid.UUID           { return a.ID }
-func (a *Audience) GetType() string            { return AudienceType }
-func (a *Audience) GetDescription() string     { return a.Description }
-func (a *Audience) SetDescription(desc string) { a.Description = desc }
-func (a *Audience) IsFavorite() bool           { return a.Favorite }
-func (a *Audience) SetFavorite(isFav bool)     { a.Favorite = isFav }
-
+// User belongs to the tenant TenantID, the ID of their organisation, or
+// uuid.Nil when they are not part of one
 type User struct {
-	ID         uuid.UUID
-	Favourites []Asset
+	ID          uuid.UUID
+	TenantID    uuid.UUID
+	Favourites  []Asset
+	Collections []*Collection
+	Trash       []*TrashedAsset
+	History     map[uuid.UUID][]*Revision
 }
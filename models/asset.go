@@ -0,0 +1,118 @@
+// Package models holds the assets of the favourites API, shared by the
+// server and its Go client
+package models
+
+import "github.com/google/uuid"
+
+// AssetType represents the type of asset
+const (
+	ChartType    = "chart"
+	InsightType  = "insight"
+	AudienceType = "audience"
+)
+
+type Asset interface {
+	GetID() uuid.UUID
+	GetType() string
+	GetDescription() string
+	SetDescription(desc string)
+	IsFavorite() bool
+	SetFavorite(isFav bool)
+	GetTags() []string
+	SetTags(tags []string)
+	GetPosition() float64
+	SetPosition(pos float64)
+	IsPinned() bool
+	SetPinned(pinned bool)
+}
+
+type Chart struct {
+	ID          uuid.UUID
+	Title       string
+	XAxisTitle  string
+	YAxisTitle  string
+	Data        []float64
+	Tags        []string
+	Position    float64
+	Pinned      bool
+	Description string
+	Favorite    bool
+}
+
+func (c *Chart) GetID() uuid.UUID           { return c.ID }
+func (c *Chart) GetType() string            { return ChartType }
+func (c *Chart) GetDescription() string     { return c.Description }
+func (c *Chart) SetDescription(desc string) { c.Description = desc }
+func (c *Chart) IsFavorite() bool           { return c.Favorite }
+func (c *Chart) SetFavorite(isFav bool)     { c.Favorite = isFav }
+func (c *Chart) GetTags() []string          { return c.Tags }
+func (c *Chart) SetTags(tags []string)      { c.Tags = tags }
+func (c *Chart) GetPosition() float64       { return c.Position }
+func (c *Chart) SetPosition(pos float64)    { c.Position = pos }
+func (c *Chart) IsPinned() bool             { return c.Pinned }
+func (c *Chart) SetPinned(pinned bool)      { c.Pinned = pinned }
+
+// Source is a citation backing an insight
+type Source struct {
+	Title string
+	URL   string
+}
+
+// Insight text is a sanitized Markdown subset; RelatedAssets links the
+// charts and audiences the insight was derived from
+type Insight struct {
+	ID            uuid.UUID
+	Text          string
+	Sources       []Source
+	Tags          []string
+	RelatedAssets []uuid.UUID
+	Position      float64
+	Pinned        bool
+	Description   string
+	Favorite      bool
+}
+
+func (i *Insight) GetID() uuid.UUID           { return i.ID }
+func (i *Insight) GetType() string            { return InsightType }
+func (i *Insight) GetDescription() string     { return i.Description }
+func (i *Insight) SetDescription(desc string) { i.Description = desc }
+func (i *Insight) IsFavorite() bool           { return i.Favorite }
+func (i *Insight) SetFavorite(isFav bool)     { i.Favorite = isFav }
+func (i *Insight) GetTags() []string          { return i.Tags }
+func (i *Insight) SetTags(tags []string)      { i.Tags = tags }
+func (i *Insight) GetPosition() float64       { return i.Position }
+func (i *Insight) SetPosition(pos float64)    { i.Position = pos }
+func (i *Insight) IsPinned() bool             { return i.Pinned }
+func (i *Insight) SetPinned(pinned bool)      { i.Pinned = pinned }
+
+type Gender string
+
+const (
+	Male   Gender = "Male"
+	Female Gender = "Female"
+)
+
+// Audience is defined by a rule tree over respondent attributes, e.g.
+// women 25-34 in UK or DE spending 2+ hours on social media
+type Audience struct {
+	ID          uuid.UUID
+	Rules       *Rule
+	Tags        []string
+	Position    float64
+	Pinned      bool
+	Description string
+	Favorite    bool
+}
+
+func (a *Audience) GetID() uuid.UUID           { return a.ID }
+func (a *Audience) GetType() string            { return AudienceType }
+func (a *Audience) GetDescription() string     { return a.Description }
+func (a *Audience) SetDescription(desc string) { a.Description = desc }
+func (a *Audience) IsFavorite() bool           { return a.Favorite }
+func (a *Audience) SetFavorite(isFav bool)     { a.Favorite = isFav }
+func (a *Audience) GetTags() []string          { return a.Tags }
+func (a *Audience) SetTags(tags []string)      { a.Tags = tags }
+func (a *Audience) GetPosition() float64       { return a.Position }
+func (a *Audience) SetPosition(pos float64)    { a.Position = pos }
+func (a *Audience) IsPinned() bool             { return a.Pinned }
+func (a *Audience) SetPinned(pinned bool)      { a.Pinned = pinned }
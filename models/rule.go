@@ -0,0 +1,515 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RuleOp is the operator of a node in an audience rule tree
+type RuleOp string
+
+const (
+	OpAnd   RuleOp = "and"
+	OpOr    RuleOp = "or"
+	OpNot   RuleOp = "not"
+	OpIn    RuleOp = "in"
+	OpRange RuleOp = "range"
+)
+
+// Respondent attributes an audience rule can test
+const (
+	AttrGender      = "gender"
+	AttrCountry     = "country"
+	AttrAge         = "age"
+	AttrSocialHours = "social_hours"
+	AttrPurchases   = "purchases"
+)
+
+// CategoricalAttrs are tested with set membership, NumericAttrs with ranges
+var (
+	CategoricalAttrs = map[string]bool{AttrGender: true, AttrCountry: true}
+	NumericAttrs     = map[string]bool{AttrAge: true, AttrSocialHours: true, AttrPurchases: true}
+)
+
+// Rule is a node of an audience definition. Boolean nodes (and/or/not) hold
+// child Rules, predicate nodes (in/range) test a single respondent attribute.
+type Rule struct {
+	Op     RuleOp   `json:"op"`
+	Rules  []*Rule  `json:"rules,omitempty"`
+	Attr   string   `json:"attr,omitempty"`
+	Values []string `json:"values,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// Respondent is a single record of the respondent panel
+type Respondent struct {
+	Gender      Gender
+	Country     string
+	Age         float64
+	SocialHours float64
+	Purchases   float64
+	Weight      float64
+}
+
+// Validate checks the structure of the rule tree
+func (r *Rule) Validate() error {
+	if r == nil {
+		return errors.New("empty rule")
+	}
+	switch r.Op {
+	case OpAnd, OpOr:
+		if len(r.Rules) == 0 {
+			return fmt.Errorf("%s requires at least one rule", r.Op)
+		}
+	case OpNot:
+		if len(r.Rules) != 1 {
+			return errors.New("not requires exactly one rule")
+		}
+	case OpIn:
+		if !CategoricalAttrs[r.Attr] {
+			return fmt.Errorf("attribute %q does not support set membership", r.Attr)
+		}
+		if len(r.Values) == 0 {
+			return fmt.Errorf("%s: empty value set", r.Attr)
+		}
+		return nil
+	case OpRange:
+		if !NumericAttrs[r.Attr] {
+			return fmt.Errorf("attribute %q does not support ranges", r.Attr)
+		}
+		if r.Min == nil && r.Max == nil {
+			return fmt.Errorf("%s: range needs a min or a max", r.Attr)
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("%s: min greater than max", r.Attr)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown rule op %q", r.Op)
+	}
+	for _, child := range r.Rules {
+		if err := child.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match reports whether the respondent belongs to the audience. A nil rule
+// matches every respondent.
+func (r *Rule) Match(resp *Respondent) bool {
+	if r == nil {
+		return true
+	}
+	switch r.Op {
+	case OpAnd:
+		for _, child := range r.Rules {
+			if !child.Match(resp) {
+				return false
+			}
+		}
+		return true
+	case OpOr:
+		for _, child := range r.Rules {
+			if child.Match(resp) {
+				return true
+			}
+		}
+		return false
+	case OpNot:
+		return !r.Rules[0].Match(resp)
+	case OpIn:
+		v := resp.Categorical(r.Attr)
+		for _, want := range r.Values {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case OpRange:
+		v := resp.Numeric(r.Attr)
+		return (r.Min == nil || v >= *r.Min) && (r.Max == nil || v <= *r.Max)
+	}
+	return false
+}
+
+// Categorical is the value of a categorical attribute
+func (resp *Respondent) Categorical(attr string) string {
+	switch attr {
+	case AttrGender:
+		return string(resp.Gender)
+	case AttrCountry:
+		return resp.Country
+	}
+	return ""
+}
+
+// Numeric is the value of a numeric attribute, NaN for an unknown one
+func (resp *Respondent) Numeric(attr string) float64 {
+	switch attr {
+	case AttrAge:
+		return resp.Age
+	case AttrSocialHours:
+		return resp.SocialHours
+	case AttrPurchases:
+		return resp.Purchases
+	}
+	return math.NaN()
+}
+
+// String serializes the rule tree into the expression syntax read by ParseRule
+func (r *Rule) String() string {
+	if r == nil {
+		return ""
+	}
+	return r.format(false)
+}
+
+func (r *Rule) format(nested bool) string {
+	switch r.Op {
+	case OpAnd, OpOr:
+		parts := make([]string, len(r.Rules))
+		for i, child := range r.Rules {
+			parts[i] = child.format(true)
+		}
+		s := strings.Join(parts, " "+strings.ToUpper(string(r.Op))+" ")
+		if nested && len(parts) > 1 {
+			return "(" + s + ")"
+		}
+		return s
+	case OpNot:
+		return "NOT " + r.Rules[0].format(true)
+	case OpIn:
+		quoted := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			quoted[i] = strconv.Quote(v)
+		}
+		if len(quoted) == 1 {
+			return r.Attr + " = " + quoted[0]
+		}
+		return r.Attr + " IN (" + strings.Join(quoted, ", ") + ")"
+	case OpRange:
+		switch {
+		case r.Min != nil && r.Max != nil && *r.Min == *r.Max:
+			return r.Attr + " = " + formatNumber(*r.Min)
+		case r.Min != nil && r.Max != nil:
+			s := r.Attr + " BETWEEN " + formatNumber(*r.Min) + " AND " + formatNumber(*r.Max)
+			if nested {
+				return "(" + s + ")"
+			}
+			return s
+		case r.Min != nil:
+			return r.Attr + " >= " + formatNumber(*r.Min)
+		default:
+			return r.Attr + " <= " + formatNumber(*r.Max)
+		}
+	}
+	return ""
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// UnmarshalJSON accepts either the structured rule tree or an expression string
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		parsed, err := ParseRule(expr)
+		if err != nil {
+			return err
+		}
+		*r = *parsed
+		return nil
+	}
+	type plain Rule
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*r = Rule(p)
+	return r.Validate()
+}
+
+// ParseRule parses an audience expression such as
+//
+//	gender = "Female" AND age BETWEEN 25 AND 34 AND country IN ("UK", "DE") AND social_hours >= 2
+//
+// Keywords are case-insensitive, NOT binds tighter than AND, which binds
+// tighter than OR.
+func ParseRule(expr string) (*Rule, error) {
+	toks, err := tokenizeRule(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &ruleParser{toks: toks}
+	rule, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+type ruleTokenKind int
+
+const (
+	tokIdent ruleTokenKind = iota
+	tokString
+	tokNumber
+	tokSymbol
+)
+
+type ruleToken struct {
+	kind ruleTokenKind
+	text string
+}
+
+func tokenizeRule(s string) ([]ruleToken, error) {
+	var toks []ruleToken
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			v, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:j+1])
+			}
+			toks = append(toks, ruleToken{tokString, v})
+			i = j + 1
+		case c == '(' || c == ')' || c == ',' || c == '=':
+			toks = append(toks, ruleToken{tokSymbol, string(c)})
+			i++
+		case c == '>' || c == '<':
+			if i+1 >= len(s) || s[i+1] != '=' {
+				return nil, fmt.Errorf("expected %c=", c)
+			}
+			toks = append(toks, ruleToken{tokSymbol, s[i : i+2]})
+			i += 2
+		case unicode.IsDigit(c) || c == '-' || c == '.':
+			j := i + 1
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, ruleToken{tokNumber, s[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			toks = append(toks, ruleToken{tokIdent, s[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return toks, nil
+}
+
+type ruleParser struct {
+	toks []ruleToken
+	pos  int
+}
+
+func (p *ruleParser) peek() *ruleToken {
+	if p.pos < len(p.toks) {
+		return &p.toks[p.pos]
+	}
+	return nil
+}
+
+func (p *ruleParser) next() (ruleToken, error) {
+	if p.pos >= len(p.toks) {
+		return ruleToken{}, errors.New("unexpected end of expression")
+	}
+	p.pos++
+	return p.toks[p.pos-1], nil
+}
+
+func (p *ruleParser) keyword(kw string) bool {
+	if t := p.peek(); t != nil && t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) symbol(sym string) bool {
+	if t := p.peek(); t != nil && t.kind == tokSymbol && t.text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) parseOr() (*Rule, error) {
+	return p.parseBinary(OpOr, "OR", p.parseAnd)
+}
+
+func (p *ruleParser) parseAnd() (*Rule, error) {
+	return p.parseBinary(OpAnd, "AND", p.parseUnary)
+}
+
+func (p *ruleParser) parseBinary(op RuleOp, kw string, operand func() (*Rule, error)) (*Rule, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	rules := []*Rule{first}
+	for p.keyword(kw) {
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, next)
+	}
+	if len(rules) == 1 {
+		return first, nil
+	}
+	return &Rule{Op: op, Rules: rules}, nil
+}
+
+func (p *ruleParser) parseUnary() (*Rule, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Rule{Op: OpNot, Rules: []*Rule{inner}}, nil
+	}
+	if p.symbol("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, errors.New("expected )")
+		}
+		return inner, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *ruleParser) parsePredicate() (*Rule, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != tokIdent {
+		return nil, fmt.Errorf("expected attribute, got %q", t.text)
+	}
+	attr := strings.ToLower(t.text)
+	if !CategoricalAttrs[attr] && !NumericAttrs[attr] {
+		return nil, fmt.Errorf("unknown attribute %q", t.text)
+	}
+	switch {
+	case p.symbol("="):
+		if NumericAttrs[attr] {
+			n, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			return &Rule{Op: OpRange, Attr: attr, Min: &n, Max: &n}, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return &Rule{Op: OpIn, Attr: attr, Values: []string{v}}, nil
+	case p.keyword("IN"):
+		if !p.symbol("(") {
+			return nil, errors.New("expected ( after IN")
+		}
+		var values []string
+		for {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			if p.symbol(")") {
+				break
+			}
+			if !p.symbol(",") {
+				return nil, errors.New("expected , or ) in value list")
+			}
+		}
+		return &Rule{Op: OpIn, Attr: attr, Values: values}, nil
+	case p.keyword("BETWEEN"):
+		lo, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, errors.New("expected AND in BETWEEN")
+		}
+		hi, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		return &Rule{Op: OpRange, Attr: attr, Min: &lo, Max: &hi}, nil
+	case p.symbol(">="):
+		n, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		return &Rule{Op: OpRange, Attr: attr, Min: &n}, nil
+	case p.symbol("<="):
+		n, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		return &Rule{Op: OpRange, Attr: attr, Max: &n}, nil
+	}
+	return nil, fmt.Errorf("expected operator after %s", attr)
+}
+
+func (p *ruleParser) value() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.kind == tokSymbol {
+		return "", fmt.Errorf("expected value, got %q", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *ruleParser) number() (float64, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	if t.kind != tokNumber {
+		return 0, fmt.Errorf("expected number, got %q", t.text)
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", t.text)
+	}
+	return n, nil
+}
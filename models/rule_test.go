@@ -0,0 +1,112 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseRule_RoundTrip(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{`gender = Female`, `gender = "Female"`},
+		{`age BETWEEN 25 AND 34`, `age BETWEEN 25 AND 34`},
+		{`social_hours >= 2`, `social_hours >= 2`},
+		{`purchases <= 10`, `purchases <= 10`},
+		{`age = 30`, `age = 30`},
+		{`country in ("UK", DE)`, `country IN ("UK", "DE")`},
+		{
+			`gender = "Female" and age between 25 and 34 and (country = UK or country = DE) and social_hours >= 2`,
+			`gender = "Female" AND (age BETWEEN 25 AND 34) AND (country = "UK" OR country = "DE") AND social_hours >= 2`,
+		},
+		{`NOT (gender = Male OR age <= 17)`, `NOT (gender = "Male" OR age <= 17)`},
+	}
+	for _, tc := range cases {
+		rule, err := ParseRule(tc.in)
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", tc.in, err)
+		}
+		if got := rule.String(); got != tc.want {
+			t.Errorf("ParseRule(%q).String() = %q, want %q", tc.in, got, tc.want)
+		}
+		again, err := ParseRule(rule.String())
+		if err != nil {
+			t.Fatalf("re-parse %q: %v", rule.String(), err)
+		}
+		if again.String() != rule.String() {
+			t.Errorf("round trip changed %q to %q", rule.String(), again.String())
+		}
+	}
+}
+
+func TestParseRule_Errors(t *testing.T) {
+	cases := []string{
+		``,
+		`height >= 3`,
+		`gender >= 3`,
+		`age IN (1, 2)`,
+		`age BETWEEN 40 AND 30`,
+		`country IN ("UK"`,
+		`gender = "Female" AND`,
+		`gender = "Female" extra`,
+	}
+	for _, in := range cases {
+		if _, err := ParseRule(in); err == nil {
+			t.Errorf("ParseRule(%q): expected error", in)
+		}
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	rule, err := ParseRule(`gender = Female AND age BETWEEN 25 AND 34 AND country IN (UK, DE) AND social_hours >= 2`)
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	cases := []struct {
+		name string
+		resp Respondent
+		want bool
+	}{
+		{"match", Respondent{Gender: Female, Country: "uk", Age: 30, SocialHours: 2.5}, true},
+		{"wrong gender", Respondent{Gender: Male, Country: "UK", Age: 30, SocialHours: 3}, false},
+		{"too old", Respondent{Gender: Female, Country: "DE", Age: 35, SocialHours: 3}, false},
+		{"wrong country", Respondent{Gender: Female, Country: "FR", Age: 30, SocialHours: 3}, false},
+		{"not social", Respondent{Gender: Female, Country: "DE", Age: 25, SocialHours: 1}, false},
+	}
+	for _, tc := range cases {
+		if got := rule.Match(&tc.resp); got != tc.want {
+			t.Errorf("%s: Match = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	not, _ := ParseRule(`NOT country = UK`)
+	if not.Match(&Respondent{Country: "UK"}) || !not.Match(&Respondent{Country: "GR"}) {
+		t.Error("NOT rule evaluated incorrectly")
+	}
+	var none *Rule
+	if !none.Match(&Respondent{}) {
+		t.Error("nil rule should match every respondent")
+	}
+}
+
+func TestRuleJSON(t *testing.T) {
+	var fromString Audience
+	if err := json.Unmarshal([]byte(`{"rules": "country IN (UK, DE) OR age >= 65"}`), &fromString); err != nil {
+		t.Fatalf("unmarshal expression: %v", err)
+	}
+	data, err := json.Marshal(fromString.Rules)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var tree Rule
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("unmarshal tree %s: %v", data, err)
+	}
+	if tree.String() != fromString.Rules.String() {
+		t.Errorf("tree round trip: got %q, want %q", tree.String(), fromString.Rules.String())
+	}
+	if err := json.Unmarshal([]byte(`{"op": "in", "attr": "age", "values": ["1"]}`), &tree); err == nil {
+		t.Error("expected validation error for set predicate on numeric attribute")
+	}
+}
@@ -0,0 +1,947 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schema is a JSON Schema, as used by OpenAPI 3.1
+type schema = map[string]interface{}
+
+// apiOperation describes an operation of the HTTP API. The OpenAPI document
+// is generated from these and from the Go types the handlers encode.
+type apiOperation struct {
+	method, path, summary, tag string
+	// auth is "user" (the default), "admin" or "none"
+	auth   string
+	params []apiParam
+	// request is the JSON body: a Go value whose type is described, or a schema
+	request interface{}
+	// requestTypes are bodies of other media types
+	requestTypes map[string]schema
+	responses    map[int]apiBody
+}
+
+type apiParam struct {
+	name, in, description string
+	required              bool
+	schema                schema
+}
+
+// apiBody is a response: a JSON body, described like apiOperation.request,
+// a body of other media types, or none
+type apiBody struct {
+	description string
+	json        interface{}
+	mediaTypes  []string
+}
+
+var (
+	assetIDParam = apiParam{name: "asset_id", in: "query", required: true, schema: uuidSchema()}
+	userIDParam  = apiParam{name: "user_id", in: "query", required: true, schema: uuidSchema()}
+)
+
+func pathParam(name string) apiParam {
+	return apiParam{name: name, in: "path", required: true, schema: uuidSchema()}
+}
+
+func uuidSchema() schema { return schema{"type": "string", "format": "uuid"} }
+
+func enumSchema(values ...string) schema {
+	return schema{"type": "string", "enum": values}
+}
+
+func asJSON(description string, v interface{}) apiBody {
+	return apiBody{description: description, json: v}
+}
+
+var noContent = apiBody{description: "No content"}
+
+// assetBody is the JSON of any asset
+var assetBody = asJSON("The asset", (*Asset)(nil))
+
+var assetsBody = asJSON("The assets", []Asset{})
+
+// assetRequest is a new asset: its type, and the fields of that type
+type assetRequest struct {
+	Type  string                 `json:"type" openapi:"required,enum=chart|insight|audience"`
+	Asset map[string]interface{} `json:"asset" openapi:"required"`
+}
+
+// apiOperations lists every operation served by setupRoutes
+var apiOperations = []apiOperation{
+	{method: "POST", path: "/token", summary: "Issue a JWT for a user", tag: "auth", auth: "none",
+		request: struct {
+			UserID uuid.UUID `json:"user_id" openapi:"required"`
+		}{},
+		responses: map[int]apiBody{200: asJSON("The token", struct {
+			Token string `json:"token"`
+		}{})}},
+	{method: "GET", path: "/openapi.json", summary: "This document", tag: "meta", auth: "none",
+		responses: map[int]apiBody{200: asJSON("The OpenAPI document", schema{"type": "object"})}},
+
+	{method: "GET", path: "/favourites", summary: "List the assets marked favourite, pinned first", tag: "favourites",
+		params: []apiParam{
+			{name: "collection", in: "query", schema: uuidSchema()},
+			{name: "tag", in: "query", schema: schema{"type": "string"}},
+			{name: "limit", in: "query", schema: schema{"type": "integer"}},
+			{name: "offset", in: "query", schema: schema{"type": "integer"}},
+			{name: "embed", in: "query", description: "related inlines the assets insights link to", schema: enumSchema("related")},
+		},
+		responses: map[int]apiBody{200: asJSON("The favourites; with embed=related, insights carry their related assets", schema{
+			"type":  "array",
+			"items": schema{"anyOf": []interface{}{ref("Asset"), ref("InsightView")}},
+		})}},
+	{method: "POST", path: "/favourites/add", summary: "Create an asset", tag: "favourites",
+		request: struct {
+			assetRequest
+			Favorite bool `json:"favorite"`
+		}{},
+		responses: map[int]apiBody{201: assetBody}},
+	{method: "PUT", path: "/favourites/remove", summary: "Set the favourite flag of an asset", tag: "favourites",
+		params: []apiParam{assetIDParam},
+		request: struct {
+			Favorite bool `json:"favorite"`
+		}{},
+		responses: map[int]apiBody{200: assetBody}},
+	{method: "PUT", path: "/favourites/edit", summary: "Edit the description of an asset", tag: "favourites",
+		params: []apiParam{assetIDParam},
+		request: struct {
+			Description string `json:"description"`
+		}{},
+		responses: map[int]apiBody{200: assetBody}},
+	{method: "DELETE", path: "/favourites/delete", summary: "Move an asset to the trash", tag: "favourites",
+		params:    []apiParam{assetIDParam},
+		responses: map[int]apiBody{200: asJSON("The remaining assets", []Asset{})}},
+	{method: "GET", path: "/favourites/export", summary: "Export every asset as JSON Lines or CSV", tag: "favourites",
+		params:    []apiParam{{name: "format", in: "query", schema: enumSchema("jsonl", "csv")}},
+		responses: map[int]apiBody{200: {description: "One asset per line", mediaTypes: []string{"application/x-ndjson", "text/csv"}}}},
+	{method: "GET", path: "/favourites/events", summary: "Stream changes to the user's assets as Server-Sent Events", tag: "favourites",
+		params: []apiParam{
+			{name: "Last-Event-ID", in: "header", schema: schema{"type": "integer"}},
+			{name: "last_event_id", in: "query", schema: schema{"type": "integer"}},
+		},
+		responses: map[int]apiBody{200: {description: "Event stream of Event objects", mediaTypes: []string{"text/event-stream"}}}},
+	{method: "POST", path: "/favourites/import", summary: "Import assets from JSON Lines or CSV", tag: "favourites",
+		params: []apiParam{
+			{name: "format", in: "query", schema: enumSchema("jsonl", "csv")},
+			{name: "dry_run", in: "query", schema: schema{"type": "boolean"}},
+			{name: "on_conflict", in: "query", schema: enumSchema(conflictSkip, conflictOverwrite, conflictDuplicate)},
+		},
+		requestTypes: map[string]schema{"application/x-ndjson": {"type": "string"}, "text/csv": {"type": "string"}},
+		responses:    map[int]apiBody{200: asJSON("The import report", ImportReport{})}},
+	{method: "GET", path: "/favourites/{assetId}", summary: "Get an asset owned by or shared with the user", tag: "favourites",
+		params:    []apiParam{pathParam("assetId")},
+		responses: map[int]apiBody{200: assetBody}},
+	{method: "PUT", path: "/favourites/{assetId}", summary: "Replace an asset", tag: "favourites",
+		params:    []apiParam{pathParam("assetId")},
+		request:   schema{"type": "object"},
+		responses: map[int]apiBody{200: assetBody}},
+	{method: "PATCH", path: "/favourites/{assetId}", summary: "Patch an asset with a JSON Merge Patch or a JSON Patch", tag: "favourites",
+		params: []apiParam{pathParam("assetId")},
+		requestTypes: map[string]schema{
+			mergePatchType: {"type": "object"},
+			jsonPatchType:  {"type": "array", "items": schema{"type": "object", "required": []string{"op", "path"}}},
+		},
+		responses: map[int]apiBody{200: assetBody}},
+	{method: "GET", path: "/favourites/{assetId}/size", summary: "Size an audience against the respondent panel", tag: "favourites",
+		params: []apiParam{pathParam("assetId")},
+		responses: map[int]apiBody{200: asJSON("The audience size", struct {
+			AssetID uuid.UUID `json:"asset_id"`
+			AudienceSize
+		}{})}},
+	{method: "PUT", path: "/favourites/{assetId}/tags", summary: "Replace the tags of an asset", tag: "favourites",
+		params: []apiParam{pathParam("assetId")},
+		request: struct {
+			Tags []string `json:"tags"`
+		}{},
+		responses: map[int]apiBody{200: assetBody}},
+	{method: "POST", path: "/favourites/{assetId}/move", summary: "Move an asset before or after another", tag: "favourites",
+		params: []apiParam{pathParam("assetId")},
+		request: struct {
+			Before *uuid.UUID `json:"before"`
+			After  *uuid.UUID `json:"after"`
+		}{},
+		responses: map[int]apiBody{200: assetBody}},
+	{method: "PUT", path: "/favourites/{assetId}/pin", summary: "Pin or unpin an asset", tag: "favourites",
+		params: []apiParam{pathParam("assetId")},
+		request: struct {
+			Pinned bool `json:"pinned"`
+		}{},
+		responses: map[int]apiBody{200: assetBody}},
+	{method: "GET", path: "/favourites/{assetId}/links", summary: "List the public links of an asset", tag: "links",
+		params:    []apiParam{pathParam("assetId")},
+		responses: map[int]apiBody{200: asJSON("The links", []*ShareLink{})}},
+	{method: "POST", path: "/favourites/{assetId}/links", summary: "Create a public link to an asset", tag: "links",
+		params: []apiParam{pathParam("assetId")},
+		request: struct {
+			ExpiresIn string `json:"expires_in"`
+			Password  string `json:"password"`
+		}{},
+		responses: map[int]apiBody{201: asJSON("The link and its token", struct {
+			*ShareLink
+			Token string `json:"token"`
+			URL   string `json:"url"`
+		}{})}},
+	{method: "GET", path: "/favourites/{assetId}/history", summary: "List the revisions of an asset, newest first", tag: "history",
+		params: []apiParam{pathParam("assetId")},
+		responses: map[int]apiBody{200: asJSON("The revisions", []struct {
+			*Revision
+			Changes []FieldChange `json:"changes"`
+		}{})}},
+	{method: "GET", path: "/favourites/{assetId}/diff", summary: "Diff two revisions of an asset", tag: "history",
+		params: []apiParam{
+			pathParam("assetId"),
+			{name: "from", in: "query", required: true, schema: schema{"type": "integer"}},
+			{name: "to", in: "query", schema: schema{"type": "integer"}},
+		},
+		responses: map[int]apiBody{200: asJSON("The changes", struct {
+			From    int           `json:"from"`
+			To      int           `json:"to"`
+			Changes []FieldChange `json:"changes"`
+		}{})}},
+	{method: "POST", path: "/favourites/{assetId}/rollback", summary: "Restore an asset to a prior revision", tag: "history",
+		params: []apiParam{pathParam("assetId")},
+		request: struct {
+			Revision int `json:"revision" openapi:"required"`
+		}{},
+		responses: map[int]apiBody{200: assetBody}},
+
+	{method: "GET", path: "/collections", summary: "List the user's collections", tag: "collections",
+		responses: map[int]apiBody{200: asJSON("The collections", []*Collection{})}},
+	{method: "POST", path: "/collections", summary: "Create a collection", tag: "collections",
+		request: struct {
+			Name string `json:"name" openapi:"required"`
+		}{},
+		responses: map[int]apiBody{201: asJSON("The collection", (*Collection)(nil))}},
+	{method: "GET", path: "/collections/{collectionId}", summary: "Get a collection with its assets", tag: "collections",
+		params: []apiParam{pathParam("collectionId")},
+		responses: map[int]apiBody{200: asJSON("The collection", struct {
+			*Collection
+			Assets []Asset
+		}{})}},
+	{method: "PUT", path: "/collections/{collectionId}", summary: "Rename a collection", tag: "collections",
+		params: []apiParam{pathParam("collectionId")},
+		request: struct {
+			Name string `json:"name" openapi:"required"`
+		}{},
+		responses: map[int]apiBody{200: asJSON("The collection", (*Collection)(nil))}},
+	{method: "DELETE", path: "/collections/{collectionId}", summary: "Delete a collection", tag: "collections",
+		params:    []apiParam{pathParam("collectionId")},
+		responses: map[int]apiBody{204: noContent}},
+	{method: "POST", path: "/collections/{collectionId}/assets", summary: "Add an asset to a collection", tag: "collections",
+		params:    []apiParam{pathParam("collectionId"), assetIDParam},
+		responses: map[int]apiBody{200: asJSON("The collection", (*Collection)(nil))}},
+	{method: "DELETE", path: "/collections/{collectionId}/assets", summary: "Remove an asset from a collection", tag: "collections",
+		params:    []apiParam{pathParam("collectionId"), assetIDParam},
+		responses: map[int]apiBody{200: asJSON("The collection", (*Collection)(nil))}},
+	{method: "GET", path: "/tags", summary: "Autocomplete the user's tags, most used first", tag: "collections",
+		params: []apiParam{
+			{name: "prefix", in: "query", schema: schema{"type": "string"}},
+			{name: "limit", in: "query", schema: schema{"type": "integer"}},
+		},
+		responses: map[int]apiBody{200: asJSON("The tags", []struct {
+			Tag   string `json:"tag"`
+			Count int    `json:"count"`
+		}{})}},
+
+	{method: "GET", path: "/shares", summary: "List the shares the user granted", tag: "sharing",
+		responses: map[int]apiBody{200: asJSON("The shares", []*Share{})}},
+	{method: "POST", path: "/shares", summary: "Share an asset or a collection with a user", tag: "sharing",
+		request: struct {
+			AssetID      uuid.UUID  `json:"asset_id"`
+			CollectionID uuid.UUID  `json:"collection_id"`
+			UserID       uuid.UUID  `json:"user_id" openapi:"required"`
+			Permission   Permission `json:"permission" openapi:"required,enum=read|edit"`
+		}{},
+		responses: map[int]apiBody{
+			200: asJSON("The existing share, updated", (*Share)(nil)),
+			201: asJSON("The new share", (*Share)(nil)),
+		}},
+	{method: "GET", path: "/shares/with-me", summary: "List what is shared with the user", tag: "sharing",
+		responses: map[int]apiBody{200: asJSON("The shares with their assets", []struct {
+			*Share
+			Assets []Asset `json:"assets"`
+		}{})}},
+	{method: "DELETE", path: "/shares/{shareId}", summary: "Revoke a share", tag: "sharing",
+		params:    []apiParam{pathParam("shareId")},
+		responses: map[int]apiBody{204: noContent}},
+	{method: "DELETE", path: "/links/{linkId}", summary: "Revoke a public link", tag: "links",
+		params:    []apiParam{pathParam("linkId")},
+		responses: map[int]apiBody{204: noContent}},
+	{method: "GET", path: "/shared/{token}", summary: "Read the asset of a public link", tag: "links", auth: "none",
+		params: []apiParam{
+			{name: "token", in: "path", required: true, schema: schema{"type": "string"}},
+			{name: "X-Share-Password", in: "header", schema: schema{"type": "string"}},
+		},
+		responses: map[int]apiBody{200: asJSON("The shared asset", struct {
+			Type      string    `json:"type"`
+			Asset     Asset     `json:"asset"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}{})}},
+
+	{method: "GET", path: "/trash", summary: "List the user's trash", tag: "trash",
+		responses: map[int]apiBody{200: asJSON("The trashed assets", []trashView{})}},
+	{method: "DELETE", path: "/trash", summary: "Purge one asset, or the whole trash", tag: "trash",
+		params:    []apiParam{{name: "asset_id", in: "query", schema: uuidSchema()}},
+		responses: map[int]apiBody{204: noContent}},
+	{method: "POST", path: "/trash/restore", summary: "Restore an asset from the trash", tag: "trash",
+		params:    []apiParam{assetIDParam},
+		responses: map[int]apiBody{200: assetBody}},
+
+	{method: "GET", path: "/ws", summary: "Open a WebSocket for subscriptions and mutations", tag: "realtime",
+		params:    []apiParam{{name: "access_token", in: "query", description: "the JWT, for browsers", schema: schema{"type": "string"}}},
+		responses: map[int]apiBody{101: {description: "Switching to the WebSocket protocol"}}},
+	{method: "POST", path: "/graphql", summary: "Run a GraphQL query or mutation", tag: "graphql",
+		request: struct {
+			Query         string                 `json:"query" openapi:"required"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}{},
+		responses: map[int]apiBody{200: asJSON("The GraphQL response", schema{"type": "object"})}},
+	{method: "GET", path: "/graphql", summary: "Run a GraphQL query", tag: "graphql",
+		params: []apiParam{
+			{name: "query", in: "query", required: true, schema: schema{"type": "string"}},
+			{name: "operationName", in: "query", schema: schema{"type": "string"}},
+			{name: "variables", in: "query", description: "JSON object", schema: schema{"type": "string"}},
+		},
+		responses: map[int]apiBody{200: asJSON("The GraphQL response", schema{"type": "object"})}},
+
+	{method: "GET", path: "/orgs", summary: "Get the user's organisation", tag: "organisations",
+		responses: map[int]apiBody{200: asJSON("The organisation", (*Organisation)(nil))}},
+	{method: "POST", path: "/orgs", summary: "Create an organisation owned by the user", tag: "organisations",
+		request: struct {
+			Name string `json:"name" openapi:"required"`
+		}{},
+		responses: map[int]apiBody{201: asJSON("The organisation and a token for its tenant", struct {
+			*Organisation
+			Token string `json:"token"`
+		}{})}},
+	{method: "POST", path: "/orgs/members", summary: "Invite a user to the organisation", tag: "organisations",
+		params:    []apiParam{userIDParam},
+		responses: map[int]apiBody{200: asJSON("The organisation", (*Organisation)(nil))}},
+	{method: "DELETE", path: "/orgs/members", summary: "Remove a member from the organisation", tag: "organisations",
+		params:    []apiParam{userIDParam},
+		responses: map[int]apiBody{200: asJSON("The organisation", (*Organisation)(nil))}},
+	{method: "GET", path: "/orgs/invitations", summary: "List the user's invitations", tag: "organisations",
+		responses: map[int]apiBody{200: asJSON("The invitations", []Invitation{})}},
+	{method: "POST", path: "/orgs/invitations/{orgId}", summary: "Accept an invitation and join the organisation", tag: "organisations",
+		params: []apiParam{pathParam("orgId")},
+		responses: map[int]apiBody{200: asJSON("The organisation and a token for its tenant", struct {
+			*Organisation
+			Token string `json:"token"`
+		}{})}},
+	{method: "DELETE", path: "/orgs/invitations/{orgId}", summary: "Decline an invitation", tag: "organisations",
+		params:    []apiParam{pathParam("orgId")},
+		responses: map[int]apiBody{204: noContent}},
+	{method: "GET", path: "/teams", summary: "List the user's teams", tag: "organisations",
+		responses: map[int]apiBody{200: asJSON("The teams", []*Team{})}},
+	{method: "POST", path: "/teams", summary: "Create a team", tag: "organisations",
+		request: struct {
+			Name    string      `json:"name" openapi:"required"`
+			Members []uuid.UUID `json:"members"`
+		}{},
+		responses: map[int]apiBody{201: asJSON("The team", (*Team)(nil))}},
+	{method: "GET", path: "/teams/{teamId}", summary: "Get a team", tag: "organisations",
+		params:    []apiParam{pathParam("teamId")},
+		responses: map[int]apiBody{200: asJSON("The team", (*Team)(nil))}},
+	{method: "DELETE", path: "/teams/{teamId}", summary: "Delete a team and its workspace", tag: "organisations",
+		params:    []apiParam{pathParam("teamId")},
+		responses: map[int]apiBody{204: noContent}},
+	{method: "POST", path: "/teams/{teamId}/members", summary: "Add a member to a team", tag: "organisations",
+		params:    []apiParam{pathParam("teamId"), userIDParam},
+		responses: map[int]apiBody{200: asJSON("The team", (*Team)(nil))}},
+	{method: "DELETE", path: "/teams/{teamId}/members", summary: "Remove a member from a team", tag: "organisations",
+		params:    []apiParam{pathParam("teamId"), userIDParam},
+		responses: map[int]apiBody{200: asJSON("The team", (*Team)(nil))}},
+	{method: "GET", path: "/teams/{teamId}/assets", summary: "List a team's workspace assets", tag: "organisations",
+		params:    []apiParam{pathParam("teamId")},
+		responses: map[int]apiBody{200: assetsBody}},
+	{method: "POST", path: "/teams/{teamId}/assets", summary: "Add an asset to a team's workspace", tag: "organisations",
+		params:    []apiParam{pathParam("teamId")},
+		request:   assetRequest{},
+		responses: map[int]apiBody{201: assetBody}},
+	{method: "DELETE", path: "/teams/{teamId}/assets", summary: "Delete an asset from a team's workspace", tag: "organisations",
+		params:    []apiParam{pathParam("teamId"), assetIDParam},
+		responses: map[int]apiBody{200: asJSON("The remaining assets", []Asset{})}},
+
+	{method: "GET", path: "/admin/snapshot", summary: "Download a snapshot of the store", tag: "admin", auth: "admin",
+		responses: map[int]apiBody{200: asJSON("The snapshot", snapshotEnvelope{})}},
+	{method: "POST", path: "/admin/snapshot", summary: "Write a snapshot to the configured file", tag: "admin", auth: "admin",
+		responses: map[int]apiBody{200: asJSON("The snapshot written", SnapshotInfo{})}},
+}
+
+// webhookOperations describes the webhook endpoints, served under prefix
+func webhookOperations(prefix, tag, auth string) []apiOperation {
+	return []apiOperation{
+		{method: "GET", path: prefix, summary: "List webhooks", tag: tag, auth: auth,
+			responses: map[int]apiBody{200: asJSON("The webhooks, without their secrets", []*Webhook{})}},
+		{method: "POST", path: prefix, summary: "Register a webhook", tag: tag, auth: auth,
+			request: struct {
+				URL    string   `json:"url" openapi:"required"`
+				Events []string `json:"events"`
+				Secret string   `json:"secret"`
+			}{},
+			responses: map[int]apiBody{201: asJSON("The webhook with its secret", (*Webhook)(nil))}},
+		{method: "GET", path: prefix + "/{webhookId}", summary: "Get a webhook", tag: tag, auth: auth,
+			params:    []apiParam{pathParam("webhookId")},
+			responses: map[int]apiBody{200: asJSON("The webhook", (*Webhook)(nil))}},
+		{method: "DELETE", path: prefix + "/{webhookId}", summary: "Remove a webhook", tag: tag, auth: auth,
+			params:    []apiParam{pathParam("webhookId")},
+			responses: map[int]apiBody{204: noContent}},
+		{method: "GET", path: prefix + "/{webhookId}/deliveries", summary: "List the deliveries of a webhook, newest first", tag: tag, auth: auth,
+			params: []apiParam{
+				pathParam("webhookId"),
+				{name: "status", in: "query", schema: enumSchema(deliveryPending, deliveryDelivered, deliveryDead)},
+			},
+			responses: map[int]apiBody{200: asJSON("The deliveries", []*Delivery{})}},
+		{method: "POST", path: prefix + "/{webhookId}/deliveries/{deliveryId}/retry", summary: "Queue a delivery again", tag: tag, auth: auth,
+			params:    []apiParam{pathParam("webhookId"), pathParam("deliveryId")},
+			responses: map[int]apiBody{202: asJSON("The queued delivery", (*Delivery)(nil))}},
+	}
+}
+
+func init() {
+	apiOperations = append(apiOperations, webhookOperations("/webhooks", "webhooks", "")...)
+	apiOperations = append(apiOperations, webhookOperations("/admin/webhooks", "admin", "admin")...)
+}
+
+// openAPIDocument builds the OpenAPI 3.1 description of the HTTP API
+func openAPIDocument() schema {
+	b := &schemaBuilder{components: schema{}}
+	// Assets have no type field, their required fields tell them apart
+	b.components["Asset"] = schema{"oneOf": []interface{}{
+		b.of(reflect.TypeOf(Chart{}), false),
+		b.of(reflect.TypeOf(Insight{}), false),
+		b.of(reflect.TypeOf(Audience{}), false),
+	}}
+	b.of(reflect.TypeOf(insightView{}), false)
+	b.of(reflect.TypeOf(Event{}), false)
+	paths := schema{}
+	for _, op := range apiOperations {
+		item, ok := paths[op.path].(schema)
+		if !ok {
+			item = schema{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = b.operation(op)
+	}
+	return schema{
+		"openapi":           "3.1.0",
+		"jsonSchemaDialect": "https://json-schema.org/draft/2020-12/schema",
+		"info": schema{
+			"title":       "Favourites API",
+			"version":     "1.0.0",
+			"description": "Users' favourite charts, insights and audiences. Errors are plain text messages.",
+		},
+		"paths":    paths,
+		"security": []interface{}{schema{"userToken": []string{}}, schema{"clientCertificate": []string{}}},
+		"components": schema{
+			"schemas": b.components,
+			"securitySchemes": schema{
+				"userToken":         schema{"type": "http", "scheme": "bearer", "bearerFormat": "JWT", "description": "Issued by POST /token"},
+				"adminToken":        schema{"type": "http", "scheme": "bearer", "description": "The auth.admin_token of the server"},
+				"clientCertificate": schema{"type": "mutualTLS", "description": "A client certificate whose subject tls.client_users maps to a user"},
+			},
+			"responses": schema{
+				"Error":        schema{"description": "Error message", "content": schema{"text/plain": schema{"schema": schema{"type": "string"}}}},
+				"Unauthorized": schema{"description": "Missing or invalid token", "content": schema{"text/plain": schema{"schema": schema{"type": "string"}}}},
+			},
+		},
+	}
+}
+
+func (b *schemaBuilder) operation(op apiOperation) schema {
+	out := schema{
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+		"operationId": operationID(op),
+	}
+	switch op.auth {
+	case "none":
+		out["security"] = []interface{}{}
+	case "admin":
+		out["security"] = []interface{}{schema{"adminToken": []string{}}}
+	}
+	if len(op.params) > 0 {
+		params := make([]interface{}, 0, len(op.params))
+		for _, p := range op.params {
+			param := schema{"name": p.name, "in": p.in, "required": p.required, "schema": p.schema}
+			if p.description != "" {
+				param["description"] = p.description
+			}
+			params = append(params, param)
+		}
+		out["parameters"] = params
+	}
+	content := schema{}
+	if op.request != nil {
+		content["application/json"] = schema{"schema": b.describe(op.request, true)}
+	}
+	for mediaType, s := range op.requestTypes {
+		content[mediaType] = schema{"schema": s}
+	}
+	if len(content) > 0 {
+		out["requestBody"] = schema{"required": true, "content": content}
+	}
+	responses := schema{"default": schema{"$ref": "#/components/responses/Error"}}
+	if op.auth != "none" {
+		responses["401"] = schema{"$ref": "#/components/responses/Unauthorized"}
+	}
+	for status, body := range op.responses {
+		resp := schema{"description": body.description}
+		switch {
+		case body.json != nil:
+			resp["content"] = schema{"application/json": schema{"schema": b.describe(body.json, false)}}
+		case len(body.mediaTypes) > 0:
+			content := schema{}
+			for _, mediaType := range body.mediaTypes {
+				content[mediaType] = schema{"schema": schema{"type": "string"}}
+			}
+			resp["content"] = content
+		}
+		responses[strconv.Itoa(status)] = resp
+	}
+	out["responses"] = responses
+	return out
+}
+
+// operationID derives an ID such as getFavouritesAssetIdHistory
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.method)
+	for _, part := range strings.FieldsFunc(op.path, func(r rune) bool { return strings.ContainsRune("/{}.-_", r) }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func ref(name string) schema { return schema{"$ref": "#/components/schemas/" + name} }
+
+// schemaBuilder derives JSON Schemas from Go types the way encoding/json
+// encodes them. Named structs become components; response schemas list
+// every field without omitempty as required and allow no other field.
+type schemaBuilder struct {
+	components schema
+}
+
+var (
+	uuidType  = reflect.TypeOf(uuid.UUID{})
+	timeType  = reflect.TypeOf(time.Time{})
+	rawType   = reflect.TypeOf(json.RawMessage{})
+	assetType = reflect.TypeOf((*Asset)(nil)).Elem()
+)
+
+// describe returns the schema of v, which is a schema or a value of the
+// described type
+func (b *schemaBuilder) describe(v interface{}, request bool) schema {
+	if s, ok := v.(schema); ok {
+		return s
+	}
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Interface {
+		t = t.Elem()
+	}
+	return b.of(t, request)
+}
+
+func (b *schemaBuilder) of(t reflect.Type, request bool) schema {
+	switch {
+	case t == uuidType:
+		return uuidSchema()
+	case t == timeType:
+		return schema{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return schema{}
+	case t == assetType:
+		return ref("Asset")
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schema{"anyOf": []interface{}{b.of(t.Elem(), request), schema{"type": "null"}}}
+	case reflect.Interface:
+		return schema{}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return schema{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return schema{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+		}
+		return schema{"type": []string{"array", "null"}, "items": b.of(t.Elem(), request)}
+	case reflect.Map:
+		return schema{"type": []string{"object", "null"}, "additionalProperties": b.of(t.Elem(), request)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t, request)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := b.components[name]; !ok {
+			// Reserve the name first, the type may refer to itself
+			b.components[name] = schema{}
+			b.components[name] = b.object(t, request)
+		}
+		return ref(name)
+	}
+	return schema{}
+}
+
+// object describes a struct
+func (b *schemaBuilder) object(t reflect.Type, request bool) schema {
+	props := schema{}
+	required := []string{}
+	b.fields(t, request, props, &required)
+	sort.Strings(required)
+	out := schema{"type": "object", "properties": props}
+	if !request {
+		out["required"] = required
+		out["additionalProperties"] = false
+	} else if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// fields adds the properties encoding/json writes for the struct, promoting
+// those of untagged embedded structs unless a shallower field has the name
+func (b *schemaBuilder) fields(t reflect.Type, request bool, props schema, required *[]string) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := b.of(f.Type, request)
+		openapi := strings.Split(f.Tag.Get("openapi"), ",")
+		for _, opt := range openapi {
+			if values, ok := strings.CutPrefix(opt, "enum="); ok {
+				s = schema{"type": "string", "enum": strings.Split(values, "|")}
+			}
+		}
+		props[name] = s
+		if request && contains(openapi, "required") || !request && !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+	for _, et := range embedded {
+		inner := schema{}
+		var innerRequired []string
+		b.fields(et, request, inner, &innerRequired)
+		for name, s := range inner {
+			if _, ok := props[name]; !ok {
+				props[name] = s
+				if contains(innerRequired, name) {
+					*required = append(*required, name)
+				}
+			}
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// apiMaxValidatedBody bounds the request bodies validateAPI reads
+const apiMaxValidatedBody = 1 << 20
+
+// errBodyTooLarge rejects a JSON body over apiMaxValidatedBody, which could
+// not be validated
+var errBodyTooLarge = fmt.Errorf("body larger than %d bytes", apiMaxValidatedBody)
+
+var (
+	openAPIOnce sync.Once
+	openAPISpec []byte
+	// apiValidators are the compiled operations, by method
+	apiValidators map[string][]*apiValidator
+)
+
+// openAPIViolation reports a response that does not match the document
+var openAPIViolation = func(format string, args ...interface{}) { log.Printf(format, args...) }
+
+// apiValidator checks requests and responses against one operation
+type apiValidator struct {
+	op        apiOperation
+	segments  []string
+	literals  int
+	request   *jsonschema.Schema
+	responses map[int]*jsonschema.Schema
+	// buffered is set when every success response is JSON or empty
+	buffered bool
+}
+
+// loadOpenAPI marshals the document and compiles its schemas once
+func loadOpenAPI() {
+	openAPIOnce.Do(func() {
+		spec, err := json.Marshal(openAPIDocument())
+		if err != nil {
+			log.Fatalf("openapi: marshalling: %v", err)
+		}
+		openAPISpec = spec
+		compiler := jsonschema.NewCompiler()
+		compiler.Draft = jsonschema.Draft2020
+		compiler.AssertFormat = true
+		if err := compiler.AddResource("openapi.json", bytes.NewReader(spec)); err != nil {
+			log.Fatalf("openapi: %v", err)
+		}
+		compile := func(pointer ...string) *jsonschema.Schema {
+			for n, token := range pointer {
+				pointer[n] = strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+			}
+			s, err := compiler.Compile("openapi.json#/" + strings.Join(pointer, "/"))
+			if err != nil {
+				log.Fatalf("openapi: %v", err)
+			}
+			return s
+		}
+		apiValidators = map[string][]*apiValidator{}
+		for _, op := range apiOperations {
+			v := &apiValidator{op: op, segments: strings.Split(strings.Trim(op.path, "/"), "/"), responses: map[int]*jsonschema.Schema{}, buffered: true}
+			for _, segment := range v.segments {
+				if !strings.HasPrefix(segment, "{") {
+					v.literals++
+				}
+			}
+			method := strings.ToLower(op.method)
+			if op.request != nil {
+				v.request = compile("paths", op.path, method, "requestBody", "content", "application/json", "schema")
+			}
+			for status, body := range op.responses {
+				if body.json != nil {
+					v.responses[status] = compile("paths", op.path, method, "responses", strconv.Itoa(status), "content", "application/json", "schema")
+				}
+				if len(body.mediaTypes) > 0 || status == http.StatusSwitchingProtocols {
+					v.buffered = false
+				}
+			}
+			apiValidators[op.method] = append(apiValidators[op.method], v)
+		}
+	})
+}
+
+// Serves the OpenAPI document: GET /openapi.json
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleOpenAPI: method %s not allowed", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	loadOpenAPI()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// matchOperation finds the operation serving the request, preferring literal
+// path segments over parameters
+func matchOperation(method, path string) *apiValidator {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var best *apiValidator
+	for _, v := range apiValidators[method] {
+		if len(v.segments) != len(segments) || (best != nil && best.literals >= v.literals) {
+			continue
+		}
+		matched := true
+		for n, segment := range v.segments {
+			if !strings.HasPrefix(segment, "{") && segment != segments[n] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			best = v
+		}
+	}
+	return best
+}
+
+// validateAPI rejects requests that do not match the OpenAPI document, and
+// reports responses that do not through openAPIViolation. Requests of
+// undocumented routes pass through.
+func validateAPI(next http.Handler) http.Handler {
+	loadOpenAPI()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := matchOperation(r.Method, r.URL.Path)
+		// Unauthenticated requests are left to the handlers to reject
+		if v == nil || (v.op.auth != "none" && !hasCredentials(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := v.checkRequest(r); err != nil {
+			log.Printf("validateAPI: %s %s: %v", r.Method, r.URL.Path, err)
+			status := http.StatusBadRequest
+			if errors.Is(err, errBodyTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, "Invalid request: "+err.Error(), status)
+			return
+		}
+		if !v.buffered {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buf := &bufferedResponse{header: w.Header()}
+		next.ServeHTTP(buf, r)
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+		if err := v.checkResponse(buf.status, buf.body.Bytes()); err != nil {
+			openAPIViolation("validateAPI: %s %s: response %d: %v", r.Method, r.URL.Path, buf.status, err)
+		}
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+	})
+}
+
+func (v *apiValidator) checkRequest(r *http.Request) error {
+	query := r.URL.Query()
+	for _, p := range v.op.params {
+		if p.in != "query" {
+			continue
+		}
+		value, present := query.Get(p.name), query.Has(p.name)
+		if !present {
+			if p.required {
+				return fmt.Errorf("query parameter %s is required", p.name)
+			}
+			continue
+		}
+		if err := checkParam(p.schema, value); err != nil {
+			return fmt.Errorf("query parameter %s: %v", p.name, err)
+		}
+	}
+	if v.request == nil {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if _, ok := v.op.requestTypes[mediaType]; ok {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, apiMaxValidatedBody+1))
+	if err != nil {
+		return fmt.Errorf("reading body: %v", err)
+	}
+	if len(body) > apiMaxValidatedBody {
+		return errBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		return errors.New("a JSON body is required")
+	}
+	instance, err := decodeJSONValue(body)
+	if err != nil {
+		return fmt.Errorf("body: %v", err)
+	}
+	return schemaError(v.request.Validate(instance))
+}
+
+func (v *apiValidator) checkResponse(status int, body []byte) error {
+	if status >= 300 {
+		return nil
+	}
+	if _, ok := v.op.responses[status]; !ok {
+		return fmt.Errorf("undocumented status")
+	}
+	s, ok := v.responses[status]
+	if !ok {
+		if len(body) > 0 {
+			return errors.New("undocumented body")
+		}
+		return nil
+	}
+	instance, err := decodeJSONValue(body)
+	if err != nil {
+		return fmt.Errorf("body: %v", err)
+	}
+	return schemaError(s.Validate(instance))
+}
+
+// checkParam checks a query parameter against its scalar schema
+func checkParam(s schema, value string) error {
+	if values, ok := s["enum"].([]string); ok && !contains(values, value) {
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+	switch s["type"] {
+	case "integer":
+		if _, err := strconv.Atoi(value); err != nil {
+			return errors.New("must be an integer")
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("must be a boolean")
+		}
+	}
+	return nil
+}
+
+func decodeJSONValue(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// schemaError reduces a validation error to its deepest cause
+func schemaError(err error) error {
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	for len(ve.Causes) > 0 {
+		ve = ve.Causes[0]
+	}
+	location := ve.InstanceLocation
+	if location == "" {
+		location = "/"
+	}
+	return fmt.Errorf("%s: %s", location, ve.Message)
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// routePatterns returns the patterns setupRoutes registers, read from its source
+func routePatterns(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "handlers.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parsing handlers.go: %v", err)
+	}
+	var patterns []string
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "setupRoutes" {
+			continue
+		}
+		ast.Inspect(fn, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "HandleFunc" {
+				return true
+			}
+			lit := call.Args[0].(*ast.BasicLit)
+			pattern, _ := strconv.Unquote(lit.Value)
+			patterns = append(patterns, pattern)
+			return true
+		})
+	}
+	return patterns
+}
+
+func TestOpenAPI_DescribesEveryRoute(t *testing.T) {
+	patterns := routePatterns(t)
+	if len(patterns) == 0 {
+		t.Fatal("found no routes in setupRoutes")
+	}
+	// servedBy is the most specific pattern serving a path, as ServeMux picks it
+	servedBy := func(path string) string {
+		best := ""
+		for _, pattern := range patterns {
+			if (pattern == path || strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern)) && len(pattern) > len(best) {
+				best = pattern
+			}
+		}
+		return best
+	}
+	described := map[string]bool{}
+	for _, op := range apiOperations {
+		path := strings.NewReplacer("{", "", "}", "").Replace(op.path)
+		pattern := servedBy(path)
+		if pattern == "" {
+			t.Errorf("%s %s is documented but not served", op.method, op.path)
+		}
+		described[pattern] = true
+	}
+	for _, pattern := range patterns {
+		if !described[pattern] {
+			t.Errorf("route %s is served but not documented", pattern)
+		}
+	}
+}
+
+func TestOpenAPI_Document(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleOpenAPI(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc struct {
+		OpenAPI    string
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				OneOf []map[string]string
+			}
+		}
+	}
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" || len(doc.Paths) == 0 {
+		t.Errorf("unexpected document %+v", doc)
+	}
+	if asset := doc.Components.Schemas["Asset"]; len(asset.OneOf) != 3 || asset.OneOf[1]["$ref"] != "#/components/schemas/Insight" {
+		t.Errorf("expected Asset to be one of the asset types, got %+v", asset)
+	}
+	if _, ok := doc.Paths["/favourites/{assetId}"]["patch"]; !ok {
+		t.Error("expected PATCH /favourites/{assetId}")
+	}
+}
+
+func TestValidateAPI_RejectsInvalidRequests(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+	handled := false
+	handler := validateAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handled = true }))
+
+	cases := []struct{ method, target, body, detail string }{
+		{http.MethodPost, "/collections", `{"name": 5}`, "/name"},
+		{http.MethodPost, "/collections", ``, "body is required"},
+		{http.MethodPost, "/shares", `{"user_id": "` + uuid.NewString() + `", "permission": "own"}`, "/permission"},
+		{http.MethodPut, "/favourites/remove", `{"favorite": true}`, "asset_id is required"},
+		{http.MethodGet, "/favourites?limit=ten", ``, "must be an integer"},
+		{http.MethodGet, "/webhooks/" + uuid.NewString() + "/deliveries?status=lost", ``, "must be one of"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), c.detail) {
+			t.Errorf("%s %s: expected a 400 mentioning %q, got %d %s", c.method, c.target, c.detail, w.Code, w.Body)
+		}
+	}
+	if handled {
+		t.Error("expected invalid requests not to reach the handler")
+	}
+}
+
+func TestValidateAPI_RejectsOversizeBodies(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+	handled := false
+	handler := validateAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handled = true }))
+
+	// A body too large to validate must not get past the validator
+	body := `{"name": "` + strings.Repeat("a", apiMaxValidatedBody) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/collections", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || handled {
+		t.Errorf("expected status %d before the handler, got %d (handled %v)", http.StatusRequestEntityTooLarge, w.Code, handled)
+	}
+}
+
+func TestValidateAPI_ReportsDivergentResponses(t *testing.T) {
+	var violations []string
+	defer func(report func(string, ...interface{})) { openAPIViolation = report }(openAPIViolation)
+	openAPIViolation = func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+
+	responses := map[string]func(w http.ResponseWriter){
+		"/collections":   func(w http.ResponseWriter) { w.Write([]byte(`[{"ID": "` + uuid.NewString() + `", "Name": "x"}]`)) },
+		"/tags":          func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated); w.Write([]byte(`[]`)) },
+		"/favourites":    func(w http.ResponseWriter) { w.Write([]byte(`[{"ID": "` + uuid.NewString() + `", "Color": "red"}]`)) },
+		"/trash/restore": func(w http.ResponseWriter) { http.Error(w, "Asset not found", http.StatusNotFound) },
+	}
+	handler := validateAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { responses[r.URL.Path](w) }))
+	for path := range responses {
+		method := http.MethodGet
+		if path == "/trash/restore" {
+			method = http.MethodPost
+			path += "?asset_id=" + uuid.NewString()
+		}
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer x")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if strings.HasPrefix(path, "/trash") && w.Code != http.StatusNotFound {
+			t.Errorf("expected the response passed on, got %d", w.Code)
+		}
+	}
+	if len(violations) != 3 {
+		t.Fatalf("expected 3 violations, got %q", violations)
+	}
+	for _, want := range []string{"GET /collections: response 200: /0: missing properties", "undocumented status", "GET /favourites: response 200: /0"} {
+		found := false
+		for _, v := range violations {
+			found = found || strings.Contains(v, want)
+		}
+		if !found {
+			t.Errorf("expected a violation mentioning %q in %q", want, violations)
+		}
+	}
+}
+
+// apiClient calls the server behind validateAPI, recording the operations used
+type apiClient struct {
+	t       *testing.T
+	server  *httptest.Server
+	covered map[string]bool
+}
+
+func (c *apiClient) do(token, method, target, contentType, body string, want int) []byte {
+	c.t.Helper()
+	req, _ := http.NewRequest(method, c.server.URL+target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if strings.HasPrefix(target, "/shared/") {
+		req.Header.Set("X-Share-Password", "secret")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, target, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		c.t.Fatalf("%s %s: expected status %d, got %d %s", method, target, want, resp.StatusCode, data)
+	}
+	if v := matchOperation(method, strings.SplitN(target, "?", 2)[0]); v != nil {
+		c.covered[v.op.method+" "+v.op.path] = true
+	}
+	return data
+}
+
+func (c *apiClient) id(data []byte, field string) string {
+	c.t.Helper()
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		c.t.Fatalf("decoding %s: %v", data, err)
+	}
+	return fmt.Sprint(obj[field])
+}
+
+// Exercises every operation through validateAPI, failing on any response
+// that diverges from the document
+func TestOpenAPI_HandlersMatchDocument(t *testing.T) {
+	resetStore()
+	defer func(report func(string, ...interface{})) { openAPIViolation = report }(openAPIViolation)
+	openAPIViolation = func(format string, args ...interface{}) { t.Errorf(format, args...) }
+	panel = loadTestPanel(t)
+	adminToken, snapshotPath = "operator-secret", filepath.Join(t.TempDir(), "store.snapshot")
+	defer func() { panel, adminToken, snapshotPath = nil, "", "" }()
+
+	mux := http.NewServeMux()
+	setupRoutes(mux)
+	server := httptest.NewServer(validateAPI(mux))
+	defer server.Close()
+	c := &apiClient{t: t, server: server, covered: map[string]bool{}}
+	userID, otherID := uuid.New(), uuid.New()
+	store.AddUser(&User{ID: userID})
+	store.AddUser(&User{ID: otherID})
+	other, _ := GenerateJWT(otherID)
+
+	token := c.id(c.do("", "POST", "/token", "", `{"user_id": "`+userID.String()+`"}`, 200), "token")
+	c.do("", "GET", "/openapi.json", "", "", 200)
+
+	chart := c.id(c.do(token, "POST", "/favourites/add", "", `{"type": "chart", "asset": {"Title": "Sales", "Data": [1, 2]}, "favorite": true}`, 201), "ID")
+	insight := c.id(c.do(token, "POST", "/favourites/add", "", `{"type": "insight", "asset": {"Text": "Up", "RelatedAssets": ["`+chart+`"]}, "favorite": true}`, 201), "ID")
+	audience := c.id(c.do(token, "POST", "/favourites/add", "", `{"type": "audience", "asset": {"Rules": {"op": "in", "attr": "country", "values": ["UK"]}}}`, 201), "ID")
+	c.do(token, "GET", "/favourites?embed=related&limit=10&offset=0", "", "", 200)
+	c.do(token, "PUT", "/favourites/remove?asset_id="+audience, "", `{"favorite": true}`, 200)
+	c.do(token, "PUT", "/favourites/edit?asset_id="+chart, "", `{"description": "Monthly"}`, 200)
+	c.do(token, "GET", "/favourites/export?format=csv", "", "", 200)
+	c.do(token, "POST", "/favourites/import?dry_run=true", "application/x-ndjson", `{"type": "chart", "asset": {"Title": "Costs"}}`, 200)
+
+	c.do(token, "GET", "/favourites/"+chart, "", "", 200)
+	c.do(token, "PUT", "/favourites/"+chart, "", `{"Title": "Revenue", "Data": [3]}`, 200)
+	c.do(token, "PATCH", "/favourites/"+chart, mergePatchType, `{"YAxisTitle": "GBP"}`, 200)
+	c.do(token, "GET", "/favourites/"+audience+"/size", "", "", 200)
+	c.do(token, "PUT", "/favourites/"+chart+"/tags", "", `{"tags": ["finance"]}`, 200)
+	c.do(token, "POST", "/favourites/"+chart+"/move", "", `{"after": "`+insight+`"}`, 200)
+	c.do(token, "PUT", "/favourites/"+chart+"/pin", "", `{"pinned": true}`, 200)
+	c.do(token, "GET", "/favourites/"+chart+"/history", "", "", 200)
+	c.do(token, "GET", "/favourites/"+chart+"/diff?from=1", "", "", 200)
+	c.do(token, "POST", "/favourites/"+chart+"/rollback", "", `{"revision": 1}`, 200)
+
+	link := c.do(token, "POST", "/favourites/"+chart+"/links", "", `{"expires_in": "1h", "password": "secret"}`, 201)
+	c.do(token, "GET", "/favourites/"+chart+"/links", "", "", 200)
+	c.do("", "GET", "/shared/"+c.id(link, "token"), "", "", 200)
+	c.do(token, "DELETE", "/links/"+c.id(link, "id"), "", "", 204)
+
+	collection := c.id(c.do(token, "POST", "/collections", "", `{"name": "Reports"}`, 201), "ID")
+	c.do(token, "GET", "/collections", "", "", 200)
+	c.do(token, "PUT", "/collections/"+collection, "", `{"name": "Monthly reports"}`, 200)
+	c.do(token, "POST", "/collections/"+collection+"/assets?asset_id="+chart, "", "", 200)
+	c.do(token, "GET", "/collections/"+collection, "", "", 200)
+	c.do(token, "DELETE", "/collections/"+collection+"/assets?asset_id="+chart, "", "", 200)
+	c.do(token, "DELETE", "/collections/"+collection, "", "", 204)
+	c.do(token, "GET", "/tags?prefix=fin&limit=5", "", "", 200)
+
+	share := c.id(c.do(token, "POST", "/shares", "", `{"asset_id": "`+chart+`", "user_id": "`+otherID.String()+`", "permission": "read"}`, 201), "id")
+	c.do(token, "POST", "/shares", "", `{"asset_id": "`+chart+`", "user_id": "`+otherID.String()+`", "permission": "edit"}`, 200)
+	c.do(token, "GET", "/shares", "", "", 200)
+	c.do(other, "GET", "/shares/with-me", "", "", 200)
+	c.do(token, "DELETE", "/shares/"+share, "", "", 204)
+
+	c.do(token, "DELETE", "/favourites/delete?asset_id="+insight, "", "", 200)
+	c.do(token, "GET", "/trash", "", "", 200)
+	c.do(token, "POST", "/trash/restore?asset_id="+insight, "", "", 200)
+	c.do(token, "DELETE", "/favourites/delete?asset_id="+insight, "", "", 200)
+	c.do(token, "DELETE", "/trash?asset_id="+insight, "", "", 204)
+
+	c.do(token, "POST", "/graphql", "", `{"query": "{ favourites { totalCount } }"}`, 200)
+	c.do(token, "GET", "/graphql?query=%7B%20assets%20%7B%20totalCount%20%7D%20%7D", "", "", 200)
+
+	for _, w := range []struct{ token, prefix string }{{token, "/webhooks"}, {adminToken, "/admin/webhooks"}} {
+		webhook := c.id(c.do(w.token, "POST", w.prefix, "", `{"url": "http://127.0.0.1:1/hook", "events": ["updated"]}`, 201), "id")
+		c.do(w.token, "GET", w.prefix, "", "", 200)
+		c.do(w.token, "GET", w.prefix+"/"+webhook, "", "", 200)
+		delivery := &Delivery{ID: uuid.New(), WebhookID: uuid.MustParse(webhook), Event: "updated", Payload: json.RawMessage(`{}`), Status: deliveryDead, CreatedAt: time.Now().UTC()}
+		store.PutDelivery(delivery)
+		c.do(w.token, "GET", w.prefix+"/"+webhook+"/deliveries?status=dead", "", "", 200)
+		c.do(w.token, "POST", w.prefix+"/"+webhook+"/deliveries/"+delivery.ID.String()+"/retry", "", "", 202)
+		c.do(w.token, "DELETE", w.prefix+"/"+webhook, "", "", 204)
+	}
+	c.do(adminToken, "GET", "/admin/snapshot", "", "", 200)
+	c.do(adminToken, "POST", "/admin/snapshot", "", "", 200)
+
+	created := c.do(token, "POST", "/orgs", "", `{"name": "Acme"}`, 201)
+	orgToken, org := c.id(created, "token"), c.id(created, "id")
+	c.do(orgToken, "GET", "/orgs", "", "", 200)
+	c.do(orgToken, "POST", "/orgs/members?user_id="+otherID.String(), "", "", 200)
+	c.do(other, "GET", "/orgs/invitations", "", "", 200)
+	c.do(other, "DELETE", "/orgs/invitations/"+org, "", "", 204)
+	c.do(orgToken, "POST", "/orgs/members?user_id="+otherID.String(), "", "", 200)
+	c.do(other, "POST", "/orgs/invitations/"+org, "", "", 200)
+	team := c.id(c.do(orgToken, "POST", "/teams", "", `{"name": "Research", "members": ["`+otherID.String()+`"]}`, 201), "id")
+	c.do(orgToken, "GET", "/teams", "", "", 200)
+	c.do(orgToken, "GET", "/teams/"+team, "", "", 200)
+	c.do(orgToken, "POST", "/teams/"+team+"/members?user_id="+userID.String(), "", "", 200)
+	teamAsset := c.id(c.do(orgToken, "POST", "/teams/"+team+"/assets", "", `{"type": "chart", "asset": {"Title": "Team"}}`, 201), "ID")
+	c.do(orgToken, "GET", "/teams/"+team+"/assets", "", "", 200)
+	c.do(orgToken, "DELETE", "/teams/"+team+"/assets?asset_id="+teamAsset, "", "", 200)
+	c.do(orgToken, "DELETE", "/teams/"+team+"/members?user_id="+otherID.String(), "", "", 200)
+	c.do(orgToken, "DELETE", "/teams/"+team, "", "", 204)
+	c.do(orgToken, "DELETE", "/orgs/members?user_id="+otherID.String(), "", "", 200)
+
+	// Streams are not buffered, so their bodies are not validated
+	streaming := map[string]bool{"GET /favourites/events": true, "GET /ws": true}
+	for _, op := range apiOperations {
+		if key := op.method + " " + op.path; !c.covered[key] && !streaming[key] {
+			t.Errorf("%s is not exercised", key)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Favourites are ordered by a gap-based rank: new assets are appended
+// positionGap after the last one and a move takes the midpoint of its new
+// neighbours, so a reorder writes a single position. Only when two
+// neighbours get too close are the positions of the user renumbered.
+const (
+	positionGap    = 1024.0
+	minPositionGap = 1e-6
+)
+
+var errPinGroup = errors.New("cannot move relative to an asset with a different pinned state")
+
+// sortedFavourites returns the user's assets, pinned first, then by position
+func sortedFavourites(user *User) []Asset {
+	return sortAssets(store.FavouritesOf(user))
+}
+
+// sortAssets returns the assets pinned first, then by position. Assets with
+// equal positions keep their insertion order.
+func sortAssets(assets []Asset) []Asset {
+	sorted := make([]Asset, len(assets))
+	copy(sorted, assets)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].IsPinned() != sorted[j].IsPinned() {
+			return sorted[i].IsPinned()
+		}
+		return sorted[i].GetPosition() < sorted[j].GetPosition()
+	})
+	return sorted
+}
+
+// nextPosition returns the position placing an asset after all others of its
+// pin group. The caller holds store.mu.
+func nextPosition(user *User, pinned bool) float64 {
+	pos, found := 0.0, false
+	for _, asset := range user.Favourites {
+		if asset.IsPinned() == pinned && (!found || asset.GetPosition() > pos) {
+			pos, found = asset.GetPosition(), true
+		}
+	}
+	if !found {
+		return positionGap
+	}
+	return pos + positionGap
+}
+
+// renumberPositions spreads the user's positions positionGap apart, keeping
+// the current order. The caller holds store.mu.
+func renumberPositions(user *User) {
+	rank := make(map[uuid.UUID]int, len(user.Favourites))
+	for n, asset := range sortAssets(user.Favourites) {
+		rank[asset.GetID()] = n
+	}
+	favourites := make([]Asset, len(user.Favourites))
+	for n, asset := range user.Favourites {
+		favourites[n] = copyAsset(asset)
+		favourites[n].SetPosition(float64(rank[asset.GetID()]+1) * positionGap)
+	}
+	user.Favourites = favourites
+}
+
+// moveAsset places asset right before (or after) the reference asset and
+// returns it as stored. The caller holds store.mu.
+func moveAsset(user *User, asset, ref Asset, after bool) (Asset, error) {
+	if asset.IsPinned() != ref.IsPinned() {
+		return nil, errPinGroup
+	}
+	if asset.GetID() == ref.GetID() {
+		return asset, nil
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		group := make([]Asset, 0, len(user.Favourites))
+		for _, a := range sortAssets(user.Favourites) {
+			if a.IsPinned() == asset.IsPinned() && a.GetID() != asset.GetID() {
+				group = append(group, a)
+			}
+		}
+		i := 0
+		for i < len(group) && group[i].GetID() != ref.GetID() {
+			i++
+		}
+		var prev, next Asset
+		if after {
+			prev = group[i]
+			if i+1 < len(group) {
+				next = group[i+1]
+			}
+		} else {
+			next = group[i]
+			if i > 0 {
+				prev = group[i-1]
+			}
+		}
+		var pos float64
+		switch {
+		case prev == nil:
+			pos = next.GetPosition() - positionGap
+		case next == nil:
+			pos = prev.GetPosition() + positionGap
+		case next.GetPosition()-prev.GetPosition() > minPositionGap:
+			pos = (prev.GetPosition() + next.GetPosition()) / 2
+		default:
+			renumberPositions(user)
+			continue
+		}
+		moved := copyAsset(lookupAsset(user.Favourites, asset.GetID()))
+		moved.SetPosition(pos)
+		putAsset(user, moved)
+		return moved, nil
+	}
+	return nil, errors.New("could not find a free position")
+}
+
+// Moves an asset before or after another one: {"before": "<id>"} or {"after": "<id>"}
+func handleMoveFavourite(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	if r.Method != http.MethodPost {
+		log.Printf("handleMoveFavourite: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleMoveFavourite")
+	if !ok {
+		return
+	}
+	var req struct {
+		Before *uuid.UUID `json:"before"`
+		After  *uuid.UUID `json:"after"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Before == nil) == (req.After == nil) {
+		log.Printf("handleMoveFavourite: invalid request body: %v", err)
+		http.Error(w, "Request must set exactly one of before or after", http.StatusBadRequest)
+		return
+	}
+	if findAsset(user, assetID) == nil {
+		log.Printf("handleMoveFavourite: asset not found %s", assetID)
+		http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+		return
+	}
+	refID := req.Before
+	if req.After != nil {
+		refID = req.After
+	}
+	if findAsset(user, *refID) == nil {
+		log.Printf("handleMoveFavourite: reference asset not found %s", *refID)
+		http.Error(w, "Reference asset not found in favourites", http.StatusNotFound)
+		return
+	}
+	asset, err := store.MoveAsset(user, assetID, *refID, req.After != nil)
+	if errors.Is(err, errAssetNotFound) {
+		log.Printf("handleMoveFavourite: asset %s or %s removed meanwhile", assetID, *refID)
+		http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("handleMoveFavourite: %v", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("handleMoveFavourite: moved asset %s to position %v", assetID, asset.GetPosition())
+	notify(user, EventUpdated, asset)
+	json.NewEncoder(w).Encode(asset)
+}
+
+// Pins or unpins an asset; pinned assets are always listed first
+func handlePinFavourite(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	if r.Method != http.MethodPut {
+		log.Printf("handlePinFavourite: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handlePinFavourite")
+	if !ok {
+		return
+	}
+	var req struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("handlePinFavourite: invalid request body: %v", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	asset, changed := store.PinAsset(user, assetID, req.Pinned)
+	if asset == nil {
+		log.Printf("handlePinFavourite: asset not found %s", assetID)
+		http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+		return
+	}
+	if changed {
+		log.Printf("handlePinFavourite: set pinned for asset %s to %v", assetID, req.Pinned)
+		notify(user, EventUpdated, asset)
+	}
+	json.NewEncoder(w).Encode(asset)
+}
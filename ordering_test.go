@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func listTitles(t *testing.T, token string) []string {
+	t.Helper()
+	w := doRequest(t, handleFavourites, token, http.MethodGet, "/favourites", nil)
+	var list []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	titles := make([]string, len(list))
+	for i, a := range list {
+		titles[i], _ = a["Title"].(string)
+	}
+	return titles
+}
+
+func assertOrder(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected order %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected order %v, got %v", want, got)
+		}
+	}
+}
+
+func TestMoveAndPinFavourites(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+	ids := make(map[string]uuid.UUID)
+	for _, title := range []string{"A", "B", "C", "D"} {
+		w := doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{
+			"type": ChartType, "favorite": true, "asset": map[string]string{"title": title},
+		})
+		var c Chart
+		json.NewDecoder(w.Body).Decode(&c)
+		ids[title] = c.ID
+	}
+	assertOrder(t, listTitles(t, token), "A", "B", "C", "D")
+
+	move := func(title, where, ref string) int {
+		w := doRequest(t, handleFavouriteByID, token, http.MethodPost, "/favourites/"+ids[title].String()+"/move", map[string]uuid.UUID{where: ids[ref]})
+		return w.Code
+	}
+	if code := move("D", "before", "A"); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	assertOrder(t, listTitles(t, token), "D", "A", "B", "C")
+	move("A", "after", "C")
+	assertOrder(t, listTitles(t, token), "D", "B", "C", "A")
+	move("D", "after", "B")
+	assertOrder(t, listTitles(t, token), "B", "D", "C", "A")
+
+	w := doRequest(t, handleFavouriteByID, token, http.MethodPut, "/favourites/"+ids["C"].String()+"/pin", map[string]bool{"pinned": true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	assertOrder(t, listTitles(t, token), "C", "B", "D", "A")
+	if code := move("A", "before", "C"); code != http.StatusConflict {
+		t.Errorf("expected status %d moving across pin groups, got %d", http.StatusConflict, code)
+	}
+	if w := doRequest(t, handleFavouriteByID, token, http.MethodPost, "/favourites/"+ids["A"].String()+"/move", map[string]string{}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without before/after, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestMoveAsset_Renumbers(t *testing.T) {
+	a := &Chart{ID: uuid.New(), Title: "A", Position: 1}
+	b := &Chart{ID: uuid.New(), Title: "B", Position: 1 + minPositionGap/2}
+	c := &Chart{ID: uuid.New(), Title: "C", Position: 5000}
+	user := &User{ID: uuid.New(), Favourites: []Asset{a, b, c}}
+
+	// No room between A and B: positions are renumbered before moving
+	if _, err := moveAsset(user, c, b, false); err != nil {
+		t.Fatalf("moveAsset: %v", err)
+	}
+	order := sortedFavourites(user)
+	if order[0].GetID() != a.ID || order[1].GetID() != c.ID || order[2].GetID() != b.ID {
+		t.Errorf("unexpected order after renumbering: %v %v %v", order[0].GetPosition(), order[1].GetPosition(), order[2].GetPosition())
+	}
+	if pos := order[0].GetPosition(); pos != positionGap {
+		t.Errorf("expected positions to be renumbered, A is at %v", pos)
+	}
+	// stored assets are replaced, never changed in place
+	if a.Position != 1 || c.Position != 5000 {
+		t.Errorf("expected the old assets unchanged, A at %v and C at %v", a.Position, c.Position)
+	}
+}
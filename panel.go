@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"platform-go-challenge/models"
+)
+
+// panel is the respondent dataset audiences are sized against, nil when no
+// panel file was configured
+var panel *Panel
+
+// Panel holds the respondent records together with per-attribute indexes
+// that are built once on load
+type Panel struct {
+	respondents []Respondent
+	totalWeight float64
+	// categorical maps attribute -> lower-cased value -> respondents having it
+	categorical map[string]map[string]bitset
+	// numeric maps attribute -> respondent indexes sorted by attribute value
+	numeric map[string][]int
+}
+
+// AudienceSize is the result of evaluating an audience against the panel
+type AudienceSize struct {
+	Respondents        int     `json:"respondents"`
+	TotalRespondents   int     `json:"total_respondents"`
+	WeightedPopulation float64 `json:"weighted_population"`
+	TotalPopulation    float64 `json:"total_population"`
+	Share              float64 `json:"share"`
+}
+
+// LoadPanelFile reads a respondent panel from a CSV file
+func LoadPanelFile(path string) (*Panel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadPanel(f)
+}
+
+// LoadPanel reads CSV records with a header row naming the columns gender,
+// country, age, social_hours, purchases and optionally weight (default 1)
+func LoadPanel(r io.Reader) (*Panel, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading panel header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{AttrGender, AttrCountry, AttrAge, AttrSocialHours, AttrPurchases} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("panel is missing column %q", name)
+		}
+	}
+	var respondents []Respondent
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading panel: %w", err)
+		}
+		resp := Respondent{
+			Gender:  Gender(rec[cols[AttrGender]]),
+			Country: rec[cols[AttrCountry]],
+			Weight:  1,
+		}
+		nums := []struct {
+			col string
+			dst *float64
+		}{
+			{AttrAge, &resp.Age},
+			{AttrSocialHours, &resp.SocialHours},
+			{AttrPurchases, &resp.Purchases},
+			{"weight", &resp.Weight},
+		}
+		for _, n := range nums {
+			i, ok := cols[n.col]
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(rec[i]), 64)
+			// NaN and infinities cannot be encoded as JSON and poison the sums
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("panel line %d: invalid %s %q", line, n.col, rec[i])
+			}
+			*n.dst = v
+		}
+		respondents = append(respondents, resp)
+	}
+	return NewPanel(respondents), nil
+}
+
+// NewPanel indexes the given respondents
+func NewPanel(respondents []Respondent) *Panel {
+	p := &Panel{
+		respondents: respondents,
+		categorical: make(map[string]map[string]bitset),
+		numeric:     make(map[string][]int),
+	}
+	for attr := range models.CategoricalAttrs {
+		p.categorical[attr] = make(map[string]bitset)
+	}
+	for i := range respondents {
+		resp := &respondents[i]
+		p.totalWeight += resp.Weight
+		for attr, values := range p.categorical {
+			v := strings.ToLower(resp.Categorical(attr))
+			set, ok := values[v]
+			if !ok {
+				set = newBitset(len(respondents))
+				values[v] = set
+			}
+			set.set(i)
+		}
+	}
+	for attr := range models.NumericAttrs {
+		order := make([]int, len(respondents))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return respondents[order[a]].Numeric(attr) < respondents[order[b]].Numeric(attr)
+		})
+		p.numeric[attr] = order
+	}
+	return p
+}
+
+// Size evaluates the rule against the panel. A nil rule selects everyone.
+func (p *Panel) Size(rule *Rule) AudienceSize {
+	matched := p.eval(rule)
+	size := AudienceSize{
+		TotalRespondents: len(p.respondents),
+		TotalPopulation:  p.totalWeight,
+	}
+	matched.each(func(i int) {
+		size.Respondents++
+		size.WeightedPopulation += p.respondents[i].Weight
+	})
+	if p.totalWeight > 0 {
+		size.Share = size.WeightedPopulation / p.totalWeight
+	}
+	return size
+}
+
+func (p *Panel) eval(r *Rule) bitset {
+	n := len(p.respondents)
+	if r == nil {
+		return newBitset(n).not(n)
+	}
+	switch r.Op {
+	case OpAnd:
+		acc := p.eval(r.Rules[0])
+		for _, child := range r.Rules[1:] {
+			acc = acc.and(p.eval(child))
+		}
+		return acc
+	case OpOr:
+		acc := newBitset(n)
+		for _, child := range r.Rules {
+			acc = acc.or(p.eval(child))
+		}
+		return acc
+	case OpNot:
+		return p.eval(r.Rules[0]).not(n)
+	case OpIn:
+		acc := newBitset(n)
+		for _, v := range r.Values {
+			if set, ok := p.categorical[r.Attr][strings.ToLower(v)]; ok {
+				acc = acc.or(set)
+			}
+		}
+		return acc
+	case OpRange:
+		order := p.numeric[r.Attr]
+		lo, hi := 0, len(order)
+		if r.Min != nil {
+			lo = sort.Search(len(order), func(i int) bool {
+				return p.respondents[order[i]].Numeric(r.Attr) >= *r.Min
+			})
+		}
+		if r.Max != nil {
+			hi = sort.Search(len(order), func(i int) bool {
+				return p.respondents[order[i]].Numeric(r.Attr) > *r.Max
+			})
+		}
+		acc := newBitset(n)
+		for _, i := range order[lo:max(lo, hi)] {
+			acc.set(i)
+		}
+		return acc
+	}
+	return newBitset(n)
+}
+
+// bitset is a fixed-size set of respondent indexes
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (uint(i) % 64)
+}
+
+func (b bitset) and(o bitset) bitset {
+	out := make(bitset, len(b))
+	for i := range b {
+		out[i] = b[i] & o[i]
+	}
+	return out
+}
+
+func (b bitset) or(o bitset) bitset {
+	out := make(bitset, len(b))
+	for i := range b {
+		out[i] = b[i] | o[i]
+	}
+	return out
+}
+
+// not complements the set, keeping bits beyond n cleared
+func (b bitset) not(n int) bitset {
+	out := make(bitset, len(b))
+	for i := range b {
+		out[i] = ^b[i]
+	}
+	if rem := n % 64; rem != 0 {
+		out[len(out)-1] &= (1 << uint(rem)) - 1
+	}
+	return out
+}
+
+func (b bitset) each(fn func(i int)) {
+	for w, word := range b {
+		for word != 0 {
+			fn(w*64 + bits.TrailingZeros64(word))
+			word &= word - 1
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"platform-go-challenge/models"
+)
+
+const testPanelCSV = `gender,country,age,social_hours,purchases,weight
+Female,UK,30,3,1,1000
+Female,DE,28,2,0,2000
+Female,FR,31,4,5,1500
+Male,UK,30,5,2,1200
+Female,UK,40,1,0,800
+Female,de,25,2.5,3,500
+`
+
+func loadTestPanel(t *testing.T) *Panel {
+	t.Helper()
+	p, err := LoadPanel(strings.NewReader(testPanelCSV))
+	if err != nil {
+		t.Fatalf("LoadPanel: %v", err)
+	}
+	return p
+}
+
+func TestPanelSize(t *testing.T) {
+	p := loadTestPanel(t)
+	cases := []struct {
+		expr     string
+		count    int
+		weighted float64
+	}{
+		{`gender = Female AND age BETWEEN 25 AND 34 AND country IN (UK, DE) AND social_hours >= 2`, 3, 3500},
+		{`country = UK`, 3, 3000},
+		{`NOT country = UK`, 3, 4000},
+		{`age <= 28 OR purchases >= 5`, 3, 4000},
+		{`age = 30`, 2, 2200},
+		{`country = GR`, 0, 0},
+	}
+	for _, tc := range cases {
+		rule, err := models.ParseRule(tc.expr)
+		if err != nil {
+			t.Fatalf("models.ParseRule(%q): %v", tc.expr, err)
+		}
+		size := p.Size(rule)
+		if size.Respondents != tc.count || size.WeightedPopulation != tc.weighted {
+			t.Errorf("%s: got %d respondents / %v weighted, want %d / %v", tc.expr, size.Respondents, size.WeightedPopulation, tc.count, tc.weighted)
+		}
+		// the index must agree with evaluating the rule respondent by respondent
+		scan := 0
+		for i := range p.respondents {
+			if rule.Match(&p.respondents[i]) {
+				scan++
+			}
+		}
+		if scan != size.Respondents {
+			t.Errorf("%s: index counted %d, scan counted %d", tc.expr, size.Respondents, scan)
+		}
+	}
+
+	all := p.Size(nil)
+	if all.Respondents != 6 || all.TotalPopulation != 7000 || all.Share != 1 {
+		t.Errorf("unexpected size for nil rule: %+v", all)
+	}
+}
+
+func TestLoadPanel_Errors(t *testing.T) {
+	if _, err := LoadPanel(strings.NewReader("gender,country,age\nFemale,UK,30\n")); err == nil {
+		t.Error("expected error for missing columns")
+	}
+	if _, err := LoadPanel(strings.NewReader("gender,country,age,social_hours,purchases\nFemale,UK,old,1,1\n")); err == nil {
+		t.Error("expected error for non-numeric age")
+	}
+	for _, v := range []string{"NaN", "Inf", "-inf", "+Infinity"} {
+		if _, err := LoadPanel(strings.NewReader("gender,country,age,social_hours,purchases,weight\nFemale,UK,30,1,1," + v + "\n")); err == nil {
+			t.Errorf("expected error for weight %s", v)
+		}
+	}
+}
+
+func TestHandleAudienceSize(t *testing.T) {
+	resetStore()
+	panel = loadTestPanel(t)
+	defer func() { panel = nil }()
+
+	rule, _ := models.ParseRule(`country = UK`)
+	audience := &Audience{ID: uuid.New(), Rules: rule, Favorite: true}
+	chart := &Chart{ID: uuid.New(), Title: "Chart1", Favorite: true}
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID, Favourites: []Asset{audience, chart}})
+	token, _ := GenerateJWT(userID)
+
+	get := func(id uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/favourites/"+id.String()+"/size", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		AuthMiddleware(handleFavouriteByID)(w, req)
+		return w
+	}
+
+	w := get(audience.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var resp struct {
+		AssetID uuid.UUID `json:"asset_id"`
+		AudienceSize
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.AssetID != audience.ID || resp.Respondents != 3 || resp.WeightedPopulation != 3000 {
+		t.Errorf("unexpected size response %+v", resp)
+	}
+	if math.Abs(resp.Share-3000.0/7000.0) > 1e-9 {
+		t.Errorf("expected share %v, got %v", 3000.0/7000.0, resp.Share)
+	}
+
+	if w := get(chart.ID); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for chart, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := get(uuid.New()); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for unknown asset, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// errPatchTest is returned when a JSON Patch "test" operation fails
+var errPatchTest = errors.New("test operation failed")
+
+// PatchOp is a single RFC 6902 JSON Patch operation
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// decodeJSON decodes a document keeping numbers as json.Number, so patching
+// does not lose precision
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// sameID reports whether a JSON value is the asset ID, in any of the forms
+// uuid.Parse accepts, e.g. upper case
+func sameID(v interface{}, assetID uuid.UUID) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	id, err := uuid.Parse(s)
+	return err == nil && id == assetID
+}
+
+// fieldKey returns the key of the object matching name. Asset fields are
+// matched case-insensitively, as when assets are created.
+func fieldKey(obj map[string]interface{}, name string) string {
+	if _, ok := obj[name]; ok {
+		return name
+	}
+	for key := range obj {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to the target
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for name, value := range p {
+		key := fieldKey(t, name)
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergePatch(t[key], value)
+	}
+	return t
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its reference tokens
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for n, tok := range tokens {
+		tokens[n] = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token; "-" is only valid when appending
+func arrayIndex(tok string, length int, appending bool) (int, error) {
+	if tok == "-" && appending {
+		return length, nil
+	}
+	n, err := strconv.Atoi(tok)
+	if err != nil || n < 0 || (tok != "0" && strings.HasPrefix(tok, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	max := length - 1
+	if appending {
+		max = length
+	}
+	if n > max {
+		return 0, fmt.Errorf("array index %d out of range", n)
+	}
+	return n, nil
+}
+
+// pointerGet returns the value the tokens point to
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	for _, tok := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[fieldKey(node, tok)]
+			if !ok {
+				return nil, fmt.Errorf("path member %q not found", tok)
+			}
+			doc = value
+		case []interface{}:
+			n, err := arrayIndex(tok, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[n]
+		default:
+			return nil, fmt.Errorf("path member %q not found", tok)
+		}
+	}
+	return doc, nil
+}
+
+// pointerUpdate calls fn on the parent of the location the tokens point to
+// and returns the document with the parent replaced by fn's result
+func pointerUpdate(doc interface{}, tokens []string, fn func(parent interface{}, tok string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	child, err := pointerGet(doc, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = pointerUpdate(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[fieldKey(node, tokens[0])] = child
+	case []interface{}:
+		n, _ := arrayIndex(tokens[0], len(node), false)
+		node[n] = child
+	}
+	return doc, nil
+}
+
+func patchAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, tok string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[fieldKey(node, tok)] = value
+			return node, nil
+		case []interface{}:
+			n, err := arrayIndex(tok, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[n+1:], node[n:])
+			node[n] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("cannot add %q to a scalar", tok)
+	})
+}
+
+func patchRemove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, tok string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			key := fieldKey(node, tok)
+			if _, ok := node[key]; !ok {
+				return nil, fmt.Errorf("path member %q not found", tok)
+			}
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			n, err := arrayIndex(tok, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:n], node[n+1:]...), nil
+		}
+		return nil, fmt.Errorf("path member %q not found", tok)
+	})
+}
+
+// jsonEqual compares two decoded values as JSON, so 1 and 1.0 are equal
+func jsonEqual(a, b interface{}) bool {
+	normalize := func(v interface{}) interface{} {
+		data, _ := json.Marshal(v)
+		var out interface{}
+		json.Unmarshal(data, &out)
+		return out
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// applyJSONPatch applies RFC 6902 operations in order; the patch fails as a
+// whole if any operation does
+func applyJSONPatch(doc interface{}, ops []PatchOp) (interface{}, error) {
+	for n, op := range ops {
+		path, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %v", n, err)
+		}
+		var value interface{}
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: %s needs a value", n, op.Op)
+			}
+			if value, err = decodeJSON(op.Value); err != nil {
+				return nil, fmt.Errorf("operation %d: %v", n, err)
+			}
+		}
+		if op.Op == "move" || op.Op == "copy" {
+			from, err := parsePointer(op.From)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %v", n, err)
+			}
+			if value, err = pointerGet(doc, from); err != nil {
+				return nil, fmt.Errorf("operation %d: %v", n, err)
+			}
+			if op.Op == "move" {
+				if op.Path == op.From || strings.HasPrefix(op.Path, op.From+"/") {
+					return nil, fmt.Errorf("operation %d: cannot move %q into itself", n, op.From)
+				}
+				if doc, err = patchRemove(doc, from); err != nil {
+					return nil, fmt.Errorf("operation %d: %v", n, err)
+				}
+			} else {
+				// decode a fresh copy so later operations cannot alias it
+				data, _ := json.Marshal(value)
+				value, _ = decodeJSON(data)
+			}
+		}
+		switch op.Op {
+		case "add", "move", "copy":
+			doc, err = patchAdd(doc, path, value)
+		case "remove":
+			doc, err = patchRemove(doc, path)
+		case "replace":
+			if _, err = pointerGet(doc, path); err == nil {
+				if len(path) == 0 {
+					doc = value
+				} else if doc, err = patchRemove(doc, path); err == nil {
+					doc, err = patchAdd(doc, path, value)
+				}
+			}
+		case "test":
+			var current interface{}
+			if current, err = pointerGet(doc, path); err == nil && !jsonEqual(current, value) {
+				err = errPatchTest
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", n, err)
+		}
+	}
+	return doc, nil
+}
+
+// maxUpdateBytes bounds the body of PUT and PATCH requests
+const maxUpdateBytes = 1 << 20
+
+// updateError rejects an update with the status and message to respond with
+type updateError struct {
+	status int
+	msg    string
+}
+
+func (e *updateError) Error() string { return e.msg }
+
+// Replaces (PUT) or patches (PATCH) an asset. PATCH takes an RFC 7396 merge
+// patch, or an RFC 6902 JSON Patch with Content-Type application/json-patch+json.
+// The result is validated like a new asset; its ID and ordering cannot change.
+func handleUpdateFavourite(w http.ResponseWriter, r *http.Request, assetID uuid.UUID) {
+	user, ok := requireUser(w, r, "handleUpdateFavourite")
+	if !ok {
+		return
+	}
+	owner, _, err := resolveAsset(user, assetID, PermEdit)
+	if err != nil {
+		writeAccessError(w, "handleUpdateFavourite", assetID, err)
+		return
+	}
+	mediaType := ""
+	if r.Method == http.MethodPatch {
+		mediaType, _, _ = mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "" || mediaType == "application/json" {
+			mediaType = mergePatchType
+		}
+		if mediaType != mergePatchType && mediaType != jsonPatchType {
+			log.Printf("handleUpdateFavourite: unsupported patch type %q", mediaType)
+			http.Error(w, "Unsupported patch type, use "+mergePatchType+" or "+jsonPatchType, http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUpdateBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		log.Printf("handleUpdateFavourite: body larger than %d bytes", tooLarge.Limit)
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("handleUpdateFavourite: cannot read body: %v", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	// The patch applies to the stored asset under the storage lock, so a
+	// concurrent update cannot be lost and "test" sees the current asset
+	updated, err := store.UpdateAsset(owner, assetID, func(current Asset, favourites []Asset) (Asset, error) {
+		return updateAsset(current, favourites, assetID, mediaType, body)
+	})
+	var rejected *updateError
+	if errors.As(err, &rejected) {
+		log.Printf("handleUpdateFavourite: invalid %s of asset %s: %v", r.Method, assetID, err)
+		http.Error(w, rejected.msg, rejected.status)
+		return
+	}
+	if err != nil {
+		log.Printf("handleUpdateFavourite: asset %s disappeared", assetID)
+		http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+		return
+	}
+	recordRevision(owner, updated, user.ID, strings.ToLower(r.Method))
+	notify(owner, EventUpdated, updated)
+	log.Printf("handleUpdateFavourite: asset %s updated by user %s (%s)", assetID, user.ID, r.Method)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// updateAsset builds the asset replacing current from the body of a PUT
+// (mediaType "") or of a patch. It runs under the storage lock, see
+// Storage.UpdateAsset.
+func updateAsset(current Asset, favourites []Asset, assetID uuid.UUID, mediaType string, body []byte) (Asset, error) {
+	var doc interface{}
+	var err error
+	if mediaType == "" {
+		doc, err = decodeJSON(body)
+	} else {
+		currentJSON, _ := json.Marshal(current)
+		doc, _ = decodeJSON(currentJSON)
+		if mediaType == jsonPatchType {
+			var ops []PatchOp
+			if err = json.Unmarshal(body, &ops); err == nil {
+				doc, err = applyJSONPatch(doc, ops)
+			}
+		} else {
+			var patch interface{}
+			if patch, err = decodeJSON(body); err == nil {
+				doc = mergePatch(doc, patch)
+			}
+		}
+	}
+	if errors.Is(err, errPatchTest) {
+		return nil, &updateError{http.StatusConflict, "Patch test failed: " + err.Error()}
+	}
+	if err != nil {
+		return nil, &updateError{http.StatusBadRequest, "Invalid patch: " + err.Error()}
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, &updateError{http.StatusBadRequest, "Asset must be a JSON object"}
+	}
+	idKey := fieldKey(obj, "ID")
+	if id, ok := obj[idKey]; ok && !sameID(id, assetID) {
+		return nil, &updateError{http.StatusBadRequest, "Asset ID cannot be changed"}
+	}
+	obj[idKey] = assetID.String()
+	raw, _ := json.Marshal(obj)
+	updated, err := decodeAsset(current.GetType(), raw, favourites)
+	if err != nil {
+		return nil, &updateError{http.StatusBadRequest, "Invalid " + current.GetType() + " asset: " + err.Error()}
+	}
+	return updated, nil
+}
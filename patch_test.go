@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMergePatch(t *testing.T) {
+	target, _ := decodeJSON([]byte(`{"a":"b","c":{"d":"e","f":"g"}}`))
+	patch, _ := decodeJSON([]byte(`{"a":"z","c":{"f":null}}`))
+	got, _ := json.Marshal(mergePatch(target, patch))
+	if string(got) != `{"a":"z","c":{"d":"e"}}` {
+		t.Errorf("unexpected merge result %s", got)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	cases := []struct {
+		doc, patch, want string
+	}{
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"baz"}]`, `{"foo":["bar","baz"]}`},
+		{`{"foo":"bar","baz":"qux"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":{"bar":"baz"},"qux":{}}`, `[{"op":"move","from":"/foo/bar","path":"/qux/thud"}]`, `{"foo":{},"qux":{"thud":"baz"}}`},
+		{`{"foo":[1]}`, `[{"op":"copy","from":"/foo","path":"/bar"}]`, `{"bar":[1],"foo":[1]}`},
+		{`{"a/b":1}`, `[{"op":"test","path":"/a~1b","value":1.0},{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`},
+	}
+	for _, tc := range cases {
+		doc, _ := decodeJSON([]byte(tc.doc))
+		var ops []PatchOp
+		json.Unmarshal([]byte(tc.patch), &ops)
+		result, err := applyJSONPatch(doc, ops)
+		if err != nil {
+			t.Errorf("patch %s: unexpected error %v", tc.patch, err)
+			continue
+		}
+		if got, _ := json.Marshal(result); string(got) != tc.want {
+			t.Errorf("patch %s: expected %s, got %s", tc.patch, tc.want, got)
+		}
+	}
+	for _, patch := range []string{
+		`[{"op":"remove","path":"/missing"}]`,
+		`[{"op":"add","path":"/foo/5","value":1}]`,
+		`[{"op":"move","from":"/foo","path":"/foo/0"}]`,
+		`[{"op":"frobnicate","path":"/foo"}]`,
+	} {
+		doc, _ := decodeJSON([]byte(`{"foo":[1]}`))
+		var ops []PatchOp
+		json.Unmarshal([]byte(patch), &ops)
+		if _, err := applyJSONPatch(doc, ops); err == nil {
+			t.Errorf("patch %s: expected an error", patch)
+		}
+	}
+}
+
+func TestUpdateFavourite(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Sales", Data: []float64{1, 2}, Description: "desc", Position: 1024, Pinned: true}
+	insight := &Insight{ID: uuid.New(), Text: "Insight"}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart, insight}})
+	token, _ := GenerateJWT(userID)
+	base := "/favourites/" + chart.ID.String()
+
+	patch := func(target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		AuthMiddleware(handleFavouriteByID)(w, req)
+		return w
+	}
+	current := func(id uuid.UUID) Asset { return findAsset(store.GetUser(userID), id) }
+
+	if w := patch(base, mergePatchType, `{"title":"Revenue","Description":null}`); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	got := current(chart.ID).(*Chart)
+	if got.Title != "Revenue" || got.Description != "" || len(got.Data) != 2 || got.Position != 1024 || !got.Pinned {
+		t.Errorf("unexpected merge-patched chart %+v", got)
+	}
+
+	if w := patch(base, jsonPatchType, `[{"op":"test","path":"/Title","value":"Revenue"},{"op":"add","path":"/Data/-","value":3}]`); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if got := current(chart.ID).(*Chart); len(got.Data) != 3 || got.Data[2] != 3 {
+		t.Errorf("unexpected JSON-patched data %v", got.Data)
+	}
+	if w := patch(base, jsonPatchType, `[{"op":"test","path":"/Title","value":"Sales"}]`); w.Code != http.StatusConflict {
+		t.Errorf("expected status %d for failed test, got %d", http.StatusConflict, w.Code)
+	}
+	if w := patch(base, mergePatchType, `{"ID":"`+uuid.New().String()+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d changing the ID, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := patch(base, mergePatchType, `{"ID":"`+strings.ToUpper(chart.ID.String())+`"}`); w.Code != http.StatusOK {
+		t.Errorf("expected status %d restating the ID in upper case, got %d", http.StatusOK, w.Code)
+	}
+	if w := patch(base, "text/plain", `{}`); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+	if w := patch(base, mergePatchType, `{"Description":"`+strings.Repeat("x", maxUpdateBytes)+`"}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d for an oversize patch, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	// Concurrent patches each apply to the stored asset, so none is lost
+	var wg sync.WaitGroup
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			patch(base, jsonPatchType, `[{"op":"add","path":"/Data/-","value":4}]`)
+		}()
+	}
+	wg.Wait()
+	if got := current(chart.ID).(*Chart); len(got.Data) != 23 {
+		t.Errorf("expected 23 data points after concurrent patches, got %d", len(got.Data))
+	}
+
+	// Updates are validated like creation
+	insightURL := "/favourites/" + insight.ID.String()
+	if w := patch(insightURL, mergePatchType, `{"Sources":[{"Title":"x","URL":"javascript:alert(1)"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid source, got %d", http.StatusBadRequest, w.Code)
+	}
+	w := doRequest(t, handleFavouriteByID, token, http.MethodPut, insightURL, map[string]interface{}{
+		"Text": "<b>Replaced</b>", "RelatedAssets": []uuid.UUID{chart.ID},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d replacing, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	replaced := current(insight.ID).(*Insight)
+	if replaced.ID != insight.ID || replaced.Text != "&lt;b>Replaced&lt;/b>" || len(replaced.RelatedAssets) != 1 {
+		t.Errorf("unexpected replaced insight %+v", replaced)
+	}
+	if revs := store.RevisionsOf(store.GetUser(userID), insight.ID); len(revs) != 1 || revs[0].Action != "put" {
+		t.Errorf("expected the replace recorded in history, got %d revisions", len(revs))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// newHTTPServer returns the server of the HTTP API with the configured
+// timeouts and limits. Shutting it down ends the event streams and
+// WebSockets, which would otherwise hold the shutdown until its deadline.
+func newHTTPServer(cfg HTTPConfig, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	srv.RegisterOnShutdown(closeStreams)
+	return srv
+}
+
+// closeStreams ends the long-lived connections: sockets get a going away
+// close frame and event streams end, so clients reconnect elsewhere
+func closeStreams() {
+	closeWebSockets()
+	events.Close()
+}
+
+// shutdownServers stops accepting connections and waits up to timeout for
+// the in-flight requests and calls, then closes whatever is left
+func shutdownServers(srv *http.Server, grpcSrv *grpc.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	grpcDone := make(chan struct{})
+	if grpcSrv != nil {
+		go func() {
+			grpcSrv.GracefulStop()
+			close(grpcDone)
+		}()
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdownServers: requests still running after %v, closing them: %v", timeout, err)
+		srv.Close()
+	}
+	if grpcSrv == nil {
+		return
+	}
+	select {
+	case <-grpcDone:
+	case <-ctx.Done():
+		log.Printf("shutdownServers: gRPC calls still running after %v, closing them", timeout)
+		grpcSrv.Stop()
+		<-grpcDone
+	}
+}
+
+// flushStorage makes everything acknowledged durable before exiting: a last
+// snapshot, which also empties the write-ahead log, then the log is closed
+func flushStorage() error {
+	if snapshotPath != "" {
+		info, err := WriteSnapshot(snapshotPath)
+		if err != nil {
+			return err
+		}
+		log.Printf("flushStorage: wrote %d users to %s", info.Users, snapshotPath)
+	}
+	store.writeMu.Lock()
+	defer store.writeMu.Unlock()
+	if store.wal == nil {
+		return nil
+	}
+	err := store.wal.Close()
+	store.mu.Lock()
+	store.wal = nil
+	store.mu.Unlock()
+	return err
+}
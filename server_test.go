@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// startTestServer serves the API and a slow endpoint with newHTTPServer and
+// short timeouts, on a fresh event hub
+func startTestServer(t *testing.T) (*http.Server, string) {
+	t.Helper()
+	oldEvents := events
+	events = NewHub()
+	t.Cleanup(func() {
+		events = oldEvents
+		wsConns.Lock()
+		wsConns.closed = false
+		wsConns.Unlock()
+	})
+	mux := http.NewServeMux()
+	setupRoutes(mux)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	cfg := defaultConfig().HTTP
+	cfg.ReadTimeout, cfg.WriteTimeout = 300*time.Millisecond, 300*time.Millisecond
+	srv := newHTTPServer(cfg, mux)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(func() { srv.Close() })
+	return srv, "http://" + lis.Addr().String()
+}
+
+func TestServer_StreamsOutliveTimeouts(t *testing.T) {
+	resetStore()
+	_, url := startTestServer(t)
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+
+	stream := openStream(t, url+"/favourites/events", token, "")
+	time.Sleep(600 * time.Millisecond)
+	events.Publish(Event{Type: EventCreated, UserID: userID, AssetID: uuid.New()})
+	if _, typ, _ := readEvent(t, stream); typ != EventCreated {
+		t.Errorf("expected the event after the timeouts, got %s", typ)
+	}
+}
+
+func TestServer_GracefulShutdown(t *testing.T) {
+	resetStore()
+	srv, url := startTestServer(t)
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+
+	stream := openStream(t, url+"/favourites/events", token, "")
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws?access_token="+token, nil)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer conn.Close()
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		slow <- string(body)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	shutdownServers(srv, nil, 5*time.Second)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the streams not to hold the shutdown, took %v", elapsed)
+	}
+	if got := <-slow; got != "done" {
+		t.Errorf("expected the in-flight request drained, got %q", got)
+	}
+	if _, err := stream.ReadString('\n'); !errors.Is(err, io.EOF) {
+		t.Errorf("expected the event stream ended, got %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a going away close frame, got %v", err)
+	}
+	if _, err := http.Get(url + "/slow"); err == nil {
+		t.Error("expected new connections refused")
+	}
+}
+
+func TestFlushStorage(t *testing.T) {
+	resetStore()
+	dir := t.TempDir()
+	snapshotPath = filepath.Join(dir, "store.snapshot")
+	defer func() { snapshotPath = "" }()
+	wal, err := OpenWAL(filepath.Join(dir, "store.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.wal = wal
+	userID := uuid.New()
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: userID})
+	err = store.commit()
+	store.writeMu.Unlock()
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	if err := flushStorage(); err != nil {
+		t.Fatalf("flushStorage: %v", err)
+	}
+	if store.wal != nil {
+		t.Error("expected the write-ahead log closed")
+	}
+	resetStore()
+	if _, err := RestoreSnapshot(snapshotPath); err != nil || store.GetUser(userID) == nil {
+		t.Errorf("expected the user in the last snapshot, got %v", err)
+	}
+}
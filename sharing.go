@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Permission is the access level a share grants
+type Permission string
+
+const (
+	PermRead Permission = "read"
+	PermEdit Permission = "edit"
+)
+
+// allows reports whether the permission covers the wanted one
+func (p Permission) allows(want Permission) bool {
+	return p == PermEdit || p == want
+}
+
+// Share grants another user access to an asset, or to every asset of a
+// collection. Exactly one of AssetID and CollectionID is set.
+type Share struct {
+	ID           uuid.UUID  `json:"id"`
+	TenantID     uuid.UUID  `json:"tenant_id"`
+	OwnerID      uuid.UUID  `json:"owner_id"`
+	GranteeID    uuid.UUID  `json:"user_id"`
+	AssetID      uuid.UUID  `json:"asset_id"`
+	CollectionID uuid.UUID  `json:"collection_id"`
+	Permission   Permission `json:"permission"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+var (
+	errAssetNotFound      = errors.New("asset not found")
+	errCollectionNotFound = errors.New("collection not found")
+	errForbidden          = errors.New("forbidden")
+)
+
+// resolveAsset finds an asset the user may access with the wanted permission:
+// either one of their own, or one shared with them directly or through a
+// collection. Shares never cross tenants. It returns the owner of the asset
+// alongside it.
+func resolveAsset(user *User, assetID uuid.UUID, want Permission) (*User, Asset, error) {
+	if asset := findAsset(user, assetID); asset != nil {
+		return user, asset, nil
+	}
+	err := errAssetNotFound
+	tenantID := store.TenantOf(user)
+	for _, share := range store.SharesForGrantee(tenantID, user.ID) {
+		owner := store.GetTenantUser(tenantID, share.OwnerID)
+		if owner == nil {
+			continue
+		}
+		if share.AssetID != assetID {
+			c := findCollection(owner, share.CollectionID)
+			if c == nil || !c.hasAsset(assetID) {
+				continue
+			}
+		}
+		asset := findAsset(owner, assetID)
+		if asset == nil {
+			continue
+		}
+		if share.Permission.allows(want) {
+			return owner, asset, nil
+		}
+		err = errForbidden
+	}
+	return nil, nil, err
+}
+
+// resolveCollection finds a collection the user may access with the wanted
+// permission: either one of their own, or one shared with them. It returns
+// the owner of the collection alongside it.
+func resolveCollection(user *User, collectionID uuid.UUID, want Permission) (*User, *Collection, error) {
+	if c := findCollection(user, collectionID); c != nil {
+		return user, c, nil
+	}
+	err := errCollectionNotFound
+	tenantID := store.TenantOf(user)
+	for _, share := range store.SharesForGrantee(tenantID, user.ID) {
+		if share.CollectionID != collectionID {
+			continue
+		}
+		owner := store.GetTenantUser(tenantID, share.OwnerID)
+		if owner == nil {
+			continue
+		}
+		c := findCollection(owner, collectionID)
+		if c == nil {
+			continue
+		}
+		if share.Permission.allows(want) {
+			return owner, c, nil
+		}
+		err = errForbidden
+	}
+	return nil, nil, err
+}
+
+// editAsset applies edit to an asset the user may edit, returning its owner
+// and the edited asset
+func editAsset(user *User, assetID uuid.UUID, edit func(Asset)) (*User, Asset, error) {
+	owner, _, err := resolveAsset(user, assetID, PermEdit)
+	if err != nil {
+		return nil, nil, err
+	}
+	asset, err := store.EditAsset(owner, assetID, edit)
+	return owner, asset, err
+}
+
+// writeAccessError maps a resolveAsset error to the HTTP response
+func writeAccessError(w http.ResponseWriter, handler string, assetID uuid.UUID, err error) {
+	if errors.Is(err, errForbidden) {
+		log.Printf("%s: insufficient permission on asset %s", handler, assetID)
+		http.Error(w, "Insufficient permission on asset", http.StatusForbidden)
+		return
+	}
+	log.Printf("%s: asset not found %s", handler, assetID)
+	http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+}
+
+// sharedAssets returns the owner's assets covered by the share
+func sharedAssets(owner *User, share *Share) []Asset {
+	assets := make([]Asset, 0)
+	if share.AssetID != uuid.Nil {
+		if asset := findAsset(owner, share.AssetID); asset != nil {
+			assets = append(assets, asset)
+		}
+		return assets
+	}
+	if c := findCollection(owner, share.CollectionID); c != nil {
+		for _, id := range c.AssetIDs {
+			if asset := findAsset(owner, id); asset != nil {
+				assets = append(assets, asset)
+			}
+		}
+	}
+	return assets
+}
+
+// Lists the shares the user granted (GET), or shares an asset or collection (POST)
+func handleShares(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleShares")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		shares := store.SharesByOwner(user.TenantID, user.ID)
+		log.Printf("handleShares: returning %d shares for user %s", len(shares), user.ID)
+		json.NewEncoder(w).Encode(shares)
+	case http.MethodPost:
+		var req struct {
+			AssetID      uuid.UUID  `json:"asset_id"`
+			CollectionID uuid.UUID  `json:"collection_id"`
+			UserID       uuid.UUID  `json:"user_id"`
+			Permission   Permission `json:"permission"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("handleShares: invalid request body: %v", err)
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if (req.AssetID == uuid.Nil) == (req.CollectionID == uuid.Nil) {
+			log.Printf("handleShares: share needs exactly one target")
+			http.Error(w, "Request must set exactly one of asset_id or collection_id", http.StatusBadRequest)
+			return
+		}
+		if req.Permission != PermRead && req.Permission != PermEdit {
+			log.Printf("handleShares: invalid permission %q", req.Permission)
+			http.Error(w, "Permission must be read or edit", http.StatusBadRequest)
+			return
+		}
+		if req.UserID == user.ID || store.GetTenantUser(user.TenantID, req.UserID) == nil {
+			log.Printf("handleShares: invalid grantee %s", req.UserID)
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		if req.AssetID != uuid.Nil && findAsset(user, req.AssetID) == nil {
+			log.Printf("handleShares: asset not found %s", req.AssetID)
+			http.Error(w, "Asset not found in favourites", http.StatusNotFound)
+			return
+		}
+		if req.CollectionID != uuid.Nil && findCollection(user, req.CollectionID) == nil {
+			log.Printf("handleShares: collection not found %s", req.CollectionID)
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		share, created, err := store.PutShare(&Share{
+			ID:           uuid.New(),
+			TenantID:     user.TenantID,
+			OwnerID:      user.ID,
+			GranteeID:    req.UserID,
+			AssetID:      req.AssetID,
+			CollectionID: req.CollectionID,
+			Permission:   req.Permission,
+			CreatedAt:    time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("handleShares: %v", err)
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		log.Printf("handleShares: user %s shared %s%s with %s (%s)", user.ID, req.AssetID, req.CollectionID, req.UserID, req.Permission)
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(share)
+	default:
+		log.Printf("handleShares: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Lists everything shared with the user, with the shared assets embedded
+func handleSharedWithMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("handleSharedWithMe: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleSharedWithMe")
+	if !ok {
+		return
+	}
+	type sharedView struct {
+		*Share
+		Assets []Asset `json:"assets"`
+	}
+	views := make([]sharedView, 0)
+	for _, share := range store.SharesForGrantee(user.TenantID, user.ID) {
+		owner := store.GetTenantUser(user.TenantID, share.OwnerID)
+		if owner == nil {
+			continue
+		}
+		views = append(views, sharedView{Share: share, Assets: sharedAssets(owner, share)})
+	}
+	log.Printf("handleSharedWithMe: returning %d shares for user %s", len(views), user.ID)
+	json.NewEncoder(w).Encode(views)
+}
+
+// Revokes a share; the owner and the grantee may both remove it
+func handleShareByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		log.Printf("handleShareByID: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleShareByID")
+	if !ok {
+		return
+	}
+	shareID, err := uuid.Parse(strings.Trim(strings.TrimPrefix(r.URL.Path, "/shares/"), "/"))
+	if err != nil {
+		log.Printf("handleShareByID: unknown path %s", r.URL.Path)
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	share := store.GetShare(user.TenantID, shareID)
+	if share == nil || (share.OwnerID != user.ID && share.GranteeID != user.ID) {
+		log.Printf("handleShareByID: share not found %s", shareID)
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+	store.RemoveShare(shareID)
+	log.Printf("handleShareByID: share %s revoked by user %s", shareID, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
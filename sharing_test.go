@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSharing_AssetPermissions(t *testing.T) {
+	resetStore()
+	ownerID, readerID, editorID := uuid.New(), uuid.New(), uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Shared chart", Favorite: true}
+	store.AddUser(&User{ID: ownerID, Favourites: []Asset{chart}})
+	store.AddUser(&User{ID: readerID})
+	store.AddUser(&User{ID: editorID})
+	ownerToken, _ := GenerateJWT(ownerID)
+	readerToken, _ := GenerateJWT(readerID)
+	editorToken, _ := GenerateJWT(editorID)
+
+	share := func(userID uuid.UUID, perm Permission) Share {
+		w := doRequest(t, handleShares, ownerToken, http.MethodPost, "/shares", map[string]interface{}{
+			"asset_id": chart.ID, "user_id": userID, "permission": perm,
+		})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d sharing, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		var s Share
+		json.NewDecoder(w.Body).Decode(&s)
+		return s
+	}
+	// Before sharing nobody else can see the asset; afterwards both grantees can read it
+	if w := doRequest(t, handleFavouriteByID, readerToken, http.MethodGet, "/favourites/"+chart.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d before sharing, got %d", http.StatusNotFound, w.Code)
+	}
+	readShare := share(readerID, PermRead)
+	share(editorID, PermEdit)
+	for _, token := range []string{readerToken, editorToken} {
+		if w := doRequest(t, handleFavouriteByID, token, http.MethodGet, "/favourites/"+chart.ID.String(), nil); w.Code != http.StatusOK {
+			t.Fatalf("expected grantees to get the shared asset, got %d", w.Code)
+		}
+	}
+
+	edit := func(token string) int {
+		w := doRequest(t, handleEditFavourite, token, http.MethodPut, "/favourites/edit?asset_id="+chart.ID.String(), map[string]string{"description": "edited"})
+		return w.Code
+	}
+	if code := edit(readerToken); code != http.StatusForbidden {
+		t.Errorf("expected status %d for read-only grantee, got %d", http.StatusForbidden, code)
+	}
+	if code := edit(editorToken); code != http.StatusOK {
+		t.Errorf("expected status %d for editor, got %d", http.StatusOK, code)
+	}
+	if got := findAsset(store.GetUser(ownerID), chart.ID).GetDescription(); got != "edited" {
+		t.Errorf("expected description 'edited', got %q", got)
+	}
+	// Grantees cannot delete the owner's asset
+	if w := doRequest(t, handleDeleteFavourite, editorToken, http.MethodDelete, "/favourites/delete?asset_id="+chart.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d deleting shared asset, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Upgrading an existing share updates it in place
+	w := doRequest(t, handleShares, ownerToken, http.MethodPost, "/shares", map[string]interface{}{
+		"asset_id": chart.ID, "user_id": readerID, "permission": PermEdit,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d updating share, got %d", http.StatusOK, w.Code)
+	}
+	if code := edit(readerToken); code != http.StatusOK {
+		t.Errorf("expected status %d after upgrade, got %d", http.StatusOK, code)
+	}
+
+	w = doRequest(t, handleSharedWithMe, readerToken, http.MethodGet, "/shares/with-me", nil)
+	var shared []struct {
+		Share
+		Assets []map[string]interface{} `json:"assets"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&shared); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(shared) != 1 || len(shared[0].Assets) != 1 || shared[0].Assets[0]["Title"] != "Shared chart" {
+		t.Fatalf("unexpected shared-with-me list %+v", shared)
+	}
+
+	// Revoking removes access
+	if w := doRequest(t, handleShareByID, ownerToken, http.MethodDelete, "/shares/"+readShare.ID.String(), nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d revoking, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := doRequest(t, handleFavouriteByID, readerToken, http.MethodGet, "/favourites/"+chart.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d after revoke, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestSharing_Collection(t *testing.T) {
+	resetStore()
+	ownerID, granteeID := uuid.New(), uuid.New()
+	inside := &Chart{ID: uuid.New(), Title: "Inside", Favorite: true}
+	outside := &Chart{ID: uuid.New(), Title: "Outside", Favorite: true}
+	c := &Collection{ID: uuid.New(), Name: "Shared", AssetIDs: []uuid.UUID{inside.ID}}
+	store.AddUser(&User{ID: ownerID, Favourites: []Asset{inside, outside}, Collections: []*Collection{c}})
+	store.AddUser(&User{ID: granteeID})
+	ownerToken, _ := GenerateJWT(ownerID)
+	granteeToken, _ := GenerateJWT(granteeID)
+
+	w := doRequest(t, handleShares, ownerToken, http.MethodPost, "/shares", map[string]interface{}{
+		"collection_id": c.ID, "user_id": granteeID, "permission": PermRead,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w := doRequest(t, handleFavouriteByID, granteeToken, http.MethodGet, "/favourites/"+inside.ID.String(), nil); w.Code != http.StatusOK {
+		t.Errorf("expected access to asset in shared collection, got %d", w.Code)
+	}
+	if w := doRequest(t, handleFavouriteByID, granteeToken, http.MethodGet, "/favourites/"+outside.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected no access to asset outside the collection, got %d", w.Code)
+	}
+
+	// Grantees reach the collection itself; an edit share renames it and
+	// changes its assets, but only the owner deletes it
+	editorID := uuid.New()
+	store.AddUser(&User{ID: editorID})
+	editorToken, _ := GenerateJWT(editorID)
+	doRequest(t, handleShares, ownerToken, http.MethodPost, "/shares", map[string]interface{}{
+		"collection_id": c.ID, "user_id": editorID, "permission": PermEdit,
+	})
+	collectionURL := "/collections/" + c.ID.String()
+	if w := doRequest(t, handleCollectionByID, granteeToken, http.MethodGet, collectionURL, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the shared collection readable, got %d", w.Code)
+	}
+	if w := doRequest(t, handleCollectionByID, granteeToken, http.MethodPut, collectionURL, map[string]string{"name": "Mine"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d renaming with a read share, got %d", http.StatusForbidden, w.Code)
+	}
+	stored := func() *Collection { return findCollection(store.GetUser(ownerID), c.ID) }
+	if w := doRequest(t, handleCollectionByID, editorToken, http.MethodPut, collectionURL, map[string]string{"name": "Renamed"}); w.Code != http.StatusOK || stored().Name != "Renamed" {
+		t.Errorf("expected the editor to rename the collection, got %d and %q", w.Code, stored().Name)
+	}
+	if w := doRequest(t, handleCollectionByID, editorToken, http.MethodPost, collectionURL+"/assets?asset_id="+outside.ID.String(), nil); w.Code != http.StatusOK || !stored().hasAsset(outside.ID) {
+		t.Errorf("expected the editor to add the owner's asset, got %d", w.Code)
+	}
+	if w := doRequest(t, handleCollectionByID, editorToken, http.MethodDelete, collectionURL, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d deleting a shared collection, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Deleting the collection drops its shares
+	doRequest(t, handleCollectionByID, ownerToken, http.MethodDelete, "/collections/"+c.ID.String(), nil)
+	if shares := append(store.SharesForGrantee(uuid.Nil, granteeID), store.SharesForGrantee(uuid.Nil, editorID)...); len(shares) != 0 {
+		t.Errorf("expected shares to be removed with the collection, got %d", len(shares))
+	}
+
+	for _, body := range []map[string]interface{}{
+		{"asset_id": inside.ID, "user_id": ownerID, "permission": PermRead},
+		{"asset_id": inside.ID, "user_id": granteeID, "permission": "admin"},
+		{"asset_id": inside.ID, "collection_id": c.ID, "user_id": granteeID, "permission": PermRead},
+	} {
+		if w := doRequest(t, handleShares, ownerToken, http.MethodPost, "/shares", body); w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for %v, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes
+const snapshotVersion = 1
+
+var (
+	// snapshotPath is where snapshots are written and restored from; set by storage.snapshot
+	snapshotPath string
+	// adminToken guards the operator endpoints; they are disabled while empty.
+	// Set by auth.admin_token
+	adminToken string
+
+	errSnapshotChecksum = errors.New("snapshot checksum mismatch")
+)
+
+// snapshotEnvelope is the file format: the store's data with its version and
+// a SHA-256 checksum of the data bytes
+type snapshotEnvelope struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Checksum  string          `json:"checksum"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// SnapshotInfo describes a written snapshot
+type SnapshotInfo struct {
+	Path      string    `json:"path,omitempty"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Checksum  string    `json:"checksum"`
+	Users     int       `json:"users"`
+	Bytes     int       `json:"bytes"`
+}
+
+// typedAsset carries an asset with its type so []Asset can be decoded back
+type typedAsset struct {
+	Type  string          `json:"type"`
+	Asset json.RawMessage `json:"asset"`
+}
+
+type trashRecord struct {
+	Asset         typedAsset  `json:"asset"`
+	DeletedAt     time.Time   `json:"deleted_at"`
+	CollectionIDs []uuid.UUID `json:"collection_ids"`
+}
+
+type userRecord struct {
+	ID          uuid.UUID                 `json:"id"`
+	TenantID    uuid.UUID                 `json:"tenant_id"`
+	Favourites  []typedAsset              `json:"favourites"`
+	Collections []*Collection             `json:"collections"`
+	Trash       []trashRecord             `json:"trash"`
+	History     map[uuid.UUID][]*Revision `json:"history"`
+}
+
+// linkRecord adds the password hash ShareLink keeps out of its JSON
+type linkRecord struct {
+	*ShareLink
+	PasswordSalt []byte `json:"password_salt,omitempty"`
+	PasswordHash []byte `json:"password_hash,omitempty"`
+}
+
+func newLinkRecord(link *ShareLink) *linkRecord {
+	return &linkRecord{ShareLink: link, PasswordSalt: link.passwordSalt, PasswordHash: link.passwordHash}
+}
+
+type teamRecord struct {
+	*Team
+	Assets []typedAsset `json:"assets"`
+}
+
+type snapshotData struct {
+	Users  []*userRecord   `json:"users"`
+	Shares []*Share        `json:"shares"`
+	Links  []*linkRecord   `json:"links"`
+	Orgs   []*Organisation `json:"orgs"`
+	Teams  []*teamRecord   `json:"teams"`
+
+	Webhooks   []*Webhook  `json:"webhooks,omitempty"`
+	Deliveries []*Delivery `json:"deliveries,omitempty"`
+}
+
+func encodeAsset(asset Asset) (typedAsset, error) {
+	raw, err := json.Marshal(asset)
+	return typedAsset{Type: asset.GetType(), Asset: raw}, err
+}
+
+func decodeTypedAsset(t typedAsset) (Asset, error) {
+	asset, err := newAsset(t.Type)
+	if err != nil {
+		return nil, err
+	}
+	return asset, json.Unmarshal(t.Asset, asset)
+}
+
+func encodeAssets(assets []Asset) ([]typedAsset, error) {
+	out := make([]typedAsset, 0, len(assets))
+	for _, asset := range assets {
+		t, err := encodeAsset(asset)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func decodeAssets(typed []typedAsset) ([]Asset, error) {
+	out := make([]Asset, 0, len(typed))
+	for _, t := range typed {
+		asset, err := decodeTypedAsset(t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, asset)
+	}
+	return out, nil
+}
+
+// encodeUser converts a user to its snapshot form
+func encodeUser(u *User) (*userRecord, error) {
+	favourites, err := encodeAssets(u.Favourites)
+	if err != nil {
+		return nil, err
+	}
+	rec := &userRecord{ID: u.ID, TenantID: u.TenantID, Favourites: favourites, Collections: u.Collections, History: u.History}
+	for _, entry := range u.Trash {
+		t, err := encodeTrashed(entry)
+		if err != nil {
+			return nil, err
+		}
+		rec.Trash = append(rec.Trash, t)
+	}
+	return rec, nil
+}
+
+func encodeTrashed(entry *TrashedAsset) (trashRecord, error) {
+	asset, err := encodeAsset(entry.Asset)
+	return trashRecord{Asset: asset, DeletedAt: entry.DeletedAt, CollectionIDs: entry.CollectionIDs}, err
+}
+
+func decodeTrashed(t trashRecord) (*TrashedAsset, error) {
+	asset, err := decodeTypedAsset(t.Asset)
+	if err != nil {
+		return nil, err
+	}
+	return &TrashedAsset{Asset: asset, DeletedAt: t.DeletedAt, CollectionIDs: t.CollectionIDs}, nil
+}
+
+// decodeUser rebuilds a user from its snapshot form
+func decodeUser(rec *userRecord) (*User, error) {
+	favourites, err := decodeAssets(rec.Favourites)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: %w", rec.ID, err)
+	}
+	u := &User{ID: rec.ID, TenantID: rec.TenantID, Favourites: favourites, Collections: rec.Collections, History: rec.History}
+	for _, t := range rec.Trash {
+		entry, err := decodeTrashed(t)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", rec.ID, err)
+		}
+		u.Trash = append(u.Trash, entry)
+	}
+	return u, nil
+}
+
+// Export returns the whole store in its snapshot form, consistent as it is
+// taken under the read lock
+func (s *Storage) Export() (*snapshotData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data := &snapshotData{}
+	for _, u := range s.users {
+		rec, err := encodeUser(u)
+		if err != nil {
+			return nil, err
+		}
+		data.Users = append(data.Users, rec)
+	}
+	for _, share := range s.shares {
+		data.Shares = append(data.Shares, share)
+	}
+	for _, link := range s.links {
+		data.Links = append(data.Links, newLinkRecord(link))
+	}
+	for _, org := range s.orgs {
+		data.Orgs = append(data.Orgs, org)
+	}
+	for _, team := range s.teams {
+		assets, err := encodeAssets(team.Assets)
+		if err != nil {
+			return nil, err
+		}
+		data.Teams = append(data.Teams, &teamRecord{Team: team, Assets: assets})
+	}
+	for _, wh := range s.webhooks {
+		data.Webhooks = append(data.Webhooks, wh)
+	}
+	for _, d := range s.deliveries {
+		data.Deliveries = append(data.Deliveries, d)
+	}
+	return data, nil
+}
+
+// Import replaces the whole store with the snapshot data
+func (s *Storage) Import(data *snapshotData) error {
+	users := make(map[uuid.UUID]*User, len(data.Users))
+	for _, rec := range data.Users {
+		u, err := decodeUser(rec)
+		if err != nil {
+			return err
+		}
+		users[u.ID] = u
+	}
+	teams := make(map[uuid.UUID]*Team, len(data.Teams))
+	for _, rec := range data.Teams {
+		assets, err := decodeAssets(rec.Assets)
+		if err != nil {
+			return fmt.Errorf("team %s: %w", rec.ID, err)
+		}
+		rec.Team.Assets = assets
+		teams[rec.ID] = rec.Team
+	}
+	shares := make(map[uuid.UUID]*Share, len(data.Shares))
+	for _, share := range data.Shares {
+		shares[share.ID] = share
+	}
+	links := make(map[uuid.UUID]*ShareLink, len(data.Links))
+	for _, rec := range data.Links {
+		rec.passwordSalt, rec.passwordHash = rec.PasswordSalt, rec.PasswordHash
+		links[rec.ID] = rec.ShareLink
+	}
+	orgs := make(map[uuid.UUID]*Organisation, len(data.Orgs))
+	for _, org := range data.Orgs {
+		orgs[org.ID] = org
+	}
+	webhooks := make(map[uuid.UUID]*Webhook, len(data.Webhooks))
+	for _, wh := range data.Webhooks {
+		webhooks[wh.ID] = wh
+	}
+	deliveries := make(map[uuid.UUID]*Delivery, len(data.Deliveries))
+	for _, d := range data.Deliveries {
+		deliveries[d.ID] = d
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users, s.shares, s.links, s.orgs, s.teams = users, shares, links, orgs, teams
+	s.webhooks, s.deliveries = webhooks, deliveries
+	return nil
+}
+
+// encodeSnapshot serializes the store into a snapshot file body
+func encodeSnapshot() ([]byte, *SnapshotInfo, error) {
+	store.writeMu.Lock()
+	defer store.writeMu.Unlock()
+	return encodeSnapshotLocked()
+}
+
+// encodeSnapshotLocked is encodeSnapshot for callers holding store.writeMu
+func encodeSnapshotLocked() ([]byte, *SnapshotInfo, error) {
+	data, err := store.Export()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(raw)
+	env := snapshotEnvelope{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Checksum:  "sha256:" + hex.EncodeToString(sum[:]),
+		Data:      raw,
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &SnapshotInfo{Version: env.Version, CreatedAt: env.CreatedAt, Checksum: env.Checksum, Users: len(data.Users), Bytes: len(body)}
+	return body, info, nil
+}
+
+// decodeSnapshot verifies a snapshot file body and returns its data
+func decodeSnapshot(body []byte) (*snapshotData, error) {
+	var env snapshotEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	if env.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", env.Version)
+	}
+	sum := sha256.Sum256(env.Data)
+	if env.Checksum != "sha256:"+hex.EncodeToString(sum[:]) {
+		return nil, errSnapshotChecksum
+	}
+	var data snapshotData
+	if err := json.Unmarshal(env.Data, &data); err != nil {
+		return nil, fmt.Errorf("reading snapshot data: %w", err)
+	}
+	return &data, nil
+}
+
+// writeFileAtomic replaces the file with data: it writes a temporary file in
+// the same directory, syncs it and renames it over the old one, so readers
+// see either the old or the new content, never a partial write
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// WriteSnapshot atomically writes a snapshot of the store to path. With a
+// write-ahead log, the snapshot holds everything logged so far and the log
+// is truncated.
+func WriteSnapshot(path string) (*SnapshotInfo, error) {
+	store.writeMu.Lock()
+	defer store.writeMu.Unlock()
+	body, info, err := encodeSnapshotLocked()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, body); err != nil {
+		return nil, err
+	}
+	if store.wal != nil {
+		if err := store.wal.Truncate(); err != nil {
+			return nil, fmt.Errorf("compacting write-ahead log: %w", err)
+		}
+	}
+	info.Path = path
+	return info, nil
+}
+
+// RestoreSnapshot replaces the store with the snapshot at path
+func RestoreSnapshot(path string) (*SnapshotInfo, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeSnapshot(body)
+	if err != nil {
+		return nil, err
+	}
+	store.writeMu.Lock()
+	defer store.writeMu.Unlock()
+	if err := store.Import(data); err != nil {
+		return nil, err
+	}
+	return &SnapshotInfo{Path: path, Version: snapshotVersion, Users: len(data.Users), Bytes: len(body)}, nil
+}
+
+// runAutoSnapshot writes a snapshot to path every interval until the context
+// is cancelled
+func runAutoSnapshot(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := WriteSnapshot(path)
+			if err != nil {
+				log.Printf("runAutoSnapshot: %v", err)
+				continue
+			}
+			log.Printf("runAutoSnapshot: wrote %d users to %s (%d bytes)", info.Users, path, info.Bytes)
+		}
+	}
+}
+
+// AdminMiddleware lets through requests bearing the operator token
+func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		expected := currentAdminToken()
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			log.Printf("AdminMiddleware: rejected %s %s", r.Method, r.URL.Path)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Writes a snapshot to the configured file (POST), or downloads one (GET)
+func handleAdminSnapshot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		body, info, err := encodeSnapshot()
+		if err != nil {
+			log.Printf("handleAdminSnapshot: %v", err)
+			http.Error(w, "Could not create snapshot", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("handleAdminSnapshot: streaming snapshot of %d users", info.Users)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="snapshot.json"`)
+		w.Write(body)
+	case http.MethodPost:
+		if snapshotPath == "" {
+			log.Printf("handleAdminSnapshot: no snapshot file configured")
+			http.Error(w, "No snapshot file configured, start the server with -snapshot", http.StatusConflict)
+			return
+		}
+		info, err := WriteSnapshot(snapshotPath)
+		if err != nil {
+			log.Printf("handleAdminSnapshot: %v", err)
+			http.Error(w, "Could not write snapshot", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("handleAdminSnapshot: wrote %d users to %s", info.Users, info.Path)
+		json.NewEncoder(w).Encode(info)
+	default:
+		log.Printf("handleAdminSnapshot: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"platform-go-challenge/models"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	resetStore()
+	ownerID, memberID := uuid.New(), uuid.New()
+	rule, _ := models.ParseRule(`gender = "Female" AND age BETWEEN 18 AND 24`)
+	chart := &Chart{ID: uuid.New(), Title: "Sales", Data: []float64{1, 2}, Position: 1024}
+	audience := &Audience{ID: uuid.New(), Rules: rule, Pinned: true}
+	insight := &Insight{ID: uuid.New(), Text: "Up", RelatedAssets: []uuid.UUID{chart.ID}}
+	owner := &User{ID: ownerID, Favourites: []Asset{chart, audience, insight}}
+	owner.Collections = []*Collection{{ID: uuid.New(), Name: "Report", AssetIDs: []uuid.UUID{chart.ID}}}
+	store.AddUser(owner)
+	store.AddUser(&User{ID: memberID})
+	store.TrashAsset(owner, insight.ID, time.Now().UTC())
+	recordRevision(owner, chart, ownerID, "create")
+	orgID := uuid.New()
+	store.CreateOrg(&Organisation{ID: orgID, Name: "GWI", OwnerID: ownerID})
+	store.InviteOrgMember(orgID, memberID)
+	store.JoinOrg(orgID, memberID)
+	store.PutShare(&Share{ID: uuid.New(), TenantID: orgID, OwnerID: ownerID, GranteeID: memberID, AssetID: chart.ID, Permission: PermRead})
+	link := &ShareLink{ID: uuid.New(), OwnerID: ownerID, AssetID: chart.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	link.setPassword("secret")
+	store.PutLink(link)
+	store.PutTeam(&Team{ID: uuid.New(), OrgID: orgID, Name: "Team", Members: []uuid.UUID{ownerID}, Assets: []Asset{&Chart{ID: uuid.New(), Title: "Team chart"}}})
+
+	path := filepath.Join(t.TempDir(), "store.snapshot")
+	info, err := WriteSnapshot(path)
+	if err != nil {
+		t.Fatalf("writing snapshot: %v", err)
+	}
+	if info.Users != 2 || info.Version != snapshotVersion {
+		t.Errorf("unexpected snapshot info %+v", info)
+	}
+	resetStore()
+	if _, err := RestoreSnapshot(path); err != nil {
+		t.Fatalf("restoring snapshot: %v", err)
+	}
+
+	restored := store.GetTenantUser(orgID, ownerID)
+	if restored == nil || len(restored.Favourites) != 2 || len(restored.Trash) != 1 || len(restored.History[chart.ID]) != 1 {
+		t.Fatalf("unexpected restored user %+v", restored)
+	}
+	gotAudience, ok := findAsset(restored, audience.ID).(*Audience)
+	if !ok || gotAudience.Rules.String() != rule.String() || !gotAudience.Pinned {
+		t.Errorf("unexpected restored audience %+v", gotAudience)
+	}
+	if _, ok := restored.Trash[0].Asset.(*Insight); !ok {
+		t.Errorf("expected trashed insight, got %T", restored.Trash[0].Asset)
+	}
+	if !findCollection(restored, owner.Collections[0].ID).hasAsset(chart.ID) {
+		t.Error("expected collection membership restored")
+	}
+	if len(store.SharesForGrantee(orgID, memberID)) != 1 || store.GetOrg(orgID) == nil {
+		t.Error("expected shares and organisation restored")
+	}
+	if l := store.GetLink(link.ID); l == nil || !l.checkPassword("secret") || l.checkPassword("wrong") {
+		t.Error("expected link password hash restored")
+	}
+	if teams := store.TeamsOf(orgID, ownerID); len(teams) != 1 || teams[0].Assets[0].(*Chart).Title != "Team chart" {
+		t.Error("expected team workspace restored")
+	}
+}
+
+func TestSnapshot_RejectsCorruption(t *testing.T) {
+	resetStore()
+	store.AddUser(&User{ID: uuid.New(), Favourites: []Asset{&Chart{ID: uuid.New(), Title: "Sales"}}})
+	path := filepath.Join(t.TempDir(), "store.snapshot")
+	if _, err := WriteSnapshot(path); err != nil {
+		t.Fatalf("writing snapshot: %v", err)
+	}
+	body, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.Replace(body, []byte("Sales"), []byte("Sabes"), 1), 0o600)
+	if _, err := RestoreSnapshot(path); err != errSnapshotChecksum {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+	// No temporary files are left behind
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected only the snapshot file, got %d entries", len(entries))
+	}
+}
+
+func TestAdminSnapshotEndpoint(t *testing.T) {
+	resetStore()
+	adminToken, snapshotPath = "operator-secret", filepath.Join(t.TempDir(), "store.snapshot")
+	defer func() { adminToken, snapshotPath = "", "" }()
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, adminToken: http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		AdminMiddleware(handleAdminSnapshot)(w, req)
+		if w.Code != want {
+			t.Errorf("token %q: expected status %d, got %d", token, want, w.Code)
+		}
+	}
+	if _, err := os.Stat(snapshotPath); err != nil {
+		t.Errorf("expected snapshot file written: %v", err)
+	}
+}
@@ -1,20 +1,67 @@
 package main
 
 import (
+	"errors"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// Storage keeps every tenant's data in memory. Lookups made on behalf of a
+// request go through the tenant-scoped accessors, which never return objects
+// of another tenant; users outside any organisation share the tenant uuid.Nil.
 type Storage struct {
-	mu    sync.RWMutex
-	users map[uuid.UUID]*User
+	// mu guards the maps and what they hold. Stored assets, collections,
+	// shares and organisations are replaced rather than changed in place, so
+	// what a reader got under the read lock stays valid once it unlocks.
+	// writeMu orders the commits to the write-ahead log with snapshots.
+	writeMu sync.Mutex
+	mu      sync.RWMutex
+	users   map[uuid.UUID]*User
+	shares  map[uuid.UUID]*Share
+	links   map[uuid.UUID]*ShareLink
+	orgs    map[uuid.UUID]*Organisation
+	teams   map[uuid.UUID]*Team
+	// webhooks and their queued and logged deliveries
+	webhooks   map[uuid.UUID]*Webhook
+	deliveries map[uuid.UUID]*Delivery
+
+	// With a write-ahead log, changes are collected here until the
+	// mutation commits; see commit in wal.go
+	wal        *WAL
+	pending    []walOp
+	dirtyUsers map[uuid.UUID]*userChange
+	dirtyTeams map[uuid.UUID]*Team
+	// events are published once the mutation commits
+	events []Event
 }
 
 var store = Storage{
-	users: make(map[uuid.UUID]*User),
+	users:  make(map[uuid.UUID]*User),
+	shares: make(map[uuid.UUID]*Share),
+	links:  make(map[uuid.UUID]*ShareLink),
+	orgs:   make(map[uuid.UUID]*Organisation),
+	teams:  make(map[uuid.UUID]*Team),
+
+	webhooks:   make(map[uuid.UUID]*Webhook),
+	deliveries: make(map[uuid.UUID]*Delivery),
 }
 
+var (
+	errCrossTenant  = errors.New("users belong to different tenants")
+	errAlreadyInOrg = errors.New("user already belongs to an organisation")
+	errNotInOrg     = errors.New("user is not a member of the organisation")
+	errNotInvited   = errors.New("user has no invitation to the organisation")
+	errNotInTeam    = errors.New("user is not a member of the team")
+	errTeamNotFound = errors.New("team not found")
+	errAssetExists  = errors.New("an asset with the same ID is in favourites")
+
+	errCollectionExists = errors.New("collection name already exists")
+	errNotInCollection  = errors.New("asset is not in the collection")
+)
+
 func (s *Storage) GetUser(id uuid.UUID) *User {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -25,4 +72,934 @@ func (s *Storage) AddUser(u *User) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.users[u.ID] = u
+	s.touchUserLocked(u)
+}
+
+// GetTenantUser returns the user only if it belongs to the tenant
+func (s *Storage) GetTenantUser(tenantID, id uuid.UUID) *User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.users[id]
+	if u == nil || u.TenantID != tenantID {
+		return nil
+	}
+	return u
+}
+
+// TenantOf returns the tenant the user belongs to
+func (s *Storage) TenantOf(u *User) uuid.UUID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return u.TenantID
+}
+
+// PutShare stores a share, or updates the permission of the existing share
+// of the same target with the same grantee. It reports whether a new share was
+// created, and refuses shares between users of different tenants.
+func (s *Storage) PutShare(share *Share) (*Share, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner, grantee := s.users[share.OwnerID], s.users[share.GranteeID]
+	if owner == nil || grantee == nil || owner.TenantID != share.TenantID || grantee.TenantID != share.TenantID {
+		return nil, false, errCrossTenant
+	}
+	for _, existing := range s.shares {
+		if existing.OwnerID == share.OwnerID && existing.GranteeID == share.GranteeID &&
+			existing.AssetID == share.AssetID && existing.CollectionID == share.CollectionID {
+			updated := *existing
+			updated.Permission = share.Permission
+			s.shares[updated.ID] = &updated
+			s.logLocked(walOp{Op: opPutShare, Share: &updated})
+			return &updated, false, nil
+		}
+	}
+	s.shares[share.ID] = share
+	s.logLocked(walOp{Op: opPutShare, Share: share})
+	return share, true, nil
+}
+
+// GetShare returns the share only if it belongs to the tenant
+func (s *Storage) GetShare(tenantID, id uuid.UUID) *Share {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	share := s.shares[id]
+	if share == nil || share.TenantID != tenantID {
+		return nil
+	}
+	return share
+}
+
+func (s *Storage) RemoveShare(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteShareLocked(id)
+}
+
+func (s *Storage) deleteShareLocked(id uuid.UUID) {
+	delete(s.shares, id)
+	s.logLocked(walOp{Op: opDeleteShare, ID: id})
+}
+
+// RemoveSharesOf drops every share of the owner's asset or collection
+func (s *Storage) RemoveSharesOf(ownerID, targetID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeSharesLocked(ownerID, targetID)
+}
+
+func (s *Storage) removeSharesLocked(ownerID, targetID uuid.UUID) {
+	for id, share := range s.shares {
+		if share.OwnerID == ownerID && (share.AssetID == targetID || share.CollectionID == targetID) {
+			s.deleteShareLocked(id)
+		}
+	}
+}
+
+// SharesByOwner returns the shares granted by the user within the tenant, oldest first
+func (s *Storage) SharesByOwner(tenantID, ownerID uuid.UUID) []*Share {
+	return s.filterShares(tenantID, func(share *Share) bool { return share.OwnerID == ownerID })
+}
+
+// SharesForGrantee returns the shares granted to the user within the tenant, oldest first
+func (s *Storage) SharesForGrantee(tenantID, granteeID uuid.UUID) []*Share {
+	return s.filterShares(tenantID, func(share *Share) bool { return share.GranteeID == granteeID })
+}
+
+func (s *Storage) filterShares(tenantID uuid.UUID, keep func(*Share) bool) []*Share {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Share, 0)
+	for _, share := range s.shares {
+		if share.TenantID == tenantID && keep(share) {
+			out = append(out, share)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func (s *Storage) PutLink(link *ShareLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[link.ID] = link
+	s.logLocked(walOp{Op: opPutLink, Link: newLinkRecord(link)})
+}
+
+func (s *Storage) GetLink(id uuid.UUID) *ShareLink {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links[id]
+}
+
+func (s *Storage) RemoveLink(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteLinkLocked(id)
+}
+
+func (s *Storage) deleteLinkLocked(id uuid.UUID) {
+	delete(s.links, id)
+	s.logLocked(walOp{Op: opDeleteLink, ID: id})
+}
+
+// LinksOf returns the public links of the owner's asset, oldest first
+func (s *Storage) LinksOf(ownerID, assetID uuid.UUID) []*ShareLink {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*ShareLink, 0)
+	for _, link := range s.links {
+		if link.OwnerID == ownerID && link.AssetID == assetID {
+			out = append(out, link)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// RemoveLinksOf drops every public link of the owner's asset
+func (s *Storage) RemoveLinksOf(ownerID, assetID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLinksLocked(ownerID, assetID)
+}
+
+func (s *Storage) removeLinksLocked(ownerID, assetID uuid.UUID) {
+	for id, link := range s.links {
+		if link.OwnerID == ownerID && link.AssetID == assetID {
+			s.deleteLinkLocked(id)
+		}
+	}
+}
+
+// TrashAsset moves one of the user's favourites into their trash, taking it
+// out of its collections. Shares and links stay until the asset is purged.
+func (s *Storage) TrashAsset(u *User, assetID uuid.UUID, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	for n, asset := range u.Favourites {
+		if asset.GetID() != assetID {
+			continue
+		}
+		entry := &TrashedAsset{Asset: asset, DeletedAt: now}
+		for _, c := range u.Collections {
+			if c.hasAsset(assetID) {
+				entry.CollectionIDs = append(entry.CollectionIDs, c.ID)
+				updateCollection(u, c.ID, func(c *Collection) { c.AssetIDs = removeID(c.AssetIDs, assetID) })
+			}
+		}
+		u.Favourites = append(u.Favourites[:n:n], u.Favourites[n+1:]...)
+		u.Trash = append(u.Trash, entry)
+		return true
+	}
+	return false
+}
+
+// TrashOf returns the user's trash, oldest deletion first
+func (s *Storage) TrashOf(u *User) []*TrashedAsset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*TrashedAsset{}, u.Trash...)
+}
+
+// RestoreAsset moves an asset out of the user's trash back into their
+// favourites and into the collections that still exist
+func (s *Storage) RestoreAsset(u *User, assetID uuid.UUID) (Asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	for n, entry := range u.Trash {
+		if entry.Asset.GetID() != assetID {
+			continue
+		}
+		if lookupAsset(u.Favourites, assetID) != nil {
+			return nil, errAssetExists
+		}
+		for _, id := range entry.CollectionIDs {
+			if c := lookupCollection(u.Collections, id); c != nil && !c.hasAsset(assetID) {
+				updateCollection(u, id, func(c *Collection) { c.AssetIDs = append(c.AssetIDs, assetID) })
+			}
+		}
+		u.Trash = append(u.Trash[:n:n], u.Trash[n+1:]...)
+		u.Favourites = append(u.Favourites, entry.Asset)
+		return entry.Asset, nil
+	}
+	return nil, errAssetNotFound
+}
+
+// PurgeTrash permanently deletes an asset from the user's trash, or the whole
+// trash when assetID is uuid.Nil. It returns the number of purged assets.
+func (s *Storage) PurgeTrash(u *User, assetID uuid.UUID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.purgeLocked(u, func(entry *TrashedAsset) bool {
+		return assetID == uuid.Nil || entry.Asset.GetID() == assetID
+	})
+}
+
+// PurgeExpiredTrash permanently deletes every asset trashed before the cutoff
+func (s *Storage) PurgeExpiredTrash(cutoff time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := 0
+	for _, u := range s.users {
+		purged += s.purgeLocked(u, func(entry *TrashedAsset) bool { return entry.DeletedAt.Before(cutoff) })
+	}
+	return purged
+}
+
+// purgeLocked drops the matching trash entries along with their shares and
+// public links. The caller holds s.mu.
+func (s *Storage) purgeLocked(u *User, match func(*TrashedAsset) bool) int {
+	kept := make([]*TrashedAsset, 0, len(u.Trash))
+	for _, entry := range u.Trash {
+		if !match(entry) {
+			kept = append(kept, entry)
+			continue
+		}
+		s.removeSharesLocked(u.ID, entry.Asset.GetID())
+		s.removeLinksLocked(u.ID, entry.Asset.GetID())
+		delete(u.History, entry.Asset.GetID())
+		s.logLocked(walOp{Op: opDropHistory, ID: u.ID, AssetID: entry.Asset.GetID()})
+	}
+	purged := len(u.Trash) - len(kept)
+	if purged > 0 {
+		s.touchLocked(u)
+		u.Trash = kept
+	}
+	return purged
+}
+
+// AddRevision appends a revision to the history of the user's asset, numbering
+// it after the last one and dropping the oldest beyond maxRevisions
+func (s *Storage) AddRevision(u *User, assetID uuid.UUID, rev *Revision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u.History == nil {
+		u.History = make(map[uuid.UUID][]*Revision)
+	}
+	history := u.History[assetID]
+	rev.Number = 1
+	if len(history) > 0 {
+		rev.Number = history[len(history)-1].Number + 1
+	}
+	history = append(history, rev)
+	if len(history) > maxRevisions {
+		history = history[len(history)-maxRevisions:]
+	}
+	u.History[assetID] = history
+	s.logLocked(walOp{Op: opAddRevision, ID: u.ID, AssetID: assetID, Revision: rev})
+}
+
+// RevisionsOf returns the history of the user's asset, oldest first
+func (s *Storage) RevisionsOf(u *User, assetID uuid.UUID) []*Revision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Revision{}, u.History[assetID]...)
+}
+
+// FavouritesOf returns the user's assets. Neither the slice nor the assets
+// are changed in place, so they can be read without the lock, never modified.
+func (s *Storage) FavouritesOf(u *User) []Asset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return u.Favourites
+}
+
+// AddAsset appends an asset to the user's favourites, last in its pin group
+func (s *Storage) AddAsset(u *User, asset Asset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	if lookupAsset(u.Favourites, asset.GetID()) != nil {
+		return errAssetExists
+	}
+	asset.SetPosition(nextPosition(u, asset.IsPinned()))
+	u.Favourites = append(u.Favourites, asset)
+	return nil
+}
+
+// ReplaceAsset swaps the user's favourite with the same ID for the given asset
+func (s *Storage) ReplaceAsset(u *User, asset Asset) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	if !putAsset(u, asset) {
+		return false
+	}
+	return true
+}
+
+// UpdateAsset replaces the user's asset with the one update builds from it.
+// update runs under the lock with the stored asset and favourites, so
+// concurrent updates cannot overwrite each other. The asset keeps its
+// position and pin.
+func (s *Storage) UpdateAsset(u *User, assetID uuid.UUID, update func(current Asset, favourites []Asset) (Asset, error)) (Asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	current := lookupAsset(u.Favourites, assetID)
+	if current == nil {
+		return nil, errAssetNotFound
+	}
+	asset, err := update(current, u.Favourites)
+	if err != nil {
+		return nil, err
+	}
+	asset.SetPosition(current.GetPosition())
+	asset.SetPinned(current.IsPinned())
+	putAsset(u, asset)
+	return asset, nil
+}
+
+// EditAsset applies edit to a copy of the user's asset, stores the copy in
+// its place and returns it
+func (s *Storage) EditAsset(u *User, assetID uuid.UUID, edit func(Asset)) (Asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	current := lookupAsset(u.Favourites, assetID)
+	if current == nil {
+		return nil, errAssetNotFound
+	}
+	asset := copyAsset(current)
+	edit(asset)
+	putAsset(u, asset)
+	return asset, nil
+}
+
+// putAsset stores the asset in place of the user's asset with the same ID,
+// in a new slice as readers may hold the old one. The caller holds s.mu.
+func putAsset(u *User, asset Asset) bool {
+	for n, existing := range u.Favourites {
+		if existing.GetID() == asset.GetID() {
+			favourites := append([]Asset{}, u.Favourites...)
+			favourites[n] = asset
+			u.Favourites = favourites
+			return true
+		}
+	}
+	return false
+}
+
+// MoveAsset places one of the user's favourites right before (or after) the
+// reference asset and returns it
+func (s *Storage) MoveAsset(u *User, assetID, refID uuid.UUID, after bool) (Asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	asset, ref := lookupAsset(u.Favourites, assetID), lookupAsset(u.Favourites, refID)
+	if asset == nil || ref == nil {
+		return nil, errAssetNotFound
+	}
+	moved, err := moveAsset(u, asset, ref, after)
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// PinAsset pins or unpins one of the user's favourites, placing it last in
+// its new pin group. It returns the asset, nil if there is none, and whether
+// it changed.
+func (s *Storage) PinAsset(u *User, assetID uuid.UUID, pinned bool) (Asset, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	asset := lookupAsset(u.Favourites, assetID)
+	if asset == nil || asset.IsPinned() == pinned {
+		return asset, false
+	}
+	asset = copyAsset(asset)
+	asset.SetPosition(nextPosition(u, pinned))
+	asset.SetPinned(pinned)
+	putAsset(u, asset)
+	return asset, true
+}
+
+// CollectionsOf returns the user's collections; like FavouritesOf, they are
+// never changed in place
+func (s *Storage) CollectionsOf(u *User) []*Collection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return u.Collections
+}
+
+// AddCollection creates a collection of the user; names are unique per user
+func (s *Storage) AddCollection(u *User, c *Collection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	if collectionNameTaken(u, c.Name, c.ID) {
+		return errCollectionExists
+	}
+	u.Collections = append(u.Collections, c)
+	return nil
+}
+
+// RenameCollection renames one of the user's collections and returns it
+func (s *Storage) RenameCollection(u *User, collectionID uuid.UUID, name string) (*Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	if lookupCollection(u.Collections, collectionID) == nil {
+		return nil, errCollectionNotFound
+	}
+	if collectionNameTaken(u, name, collectionID) {
+		return nil, errCollectionExists
+	}
+	c := updateCollection(u, collectionID, func(c *Collection) { c.Name = name })
+	return c, nil
+}
+
+// RemoveCollection deletes one of the user's collections with its shares;
+// the assets stay in favourites
+func (s *Storage) RemoveCollection(u *User, collectionID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	collections := make([]*Collection, 0, len(u.Collections))
+	for _, c := range u.Collections {
+		if c.ID != collectionID {
+			collections = append(collections, c)
+		}
+	}
+	if len(collections) == len(u.Collections) {
+		return false
+	}
+	u.Collections = collections
+	s.removeSharesLocked(u.ID, collectionID)
+	return true
+}
+
+// AddCollectionAsset adds one of the user's favourites to their collection
+// and returns the collection
+func (s *Storage) AddCollectionAsset(u *User, collectionID, assetID uuid.UUID) (*Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	c := lookupCollection(u.Collections, collectionID)
+	if c == nil {
+		return nil, errCollectionNotFound
+	}
+	if lookupAsset(u.Favourites, assetID) == nil {
+		return nil, errAssetNotFound
+	}
+	if c.hasAsset(assetID) {
+		return c, nil
+	}
+	c = updateCollection(u, collectionID, func(c *Collection) { c.AssetIDs = append(c.AssetIDs, assetID) })
+	return c, nil
+}
+
+// RemoveCollectionAsset takes an asset out of the user's collection and
+// returns the collection
+func (s *Storage) RemoveCollectionAsset(u *User, collectionID, assetID uuid.UUID) (*Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchLocked(u)
+	c := lookupCollection(u.Collections, collectionID)
+	if c == nil {
+		return nil, errCollectionNotFound
+	}
+	if !c.hasAsset(assetID) {
+		return nil, errNotInCollection
+	}
+	c = updateCollection(u, collectionID, func(c *Collection) { c.AssetIDs = removeID(c.AssetIDs, assetID) })
+	return c, nil
+}
+
+// updateCollection applies edit to a copy of the user's collection, with its
+// own asset IDs, and stores the copy in its place in a new slice. The caller
+// holds s.mu.
+func updateCollection(u *User, collectionID uuid.UUID, edit func(*Collection)) *Collection {
+	for n, c := range u.Collections {
+		if c.ID != collectionID {
+			continue
+		}
+		updated := *c
+		updated.AssetIDs = append([]uuid.UUID{}, c.AssetIDs...)
+		edit(&updated)
+		collections := append([]*Collection{}, u.Collections...)
+		collections[n] = &updated
+		u.Collections = collections
+		return &updated
+	}
+	return nil
+}
+
+// CreateOrg stores a new organisation with its owner as first member. The
+// owner must not belong to an organisation yet.
+func (s *Storage) CreateOrg(org *Organisation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner := s.users[org.OwnerID]
+	if owner == nil || owner.TenantID != uuid.Nil {
+		return errAlreadyInOrg
+	}
+	s.orgs[org.ID] = org
+	org.Members = []uuid.UUID{owner.ID}
+	s.moveUserLocked(owner, org.ID)
+	s.logLocked(walOp{Op: opPutOrg, Org: org})
+	return nil
+}
+
+// GetOrg returns the organisation of the tenant, nil for the tenant uuid.Nil
+func (s *Storage) GetOrg(tenantID uuid.UUID) *Organisation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.orgs[tenantID]
+}
+
+// InviteOrgMember invites a user without organisation to join it; nothing
+// changes for the user until they accept with JoinOrg
+func (s *Storage) InviteOrgMember(orgID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	org, u := s.orgs[orgID], s.users[userID]
+	if org == nil || u == nil || u.TenantID != uuid.Nil {
+		return errAlreadyInOrg
+	}
+	if containsID(org.Invited, userID) {
+		return nil
+	}
+	updated := *org
+	updated.Invited = append(append([]uuid.UUID{}, org.Invited...), userID)
+	s.orgs[orgID] = &updated
+	s.logLocked(walOp{Op: opPutOrg, Org: &updated})
+	return nil
+}
+
+// JoinOrg accepts an invitation, moving the user into the organisation
+func (s *Storage) JoinOrg(orgID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	org, u := s.orgs[orgID], s.users[userID]
+	if org == nil || u == nil || !containsID(org.Invited, userID) {
+		return errNotInvited
+	}
+	if u.TenantID != uuid.Nil {
+		return errAlreadyInOrg
+	}
+	updated := *org
+	updated.Invited = removeID(org.Invited, userID)
+	updated.Members = append(append([]uuid.UUID{}, org.Members...), userID)
+	s.orgs[orgID] = &updated
+	s.moveUserLocked(u, orgID)
+	s.logLocked(walOp{Op: opPutOrg, Org: &updated})
+	return nil
+}
+
+// DeclineOrgInvite drops the user's invitation to the organisation
+func (s *Storage) DeclineOrgInvite(orgID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	org := s.orgs[orgID]
+	if org == nil || !containsID(org.Invited, userID) {
+		return errNotInvited
+	}
+	updated := *org
+	updated.Invited = removeID(org.Invited, userID)
+	s.orgs[orgID] = &updated
+	s.logLocked(walOp{Op: opPutOrg, Org: &updated})
+	return nil
+}
+
+// InvitationsOf returns the organisations that invited the user, oldest first
+func (s *Storage) InvitationsOf(userID uuid.UUID) []*Organisation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []*Organisation{}
+	for _, org := range s.orgs {
+		if containsID(org.Invited, userID) {
+			out = append(out, org)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// RemoveOrgMember moves a member out of the organisation and its teams. The
+// member keeps their favourites, collections, trash and history, which may
+// predate the organisation; only their shares are dropped.
+func (s *Storage) RemoveOrgMember(orgID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	org, u := s.orgs[orgID], s.users[userID]
+	if org == nil || u == nil || u.TenantID != orgID || userID == org.OwnerID {
+		return errNotInOrg
+	}
+	updated := *org
+	updated.Members = removeID(org.Members, userID)
+	s.orgs[orgID] = &updated
+	for _, team := range s.teams {
+		if team.OrgID == orgID && containsID(team.Members, userID) {
+			s.removeTeamMemberLocked(team, userID)
+		}
+	}
+	s.moveUserLocked(u, uuid.Nil)
+	s.logLocked(walOp{Op: opPutOrg, Org: &updated})
+	return nil
+}
+
+// moveUserLocked changes the tenant of a user, dropping the shares that would
+// otherwise cross tenants. The caller holds s.mu.
+func (s *Storage) moveUserLocked(u *User, tenantID uuid.UUID) {
+	for id, share := range s.shares {
+		if share.OwnerID == u.ID || share.GranteeID == u.ID {
+			s.deleteShareLocked(id)
+		}
+	}
+	u.TenantID = tenantID
+	s.touchUserLocked(u)
+}
+
+// PutTeam stores a team; its members must belong to the team's organisation
+func (s *Storage) PutTeam(team *Team) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range team.Members {
+		if u := s.users[id]; u == nil || u.TenantID != team.OrgID {
+			return errCrossTenant
+		}
+	}
+	s.teams[team.ID] = team
+	s.touchTeamLocked(team)
+	return nil
+}
+
+// AddTeamMember adds a user of the team's organisation to the team
+func (s *Storage) AddTeamMember(team *Team, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.teams[team.ID] != team {
+		return errTeamNotFound
+	}
+	if u := s.users[userID]; u == nil || u.TenantID != team.OrgID {
+		return errCrossTenant
+	}
+	if !containsID(team.Members, userID) {
+		team.Members = append(team.Members, userID)
+		s.touchTeamLocked(team)
+	}
+	return nil
+}
+
+// RemoveTeamMember takes a user out of the team, deleting the team when its
+// last member leaves
+func (s *Storage) RemoveTeamMember(team *Team, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.teams[team.ID] != team {
+		return errTeamNotFound
+	}
+	if !containsID(team.Members, userID) {
+		return errNotInTeam
+	}
+	s.removeTeamMemberLocked(team, userID)
+	return nil
+}
+
+// removeTeamMemberLocked takes a member out of the team, deleting the team
+// when it has no members left. The caller holds s.mu.
+func (s *Storage) removeTeamMemberLocked(team *Team, userID uuid.UUID) {
+	team.Members = removeID(team.Members, userID)
+	if len(team.Members) == 0 {
+		s.deleteTeamLocked(team)
+		return
+	}
+	s.touchTeamLocked(team)
+}
+
+// RemoveTeam deletes a team along with its workspace assets
+func (s *Storage) RemoveTeam(team *Team) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteTeamLocked(team)
+}
+
+func (s *Storage) deleteTeamLocked(team *Team) {
+	delete(s.teams, team.ID)
+	if s.dirtyTeams != nil {
+		delete(s.dirtyTeams, team.ID)
+	}
+	s.logLocked(walOp{Op: opDeleteTeam, ID: team.ID})
+}
+
+// AddTeamAsset adds an asset to the team's workspace
+func (s *Storage) AddTeamAsset(team *Team, asset Asset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.teams[team.ID] != team {
+		return errTeamNotFound
+	}
+	if lookupAsset(team.Assets, asset.GetID()) != nil {
+		return errAssetExists
+	}
+	team.Assets = append(team.Assets, asset)
+	s.touchTeamLocked(team)
+	return nil
+}
+
+// RemoveTeamAsset deletes an asset from the team's workspace
+func (s *Storage) RemoveTeamAsset(team *Team, assetID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.teams[team.ID] != team {
+		return false
+	}
+	for n, asset := range team.Assets {
+		if asset.GetID() == assetID {
+			team.Assets = append(team.Assets[:n:n], team.Assets[n+1:]...)
+			s.touchTeamLocked(team)
+			return true
+		}
+	}
+	return false
+}
+
+// TeamAssets returns the assets of the team's workspace
+func (s *Storage) TeamAssets(team *Team) []Asset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Asset{}, team.Assets...)
+}
+
+// CopyTeam returns a copy of the team that stays unchanged as the team does
+func (s *Storage) CopyTeam(team *Team) *Team {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyTeamLocked(team)
+}
+
+func copyTeamLocked(team *Team) *Team {
+	c := *team
+	c.Members = append([]uuid.UUID{}, team.Members...)
+	c.Assets = append([]Asset{}, team.Assets...)
+	return &c
+}
+
+// GetTeam returns the team only if it belongs to the tenant
+func (s *Storage) GetTeam(tenantID, id uuid.UUID) *Team {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	team := s.teams[id]
+	if team == nil || team.OrgID != tenantID {
+		return nil
+	}
+	return team
+}
+
+// TeamsOf returns copies of the teams of the tenant the user is a member of,
+// oldest first
+func (s *Storage) TeamsOf(tenantID, userID uuid.UUID) []*Team {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Team, 0)
+	for _, team := range s.teams {
+		if team.OrgID == tenantID && containsID(team.Members, userID) {
+			out = append(out, copyTeamLocked(team))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// PutWebhook registers or replaces a webhook
+func (s *Storage) PutWebhook(wh *Webhook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[wh.ID] = wh
+	s.logLocked(walOp{Op: opPutWebhook, Webhook: wh})
+}
+
+// GetWebhook returns the webhook only if it belongs to the owner; admin
+// webhooks have the owner uuid.Nil
+func (s *Storage) GetWebhook(ownerID, id uuid.UUID) *Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	wh := s.webhooks[id]
+	if wh == nil || wh.OwnerID != ownerID {
+		return nil
+	}
+	return wh
+}
+
+// webhook returns a webhook whatever its owner, for the dispatcher
+func (s *Storage) webhook(id uuid.UUID) *Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.webhooks[id]
+}
+
+// WebhooksOf returns the owner's webhooks, oldest first
+func (s *Storage) WebhooksOf(ownerID uuid.UUID) []*Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Webhook, 0)
+	for _, wh := range s.webhooks {
+		if wh.OwnerID == ownerID {
+			out = append(out, wh)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// RemoveWebhook deletes a webhook with its deliveries
+func (s *Storage) RemoveWebhook(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteWebhookLocked(id)
+	s.logLocked(walOp{Op: opDeleteWebhook, ID: id})
+}
+
+func (s *Storage) deleteWebhookLocked(id uuid.UUID) {
+	delete(s.webhooks, id)
+	for deliveryID, d := range s.deliveries {
+		if d.WebhookID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+}
+
+// PutDelivery stores a delivery. Deliveries are replaced rather than changed
+// in place, as readers don't hold the write lock. Beyond webhookLogSize
+// delivered ones per webhook, the oldest are dropped.
+func (s *Storage) PutDelivery(d *Delivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[d.ID] = d
+	s.logLocked(walOp{Op: opPutDelivery, Delivery: d})
+	if d.Status != deliveryDelivered {
+		return
+	}
+	delivered := s.filterDeliveriesLocked(d.WebhookID, deliveryDelivered)
+	for _, old := range delivered[min(len(delivered), webhookLogSize):] {
+		delete(s.deliveries, old.ID)
+		s.logLocked(walOp{Op: opDeleteDelivery, ID: old.ID})
+	}
+}
+
+// GetDelivery returns the delivery only if it belongs to the webhook
+func (s *Storage) GetDelivery(webhookID, id uuid.UUID) *Delivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d := s.deliveries[id]
+	if d == nil || d.WebhookID != webhookID {
+		return nil
+	}
+	return d
+}
+
+// DeliveriesOf returns the webhook's deliveries with the status, or all of
+// them if status is empty, newest first
+func (s *Storage) DeliveriesOf(webhookID uuid.UUID, status string) []*Delivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filterDeliveriesLocked(webhookID, status)
+}
+
+func (s *Storage) filterDeliveriesLocked(webhookID uuid.UUID, status string) []*Delivery {
+	out := make([]*Delivery, 0)
+	for _, d := range s.deliveries {
+		if d.WebhookID == webhookID && (status == "" || d.Status == status) {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// DueDeliveries returns the pending deliveries due by now, oldest first
+func (s *Storage) DueDeliveries(now time.Time) []*Delivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Delivery, 0)
+	for _, d := range s.deliveries {
+		if d.Status == deliveryPending && !d.NextAttemptAt.After(now) {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeID(ids []uuid.UUID, id uuid.UUID) []uuid.UUID {
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, other := range ids {
+		if other != id {
+			out = append(out, other)
+		}
+	}
+	return out
 }
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organisation is a tenant: its ID is the TenantID of its members and of
+// everything they own
+type Organisation struct {
+	ID        uuid.UUID   `json:"id"`
+	Name      string      `json:"name"`
+	OwnerID   uuid.UUID   `json:"owner_id"`
+	Members   []uuid.UUID `json:"members"`
+	Invited   []uuid.UUID `json:"invited"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Invitation is what an invited user sees of the organisation
+type Invitation struct {
+	OrgID   uuid.UUID `json:"org_id"`
+	Name    string    `json:"name"`
+	OwnerID uuid.UUID `json:"owner_id"`
+}
+
+// Team is a group of organisation members sharing a workspace of assets
+type Team struct {
+	ID        uuid.UUID   `json:"id"`
+	OrgID     uuid.UUID   `json:"org_id"`
+	Name      string      `json:"name"`
+	Members   []uuid.UUID `json:"members"`
+	Assets    []Asset     `json:"assets"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// requireOrg resolves the organisation of the authenticated user
+func requireOrg(w http.ResponseWriter, user *User, handler string) (*Organisation, bool) {
+	org := store.GetOrg(user.TenantID)
+	if org == nil {
+		log.Printf("%s: user %s is not in an organisation", handler, user.ID)
+		http.Error(w, "User is not in an organisation", http.StatusNotFound)
+		return nil, false
+	}
+	return org, true
+}
+
+// Creates an organisation owned by the user (POST), or returns the user's one (GET)
+func handleOrgs(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleOrgs")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		org, ok := requireOrg(w, user, "handleOrgs")
+		if !ok {
+			return
+		}
+		json.NewEncoder(w).Encode(org)
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+			log.Printf("handleOrgs: invalid request body: %v", err)
+			http.Error(w, "Organisation name is required", http.StatusBadRequest)
+			return
+		}
+		org := &Organisation{ID: uuid.New(), Name: strings.TrimSpace(req.Name), OwnerID: user.ID, CreatedAt: time.Now().UTC()}
+		if err := store.CreateOrg(org); err != nil {
+			log.Printf("handleOrgs: %v", err)
+			http.Error(w, "User already belongs to an organisation", http.StatusConflict)
+			return
+		}
+		log.Printf("handleOrgs: user %s created organisation %s", user.ID, org.ID)
+		// The tenant changed, so the caller needs a token for the new one
+		token, err := GenerateTenantJWT(user.ID, org.ID)
+		if err != nil {
+			log.Printf("handleOrgs: could not generate token: %v", err)
+			http.Error(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+		resp := struct {
+			*Organisation
+			Token string `json:"token"`
+		}{Organisation: org, Token: token}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	default:
+		log.Printf("handleOrgs: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Invites (POST) or removes (DELETE) an organisation member; owner only.
+// Invited users join through /orgs/invitations; removed members need a new
+// token from /token.
+func handleOrgMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		log.Printf("handleOrgMembers: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleOrgMembers")
+	if !ok {
+		return
+	}
+	org, ok := requireOrg(w, user, "handleOrgMembers")
+	if !ok {
+		return
+	}
+	if org.OwnerID != user.ID {
+		log.Printf("handleOrgMembers: user %s does not own organisation %s", user.ID, org.ID)
+		http.Error(w, "Only the organisation owner can manage members", http.StatusForbidden)
+		return
+	}
+	memberID, ok := parseUserID(r, w)
+	if !ok {
+		log.Printf("handleOrgMembers: invalid user_id")
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err := store.InviteOrgMember(org.ID, memberID); err != nil {
+			log.Printf("handleOrgMembers: cannot invite %s: %v", memberID, err)
+			http.Error(w, "User not found or already in an organisation", http.StatusConflict)
+			return
+		}
+		log.Printf("handleOrgMembers: invited %s to organisation %s", memberID, org.ID)
+	} else {
+		if memberID == org.OwnerID {
+			log.Printf("handleOrgMembers: owner cannot leave organisation %s", org.ID)
+			http.Error(w, "The owner cannot be removed", http.StatusBadRequest)
+			return
+		}
+		if err := store.RemoveOrgMember(org.ID, memberID); err != nil {
+			log.Printf("handleOrgMembers: cannot remove %s: %v", memberID, err)
+			http.Error(w, "User is not a member of the organisation", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleOrgMembers: removed %s from organisation %s", memberID, org.ID)
+	}
+	json.NewEncoder(w).Encode(store.GetOrg(org.ID))
+}
+
+// Lists the user's invitations (GET /orgs/invitations), or accepts (POST) or
+// declines (DELETE) one at /orgs/invitations/<ORG_UUID>
+func handleOrgInvitations(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleOrgInvitations")
+	if !ok {
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/orgs/invitations"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			log.Printf("handleOrgInvitations: method not allowed %s", r.Method)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		invitations := []Invitation{}
+		for _, org := range store.InvitationsOf(user.ID) {
+			invitations = append(invitations, Invitation{OrgID: org.ID, Name: org.Name, OwnerID: org.OwnerID})
+		}
+		json.NewEncoder(w).Encode(invitations)
+		return
+	}
+	orgID, err := uuid.Parse(rest)
+	if err != nil {
+		log.Printf("handleOrgInvitations: unknown path %s", r.URL.Path)
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		if err := store.JoinOrg(orgID, user.ID); err != nil {
+			log.Printf("handleOrgInvitations: user %s cannot join %s: %v", user.ID, orgID, err)
+			if errors.Is(err, errAlreadyInOrg) {
+				http.Error(w, "User already belongs to an organisation", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleOrgInvitations: user %s joined organisation %s", user.ID, orgID)
+		token, err := GenerateTenantJWT(user.ID, orgID)
+		if err != nil {
+			log.Printf("handleOrgInvitations: could not generate token: %v", err)
+			http.Error(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+		resp := struct {
+			*Organisation
+			Token string `json:"token"`
+		}{Organisation: store.GetOrg(orgID), Token: token}
+		json.NewEncoder(w).Encode(resp)
+	case http.MethodDelete:
+		if err := store.DeclineOrgInvite(orgID, user.ID); err != nil {
+			log.Printf("handleOrgInvitations: user %s cannot decline %s: %v", user.ID, orgID, err)
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleOrgInvitations: user %s declined organisation %s", user.ID, orgID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Printf("handleOrgInvitations: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Lists the user's teams (GET) or creates a team in their organisation (POST)
+func handleTeams(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleTeams")
+	if !ok {
+		return
+	}
+	if _, ok := requireOrg(w, user, "handleTeams"); !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(store.TeamsOf(user.TenantID, user.ID))
+	case http.MethodPost:
+		var req struct {
+			Name    string      `json:"name"`
+			Members []uuid.UUID `json:"members"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+			log.Printf("handleTeams: invalid request body: %v", err)
+			http.Error(w, "Team name is required", http.StatusBadRequest)
+			return
+		}
+		team := &Team{
+			ID:        uuid.New(),
+			OrgID:     user.TenantID,
+			Name:      strings.TrimSpace(req.Name),
+			Members:   []uuid.UUID{user.ID},
+			Assets:    []Asset{},
+			CreatedAt: time.Now().UTC(),
+		}
+		for _, id := range req.Members {
+			if !containsID(team.Members, id) {
+				team.Members = append(team.Members, id)
+			}
+		}
+		if err := store.PutTeam(team); err != nil {
+			log.Printf("handleTeams: %v", err)
+			http.Error(w, "Team members must belong to the organisation", http.StatusBadRequest)
+			return
+		}
+		log.Printf("handleTeams: user %s created team %s", user.ID, team.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(team)
+	default:
+		log.Printf("handleTeams: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Routes /teams/{id}, /teams/{id}/members and /teams/{id}/assets; only team
+// members of the same tenant can reach a team, and they manage it together
+func handleTeamByID(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleTeamByID")
+	if !ok {
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/teams/"), "/"), "/")
+	teamID, err := uuid.Parse(parts[0])
+	if err != nil || len(parts) > 2 {
+		log.Printf("handleTeamByID: unknown path %s", r.URL.Path)
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	team := store.GetTeam(user.TenantID, teamID)
+	if team == nil || !containsID(store.CopyTeam(team).Members, user.ID) {
+		log.Printf("handleTeamByID: team not found %s", teamID)
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(store.CopyTeam(team))
+	case action == "" && r.Method == http.MethodDelete:
+		store.RemoveTeam(team)
+		log.Printf("handleTeamByID: user %s deleted team %s", user.ID, team.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case action == "members" && r.Method == http.MethodPost:
+		memberID, ok := parseUserID(r, w)
+		if !ok {
+			log.Printf("handleTeamByID: invalid user_id")
+			return
+		}
+		if err := store.AddTeamMember(team, memberID); err != nil {
+			log.Printf("handleTeamByID: cannot add %s to team %s: %v", memberID, team.ID, err)
+			if errors.Is(err, errTeamNotFound) {
+				http.Error(w, "Team not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Team members must belong to the organisation", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(store.CopyTeam(team))
+	case action == "members" && r.Method == http.MethodDelete:
+		memberID, ok := parseUserID(r, w)
+		if !ok {
+			log.Printf("handleTeamByID: invalid user_id")
+			return
+		}
+		if err := store.RemoveTeamMember(team, memberID); err != nil {
+			log.Printf("handleTeamByID: cannot remove %s from team %s: %v", memberID, team.ID, err)
+			http.Error(w, "User is not a member of the team", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleTeamByID: removed %s from team %s", memberID, team.ID)
+		json.NewEncoder(w).Encode(store.CopyTeam(team))
+	case action == "assets":
+		handleTeamAssets(w, r, team)
+	default:
+		log.Printf("handleTeamByID: unsupported %s %s", r.Method, r.URL.Path)
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// Lists (GET), adds (POST) or deletes (DELETE ?asset_id=) workspace assets
+func handleTeamAssets(w http.ResponseWriter, r *http.Request, team *Team) {
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(store.TeamAssets(team))
+	case http.MethodPost:
+		var req struct {
+			Type  string          `json:"type"`
+			Asset json.RawMessage `json:"asset"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("handleTeamAssets: invalid request body: %v", err)
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		asset, err := decodeAsset(req.Type, req.Asset, store.TeamAssets(team))
+		if errors.Is(err, errUnknownAssetType) {
+			log.Printf("handleTeamAssets: unknown asset type %s", req.Type)
+			http.Error(w, "Unknown asset type", http.StatusBadRequest)
+			return
+		}
+		if err == nil {
+			err = store.AddTeamAsset(team, asset)
+		}
+		if err != nil {
+			log.Printf("handleTeamAssets: invalid %s asset: %v", req.Type, err)
+			if errors.Is(err, errTeamNotFound) {
+				http.Error(w, "Team not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Invalid "+req.Type+" asset: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("handleTeamAssets: asset %s added to team %s", asset.GetID(), team.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(asset)
+	case http.MethodDelete:
+		assetID, ok := parseAssetID(r, w)
+		if !ok {
+			log.Printf("handleTeamAssets: invalid asset_id")
+			return
+		}
+		if !store.RemoveTeamAsset(team, assetID) {
+			log.Printf("handleTeamAssets: asset not found %s", assetID)
+			http.Error(w, "Asset not found in workspace", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleTeamAssets: asset %s deleted from team %s", assetID, team.ID)
+		json.NewEncoder(w).Encode(store.TeamAssets(team))
+	default:
+		log.Printf("handleTeamAssets: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
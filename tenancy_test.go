@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTenantClaimInToken(t *testing.T) {
+	resetStore()
+	userID, tenantID := uuid.New(), uuid.New()
+	store.AddUser(&User{ID: userID, TenantID: tenantID})
+	token, _ := GenerateJWT(userID)
+
+	req := httptest.NewRequest(http.MethodGet, "/favourites", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	gotUser, gotTenant, err := extractIdentityFromToken(req)
+	if err != nil || gotUser != userID || gotTenant != tenantID {
+		t.Fatalf("expected identity %s/%s, got %s/%s (%v)", userID, tenantID, gotUser, gotTenant, err)
+	}
+
+	// A token for another tenant does not resolve the user
+	wrongToken, _ := GenerateTenantJWT(userID, uuid.New())
+	if w := doRequest(t, handleFavourites, wrongToken, http.MethodGet, "/favourites", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d with a token of another tenant, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := doRequest(t, handleFavourites, token, http.MethodGet, "/favourites", nil); w.Code != http.StatusOK {
+		t.Errorf("expected status %d with the tenant's token, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestOrganisationsAndIsolation(t *testing.T) {
+	resetStore()
+	ownerID, memberID, outsiderID := uuid.New(), uuid.New(), uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Org chart", Favorite: true}
+	store.AddUser(&User{ID: ownerID, Favourites: []Asset{chart}})
+	personalChart := &Chart{ID: uuid.New(), Title: "Personal chart", Favorite: true}
+	store.AddUser(&User{ID: memberID, Favourites: []Asset{personalChart}})
+	store.AddUser(&User{ID: outsiderID})
+	personalToken, _ := GenerateJWT(ownerID)
+
+	w := doRequest(t, handleOrgs, personalToken, http.MethodPost, "/orgs", map[string]string{"name": "GWI"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var org struct {
+		Organisation
+		Token string `json:"token"`
+	}
+	json.NewDecoder(w.Body).Decode(&org)
+	ownerToken := org.Token
+
+	// The personal token no longer reaches the user, who moved tenant
+	if w := doRequest(t, handleFavourites, personalToken, http.MethodGet, "/favourites", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d with the old token, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := doRequest(t, handleOrgs, ownerToken, http.MethodPost, "/orgs", map[string]string{"name": "Again"}); w.Code != http.StatusConflict {
+		t.Errorf("expected status %d creating a second organisation, got %d", http.StatusConflict, w.Code)
+	}
+
+	if w := doRequest(t, handleOrgMembers, ownerToken, http.MethodPost, "/orgs/members?user_id="+memberID.String(), nil); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d inviting member, got %d", http.StatusOK, w.Code)
+	}
+	// An invitation changes nothing until the user accepts it
+	personalMemberToken, _ := GenerateJWT(memberID)
+	outsiderToken, _ := GenerateJWT(outsiderID)
+	if u := store.GetUser(memberID); u.TenantID != uuid.Nil {
+		t.Fatalf("expected the invited user to stay out of the organisation, got tenant %s", u.TenantID)
+	}
+	if w := doRequest(t, handleOrgInvitations, outsiderToken, http.MethodPost, "/orgs/invitations/"+org.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d accepting without an invitation, got %d", http.StatusNotFound, w.Code)
+	}
+	w = doRequest(t, handleOrgInvitations, personalMemberToken, http.MethodGet, "/orgs/invitations", nil)
+	var invitations []Invitation
+	json.NewDecoder(w.Body).Decode(&invitations)
+	if len(invitations) != 1 || invitations[0].OrgID != org.ID {
+		t.Fatalf("expected the invitation listed, got %+v", invitations)
+	}
+	w = doRequest(t, handleOrgInvitations, personalMemberToken, http.MethodPost, "/orgs/invitations/"+org.ID.String(), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d accepting the invitation, got %d", http.StatusOK, w.Code)
+	}
+	var joined struct {
+		Organisation
+		Token string `json:"token"`
+	}
+	json.NewDecoder(w.Body).Decode(&joined)
+	memberToken := joined.Token
+	if len(joined.Members) != 2 || len(joined.Invited) != 0 {
+		t.Errorf("expected the member moved from invited to members, got %+v", joined.Organisation)
+	}
+	if w := doRequest(t, handleOrgMembers, memberToken, http.MethodPost, "/orgs/members?user_id="+outsiderID.String(), nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d for non-owner, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Shares stay within the tenant
+	for _, grantee := range []uuid.UUID{memberID, outsiderID} {
+		want := http.StatusCreated
+		if grantee == outsiderID {
+			want = http.StatusBadRequest
+		}
+		w := doRequest(t, handleShares, ownerToken, http.MethodPost, "/shares", map[string]interface{}{
+			"asset_id": chart.ID, "user_id": grantee, "permission": PermRead,
+		})
+		if w.Code != want {
+			t.Errorf("sharing with %s: expected status %d, got %d", grantee, want, w.Code)
+		}
+	}
+	if _, _, err := store.PutShare(&Share{ID: uuid.New(), TenantID: org.ID, OwnerID: ownerID, GranteeID: outsiderID, AssetID: chart.ID, Permission: PermRead}); err != errCrossTenant {
+		t.Errorf("expected storage to refuse a cross-tenant share, got %v", err)
+	}
+	if w := doRequest(t, handleFavouriteByID, outsiderToken, http.MethodGet, "/favourites/"+chart.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected outsider not to reach the asset, got %d", w.Code)
+	}
+
+	memberChart := &Chart{ID: uuid.New(), Title: "Member chart", Favorite: true}
+	member := store.GetUser(memberID)
+	member.Favourites = append(member.Favourites, memberChart)
+	member.Collections = append(member.Collections, &Collection{ID: uuid.New(), Name: "Research", AssetIDs: []uuid.UUID{memberChart.ID}})
+
+	// Leaving the organisation drops the member's shares; their assets,
+	// including those from before they joined, stay with them
+	if w := doRequest(t, handleOrgMembers, ownerToken, http.MethodDelete, "/orgs/members?user_id="+memberID.String(), nil); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d removing member, got %d", http.StatusOK, w.Code)
+	}
+	if shares := store.SharesByOwner(org.ID, ownerID); len(shares) != 0 {
+		t.Errorf("expected shares to be dropped with the member, got %d", len(shares))
+	}
+	if w := doRequest(t, handleFavouriteByID, memberToken, http.MethodGet, "/favourites/"+memberChart.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected the organisation token to stop working, got %d", w.Code)
+	}
+	if w := doRequest(t, handleFavouriteByID, ownerToken, http.MethodGet, "/favourites/"+memberChart.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected the owner not to get the member's asset, got %d", w.Code)
+	}
+	for _, id := range []uuid.UUID{personalChart.ID, memberChart.ID} {
+		if w := doRequest(t, handleFavouriteByID, personalMemberToken, http.MethodGet, "/favourites/"+id.String(), nil); w.Code != http.StatusOK {
+			t.Errorf("expected the removed member to keep asset %s, got %d", id, w.Code)
+		}
+	}
+	if member := store.GetUser(memberID); len(member.Collections) != 1 {
+		t.Errorf("expected the removed member to keep their collection, got %+v", member.Collections)
+	}
+	if owner := store.GetUser(ownerID); len(owner.Favourites) != 1 || len(owner.Collections) != 0 {
+		t.Errorf("expected the owner's assets unchanged, got %d assets", len(owner.Favourites))
+	}
+}
+
+func TestTeamWorkspaces(t *testing.T) {
+	resetStore()
+	ownerID, memberID, otherID := uuid.New(), uuid.New(), uuid.New()
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	store.AddUser(&User{ID: ownerID})
+	store.AddUser(&User{ID: otherID})
+	store.CreateOrg(&Organisation{ID: orgID, Name: "A", OwnerID: ownerID})
+	store.CreateOrg(&Organisation{ID: otherOrgID, Name: "B", OwnerID: otherID})
+	store.AddUser(&User{ID: memberID})
+	store.InviteOrgMember(orgID, memberID)
+	store.JoinOrg(orgID, memberID)
+	ownerToken, _ := GenerateJWT(ownerID)
+	memberToken, _ := GenerateJWT(memberID)
+	otherToken, _ := GenerateJWT(otherID)
+
+	if w := doRequest(t, handleTeams, ownerToken, http.MethodPost, "/teams", map[string]interface{}{"name": "Insights", "members": []uuid.UUID{otherID}}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d with a member of another tenant, got %d", http.StatusBadRequest, w.Code)
+	}
+	w := doRequest(t, handleTeams, ownerToken, http.MethodPost, "/teams", map[string]interface{}{"name": "Insights", "members": []uuid.UUID{memberID}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	// Team.Assets holds interfaces, so only decode the ID
+	var team struct {
+		ID uuid.UUID `json:"id"`
+	}
+	json.NewDecoder(w.Body).Decode(&team)
+
+	base := "/teams/" + team.ID.String() + "/assets"
+	w = doRequest(t, handleTeamByID, memberToken, http.MethodPost, base, map[string]interface{}{"type": ChartType, "asset": map[string]string{"title": "Team chart"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d adding workspace asset, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	w = doRequest(t, handleTeamByID, ownerToken, http.MethodGet, base, nil)
+	var assets []map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&assets)
+	if len(assets) != 1 || assets[0]["Title"] != "Team chart" {
+		t.Errorf("unexpected workspace assets %v", assets)
+	}
+
+	// Another tenant cannot see the team even with its ID
+	if w := doRequest(t, handleTeamByID, otherToken, http.MethodGet, base, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for another tenant, got %d", http.StatusNotFound, w.Code)
+	}
+	if teams := store.TeamsOf(otherOrgID, otherID); len(teams) != 0 {
+		t.Errorf("expected no teams for another tenant, got %d", len(teams))
+	}
+
+	// Members leave, and the team goes with its last member
+	teamURL := "/teams/" + team.ID.String()
+	if w := doRequest(t, handleTeamByID, ownerToken, http.MethodDelete, teamURL+"/members?user_id="+otherID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d removing a non-member, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := doRequest(t, handleTeamByID, ownerToken, http.MethodDelete, teamURL+"/members?user_id="+memberID.String(), nil); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d removing a member, got %d", http.StatusOK, w.Code)
+	}
+	if w := doRequest(t, handleTeamByID, memberToken, http.MethodGet, base, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected the removed member not to reach the workspace, got %d", w.Code)
+	}
+	doRequest(t, handleTeamByID, ownerToken, http.MethodDelete, teamURL+"/members?user_id="+ownerID.String(), nil)
+	if store.GetTeam(orgID, team.ID) != nil {
+		t.Error("expected the team deleted with its last member")
+	}
+
+	w = doRequest(t, handleTeams, ownerToken, http.MethodPost, "/teams", map[string]interface{}{"name": "Temporary", "members": []uuid.UUID{memberID}})
+	json.NewDecoder(w.Body).Decode(&team)
+	if w := doRequest(t, handleTeamByID, memberToken, http.MethodDelete, "/teams/"+team.ID.String(), nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d deleting the team, got %d", http.StatusNoContent, w.Code)
+	}
+	if teams := store.TeamsOf(orgID, ownerID); len(teams) != 0 {
+		t.Errorf("expected the team deleted, got %d teams", len(teams))
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// certCheckInterval is how often the certificate files are checked for a
+// rotation
+var certCheckInterval = 30 * time.Second
+
+var errNoClientCertificate = errors.New("no verified client certificate")
+
+// clientUsers maps client certificate subjects to users; set by
+// tls.client_users and guarded by settingsMu
+var clientUsers map[string]uuid.UUID
+
+// certReloader serves a key pair from files, loading it again when a
+// rotation changes them
+type certReloader struct {
+	certFile, keyFile string
+
+	mu              sync.RWMutex
+	cert            *tls.Certificate
+	certMod, keyMod time.Time
+}
+
+// newCertReloader loads the key pair, failing if it is invalid
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate is the tls.Config hook serving the current pair
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// reload loads the pair if either file changed since it was last loaded. A
+// pair that does not load, e.g. while only one file has been replaced, keeps
+// the current one and is retried on the next check.
+func (c *certReloader) reload() (bool, error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := c.cert != nil && certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert, c.certMod, c.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	return true, nil
+}
+
+// run checks the files every interval until the context is cancelled
+func (c *certReloader) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				log.Printf("certReloader: keeping the current certificate: %v", err)
+				continue
+			}
+			if reloaded {
+				log.Printf("certReloader: reloaded %s", c.certFile)
+			}
+		}
+	}
+}
+
+// newTLSConfig returns the TLS configuration of the HTTP and gRPC APIs,
+// offering HTTP/2 and verifying client certificates signed by the client CA
+func newTLSConfig(cfg TLSConfig, certs *certReloader) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: certs.GetCertificate,
+	}
+	if cfg.ClientCA == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(cfg.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates", cfg.ClientCA)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// identityFromCertificate returns the user and tenant IDs of a verified
+// client certificate whose subject is mapped to a user, e.g.
+// "CN=reporting,O=Example"
+func identityFromCertificate(state *tls.ConnectionState) (uuid.UUID, uuid.UUID, error) {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return uuid.Nil, uuid.Nil, errNoClientCertificate
+	}
+	subject := state.VerifiedChains[0][0].Subject.String()
+	settingsMu.RLock()
+	userID, ok := clientUsers[subject]
+	settingsMu.RUnlock()
+	if !ok {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("no user for client certificate %q", subject)
+	}
+	tenantID := uuid.Nil
+	if user := store.GetUser(userID); user != nil {
+		tenantID = store.TenantOf(user)
+	}
+	return userID, tenantID, nil
+}
+
+// serveHTTP serves the API on lis, over TLS when the server has a TLS
+// configuration
+func serveHTTP(srv *http.Server, lis net.Listener) error {
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(lis, "", "")
+	}
+	return srv.Serve(lis)
+}
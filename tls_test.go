@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"platform-go-challenge/favouritespb"
+)
+
+// testCA signs the server and client certificates of the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for the subject, for 127.0.0.1
+func (ca *testCA) issue(t *testing.T, subject pkix.Name, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) clientCert(t *testing.T, subject pkix.Name) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, subject, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writePair writes a server key pair with the given modification time
+func writePair(t *testing.T, ca *testCA, dir, commonName string, mod time.Time) (certFile, keyFile string) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, pkix.Name{CommonName: commonName}, x509.ExtKeyUsageServerAuth)
+	certFile, keyFile = filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	for file, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err := os.WriteFile(file, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, mod, mod)
+	}
+	return certFile, keyFile
+}
+
+func servedName(t *testing.T, certs *certReloader) string {
+	t.Helper()
+	cert, _ := certs.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	ca, dir := newTestCA(t), t.TempDir()
+	start := time.Now().Add(-time.Minute)
+	certFile, keyFile := writePair(t, ca, dir, "first", start)
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	if reloaded, err := certs.reload(); reloaded || err != nil {
+		t.Errorf("expected unchanged files not reloaded, got %v %v", reloaded, err)
+	}
+
+	writePair(t, ca, dir, "rotated", start.Add(time.Second))
+	if reloaded, err := certs.reload(); !reloaded || err != nil || servedName(t, certs) != "rotated" {
+		t.Errorf("expected the rotated pair served, got %v %v %s", reloaded, err, servedName(t, certs))
+	}
+
+	// Half a rotation keeps the pair being served
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	os.Chtimes(keyFile, start.Add(2*time.Second), start.Add(2*time.Second))
+	if _, err := certs.reload(); err == nil || servedName(t, certs) != "rotated" {
+		t.Errorf("expected the invalid pair refused, got %v %s", err, servedName(t, certs))
+	}
+	if _, err := newCertReloader(certFile, keyFile); err == nil {
+		t.Error("expected an invalid pair refused at startup")
+	}
+}
+
+// startTLSServer serves the API over TLS, accepting client certificates of
+// the CA, and maps the subject of "reporting" to userID
+func startTLSServer(t *testing.T, ca *testCA, userID uuid.UUID) (*tls.Config, string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile := writePair(t, ca, dir, "server", time.Now())
+	caFile := filepath.Join(dir, "ca.crt")
+	os.WriteFile(caFile, ca.pem, 0o600)
+	cfg := TLSConfig{Cert: certFile, Key: keyFile, ClientCA: caFile}
+	certs, err := newCertReloader(cfg.Cert, cfg.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := newTLSConfig(cfg, certs)
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+	settingsMu.Lock()
+	clientUsers = map[string]uuid.UUID{"CN=reporting,O=Example": userID}
+	settingsMu.Unlock()
+	t.Cleanup(func() { clientUsers = nil })
+
+	mux := http.NewServeMux()
+	setupRoutes(mux)
+	srv := newHTTPServer(defaultConfig().HTTP, validateAPI(mux))
+	srv.TLSConfig = tlsConfig
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serveHTTP(srv, lis)
+	t.Cleanup(func() { srv.Close() })
+	return tlsConfig, "https://" + lis.Addr().String()
+}
+
+func tlsClient(ca *testCA, certs ...tls.Certificate) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: ca.pool, Certificates: certs},
+		ForceAttemptHTTP2: true,
+	}}
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	ca := newTestCA(t)
+	_, url := startTLSServer(t, ca, userID)
+
+	get := func(client *http.Client, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, url+"/favourites", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET /favourites: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	resp := get(tlsClient(ca, ca.clientCert(t, pkix.Name{CommonName: "reporting", Organization: []string{"Example"}})), "")
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("expected a mapped certificate accepted over HTTP/2, got %d over %s", resp.StatusCode, resp.Proto)
+	}
+	if resp := get(tlsClient(ca, ca.clientCert(t, pkix.Name{CommonName: "billing"})), ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an unmapped certificate refused, got %d", resp.StatusCode)
+	}
+	if resp := get(tlsClient(ca), ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a request without credentials refused, got %d", resp.StatusCode)
+	}
+	token, _ := GenerateJWT(userID)
+	if resp := get(tlsClient(ca), token); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected tokens still accepted over TLS, got %d", resp.StatusCode)
+	}
+
+	// A certificate from another CA is not verified, so it authenticates nobody
+	other := newTestCA(t)
+	client := tlsClient(ca, other.clientCert(t, pkix.Name{CommonName: "reporting", Organization: []string{"Example"}}))
+	if _, err := client.Get(url + "/favourites"); err == nil {
+		t.Error("expected a certificate of an unknown CA refused")
+	}
+}
+
+func TestGRPC_ClientCertificate(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	ca := newTestCA(t)
+	tlsConfig, _ := startTLSServer(t, ca, userID)
+	server := newGRPCServer(tlsConfig)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	dial := func(cert tls.Certificate) favouritespb.FavouritesClient {
+		creds := credentials.NewTLS(&tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{cert}})
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatalf("dialing: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return favouritespb.NewFavouritesClient(conn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := dial(ca.clientCert(t, pkix.Name{CommonName: "reporting", Organization: []string{"Example"}}))
+	if _, err := client.ListFavourites(ctx, &favouritespb.ListFavouritesRequest{}); err != nil {
+		t.Errorf("expected the mapped certificate accepted, got %v", err)
+	}
+	client = dial(ca.clientCert(t, pkix.Name{CommonName: "billing"}))
+	if _, err := client.ListFavourites(ctx, &favouritespb.ListFavouritesRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated for an unmapped certificate, got %v", err)
+	}
+}
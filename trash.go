@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// trashRetention is how long deleted assets stay restorable; set by trash.retention
+var trashRetention = 30 * 24 * time.Hour
+
+const trashPurgeInterval = time.Hour
+
+// TrashedAsset is a deleted favourite waiting to be restored or purged,
+// remembering the collections it was taken out of
+type TrashedAsset struct {
+	Asset         Asset
+	DeletedAt     time.Time
+	CollectionIDs []uuid.UUID
+}
+
+// trashView is the /trash representation of a trashed asset
+type trashView struct {
+	Type      string    `json:"type"`
+	Asset     Asset     `json:"asset"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Lists the user's trash (GET), or purges one asset (DELETE ?asset_id=) or
+// the whole trash (DELETE)
+func handleTrash(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleTrash")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		entries := store.TrashOf(user)
+		views := make([]trashView, 0, len(entries))
+		for _, entry := range entries {
+			views = append(views, trashView{
+				Type:      entry.Asset.GetType(),
+				Asset:     entry.Asset,
+				DeletedAt: entry.DeletedAt,
+				ExpiresAt: entry.DeletedAt.Add(currentTrashRetention()),
+			})
+		}
+		log.Printf("handleTrash: returning %d trashed assets for user %s", len(views), user.ID)
+		json.NewEncoder(w).Encode(views)
+	case http.MethodDelete:
+		assetID := uuid.Nil
+		if r.URL.Query().Get("asset_id") != "" {
+			if assetID, ok = parseAssetID(r, w); !ok {
+				log.Printf("handleTrash: invalid asset_id")
+				return
+			}
+		}
+		purged := store.PurgeTrash(user, assetID)
+		if assetID != uuid.Nil && purged == 0 {
+			log.Printf("handleTrash: asset not found in trash %s", assetID)
+			http.Error(w, "Asset not found in trash", http.StatusNotFound)
+			return
+		}
+		log.Printf("handleTrash: purged %d assets for user %s", purged, user.ID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Printf("handleTrash: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Restores an asset from the trash back into the user's favourites
+func handleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("handleTrashRestore: method not allowed %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := requireUser(w, r, "handleTrashRestore")
+	if !ok {
+		return
+	}
+	assetID, ok := parseAssetID(r, w)
+	if !ok {
+		log.Printf("handleTrashRestore: invalid asset_id")
+		return
+	}
+	asset, err := store.RestoreAsset(user, assetID)
+	if errors.Is(err, errAssetExists) {
+		log.Printf("handleTrashRestore: asset %s already in favourites", assetID)
+		http.Error(w, "An asset with the same ID is in favourites", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("handleTrashRestore: asset not found in trash %s", assetID)
+		http.Error(w, "Asset not found in trash", http.StatusNotFound)
+		return
+	}
+	log.Printf("handleTrashRestore: asset %s restored for user %s", assetID, user.ID)
+	notify(user, EventCreated, asset)
+	json.NewEncoder(w).Encode(asset)
+}
+
+// runTrashPurger permanently deletes trashed assets older than the retention
+// period, checking every interval until the context is cancelled
+func runTrashPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			store.writeMu.Lock()
+			purged := store.PurgeExpiredTrash(now.Add(-currentTrashRetention()))
+			err := store.commit()
+			store.writeMu.Unlock()
+			if err != nil {
+				log.Printf("runTrashPurger: cannot log purge: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("runTrashPurger: purged %d expired assets", purged)
+			}
+		}
+	}
+}
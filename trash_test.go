@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTrash_DeleteAndRestore(t *testing.T) {
+	resetStore()
+	userID, granteeID := uuid.New(), uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Chart1", Favorite: true}
+	c := &Collection{ID: uuid.New(), Name: "Report", AssetIDs: []uuid.UUID{chart.ID}}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart}, Collections: []*Collection{c}})
+	store.AddUser(&User{ID: granteeID})
+	store.PutShare(&Share{ID: uuid.New(), OwnerID: userID, GranteeID: granteeID, AssetID: chart.ID, Permission: PermRead})
+	token, _ := GenerateJWT(userID)
+
+	doRequest(t, handleDeleteFavourite, token, http.MethodDelete, "/favourites/delete?asset_id="+chart.ID.String(), nil)
+	w := doRequest(t, handleTrash, token, http.MethodGet, "/trash", nil)
+	var trash []struct {
+		Type      string
+		Asset     map[string]interface{}
+		DeletedAt time.Time `json:"deleted_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&trash); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(trash) != 1 || trash[0].Type != ChartType || trash[0].Asset["Title"] != "Chart1" {
+		t.Fatalf("unexpected trash %+v", trash)
+	}
+	if got := trash[0].ExpiresAt.Sub(trash[0].DeletedAt); got != trashRetention {
+		t.Errorf("expected expiry after %v, got %v", trashRetention, got)
+	}
+
+	w = doRequest(t, handleTrashRestore, token, http.MethodPost, "/trash/restore?asset_id="+chart.ID.String(), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d restoring, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	user := store.GetUser(userID)
+	if findAsset(user, chart.ID) == nil || len(user.Trash) != 0 {
+		t.Errorf("expected asset back in favourites, trash has %d entries", len(user.Trash))
+	}
+	if !c.hasAsset(chart.ID) {
+		t.Error("expected restored asset back in its collection")
+	}
+	if len(store.SharesByOwner(uuid.Nil, userID)) != 1 {
+		t.Error("expected share to survive the trash")
+	}
+	if w := doRequest(t, handleTrashRestore, token, http.MethodPost, "/trash/restore?asset_id="+chart.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d restoring twice, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestTrash_Purge(t *testing.T) {
+	resetStore()
+	userID, granteeID := uuid.New(), uuid.New()
+	first := &Chart{ID: uuid.New(), Title: "First"}
+	second := &Chart{ID: uuid.New(), Title: "Second"}
+	user := &User{ID: userID, Favourites: []Asset{first, second}}
+	store.AddUser(user)
+	store.AddUser(&User{ID: granteeID})
+	store.PutShare(&Share{ID: uuid.New(), OwnerID: userID, GranteeID: granteeID, AssetID: first.ID, Permission: PermRead})
+	token, _ := GenerateJWT(userID)
+
+	now := time.Now().UTC()
+	store.TrashAsset(user, first.ID, now.Add(-2*trashRetention))
+	store.TrashAsset(user, second.ID, now)
+
+	if purged := store.PurgeExpiredTrash(now.Add(-trashRetention)); purged != 1 {
+		t.Fatalf("expected 1 expired asset purged, got %d", purged)
+	}
+	if len(user.Trash) != 1 || user.Trash[0].Asset.GetID() != second.ID {
+		t.Errorf("expected only the recent asset left in trash, got %d entries", len(user.Trash))
+	}
+	if len(store.SharesByOwner(uuid.Nil, userID)) != 0 {
+		t.Error("expected shares of the purged asset to be dropped")
+	}
+
+	if w := doRequest(t, handleTrash, token, http.MethodDelete, "/trash?asset_id="+first.ID.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d purging a missing asset, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := doRequest(t, handleTrash, token, http.MethodDelete, "/trash", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d emptying trash, got %d", http.StatusNoContent, w.Code)
+	}
+	if len(user.Trash) != 0 {
+		t.Errorf("expected empty trash, got %d entries", len(user.Trash))
+	}
+}
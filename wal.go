@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Write-ahead log operations. Each carries the full state of the entity it
+// changes, so replaying a record twice is harmless. A user is logged whole
+// when created or moved to another tenant; other changes log the assets,
+// collections and trash entries they touch.
+const (
+	opPutUser          = "put_user"
+	opPutAsset         = "put_asset"
+	opDeleteAsset      = "delete_asset"
+	opPutCollection    = "put_collection"
+	opDeleteCollection = "delete_collection"
+	opPutTrash         = "put_trash"
+	opDeleteTrash      = "delete_trash"
+
+	opPutShare    = "put_share"
+	opDeleteShare = "delete_share"
+	opPutLink     = "put_link"
+	opDeleteLink  = "delete_link"
+	opPutOrg      = "put_org"
+	opPutTeam     = "put_team"
+	opDeleteTeam  = "delete_team"
+	opAddRevision = "add_revision"
+	opDropHistory = "drop_history"
+
+	opPutWebhook     = "put_webhook"
+	opDeleteWebhook  = "delete_webhook"
+	opPutDelivery    = "put_delivery"
+	opDeleteDelivery = "delete_delivery"
+)
+
+var errWALCorrupt = errors.New("corrupt write-ahead log record")
+
+// walOp is one change to the store. ID is the user of asset, collection,
+// trash and revision operations and the share, link, team, webhook or
+// delivery of other deletions. AssetID is the asset, or the collection, a
+// user's deletion or revision applies to.
+type walOp struct {
+	Op         string        `json:"op"`
+	ID         uuid.UUID     `json:"id"`
+	AssetID    uuid.UUID     `json:"asset_id"`
+	User       *userRecord   `json:"user,omitempty"`
+	Asset      *typedAsset   `json:"asset,omitempty"`
+	Collection *Collection   `json:"collection,omitempty"`
+	Trash      *trashRecord  `json:"trash,omitempty"`
+	Share      *Share        `json:"share,omitempty"`
+	Link       *linkRecord   `json:"link,omitempty"`
+	Org        *Organisation `json:"org,omitempty"`
+	Team       *teamRecord   `json:"team,omitempty"`
+	Revision   *Revision     `json:"revision,omitempty"`
+	Webhook    *Webhook      `json:"webhook,omitempty"`
+	Delivery   *Delivery     `json:"delivery,omitempty"`
+}
+
+// WAL is an append-only log of committed mutations. Every record is a line
+// "<crc32> <json ops>", so a torn write at the tail is detected on replay.
+type WAL struct {
+	mu   sync.Mutex
+	f    *os.File
+	path string
+}
+
+// OpenWAL opens the log for appending, creating it if needed
+func OpenWAL(path string) (*WAL, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &WAL{f: f, path: path}, nil
+}
+
+// Append writes one record, the JSON array of its ops, and fsyncs it
+func (w *WAL) Append(data []byte) error {
+	line := make([]byte, 0, len(data)+10)
+	line = append(line, fmt.Sprintf("%08x ", crc32.ChecksumIEEE(data))...)
+	line = append(line, data...)
+	line = append(line, '\n')
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.f.Write(line); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// Truncate empties the log once its records are contained in a snapshot
+func (w *WAL) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// Close flushes and closes the log
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// ReplayWAL applies the records of the log at path to the store, returning
+// how many were applied. A torn or corrupt record at the tail, left by a
+// crash mid-append, is cut off; corruption before the tail is an error.
+func ReplayWAL(path string) (int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	var offset int64
+	applied := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return applied, nil
+		}
+		ops, decodeErr := decodeWALRecord(line)
+		if err == io.EOF || decodeErr != nil {
+			// only the last record may be damaged
+			if _, peekErr := reader.Peek(1); peekErr != io.EOF {
+				return applied, fmt.Errorf("record at offset %d: %w", offset, errWALCorrupt)
+			}
+			log.Printf("ReplayWAL: dropping torn record at offset %d of %s", offset, path)
+			return applied, f.Truncate(offset)
+		}
+		if err != nil {
+			return applied, err
+		}
+		for _, op := range ops {
+			if err := store.applyOp(op); err != nil {
+				return applied, fmt.Errorf("record at offset %d: %w", offset, err)
+			}
+		}
+		offset += int64(len(line))
+		applied++
+	}
+}
+
+func decodeWALRecord(line []byte) ([]walOp, error) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if len(line) < 10 || line[8] != ' ' {
+		return nil, errWALCorrupt
+	}
+	sum, err := hex.DecodeString(string(line[:8]))
+	if err != nil {
+		return nil, errWALCorrupt
+	}
+	data := line[9:]
+	if crc32.ChecksumIEEE(data) != uint32(sum[0])<<24|uint32(sum[1])<<16|uint32(sum[2])<<8|uint32(sum[3]) {
+		return nil, errWALCorrupt
+	}
+	var ops []walOp
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, errWALCorrupt
+	}
+	return ops, nil
+}
+
+// logLocked queues a change for the next commit. The caller holds s.mu.
+func (s *Storage) logLocked(op walOp) {
+	if s.wal != nil {
+		s.pending = append(s.pending, op)
+	}
+}
+
+// userChange is a user changed by the current mutation with their state
+// before it. Assets, collections and trash entries are replaced rather than
+// changed in place, so commit finds what changed by comparing pointers.
+type userChange struct {
+	user *User
+	// whole logs the user as put_user: they are new or changed tenant
+	whole       bool
+	favourites  []Asset
+	collections []*Collection
+	trash       []*TrashedAsset
+}
+
+// touchLocked records the state of a user about to change, once per
+// mutation; commit logs what changed since. The caller holds s.mu and calls
+// it before changing the user.
+func (s *Storage) touchLocked(u *User) {
+	if s.wal == nil {
+		return
+	}
+	if s.dirtyUsers == nil {
+		s.dirtyUsers = make(map[uuid.UUID]*userChange)
+	}
+	if s.dirtyUsers[u.ID] == nil {
+		s.dirtyUsers[u.ID] = &userChange{user: u, favourites: u.Favourites, collections: u.Collections, trash: u.Trash}
+	}
+}
+
+// touchUserLocked marks a user to be logged whole on commit. The caller
+// holds s.mu.
+func (s *Storage) touchUserLocked(u *User) {
+	if s.wal == nil {
+		return
+	}
+	s.touchLocked(u)
+	change := s.dirtyUsers[u.ID]
+	change.user, change.whole = u, true
+}
+
+// ops returns the operations logging the change
+func (c *userChange) ops() ([]walOp, error) {
+	u := c.user
+	if c.whole {
+		rec, err := encodeUser(u)
+		if err != nil {
+			return nil, err
+		}
+		// history is logged revision by revision
+		rec.History = nil
+		return []walOp{{Op: opPutUser, User: rec}}, nil
+	}
+	var ops []walOp
+	kept := make(map[uuid.UUID]Asset, len(u.Favourites))
+	for _, asset := range u.Favourites {
+		kept[asset.GetID()] = asset
+	}
+	before := make(map[uuid.UUID]Asset, len(c.favourites))
+	for _, asset := range c.favourites {
+		before[asset.GetID()] = asset
+		if kept[asset.GetID()] == nil {
+			ops = append(ops, walOp{Op: opDeleteAsset, ID: u.ID, AssetID: asset.GetID()})
+		}
+	}
+	for _, asset := range u.Favourites {
+		if before[asset.GetID()] != asset {
+			t, err := encodeAsset(asset)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, walOp{Op: opPutAsset, ID: u.ID, Asset: &t})
+		}
+	}
+	for _, old := range c.collections {
+		if lookupCollection(u.Collections, old.ID) == nil {
+			ops = append(ops, walOp{Op: opDeleteCollection, ID: u.ID, AssetID: old.ID})
+		}
+	}
+	for _, collection := range u.Collections {
+		if lookupCollection(c.collections, collection.ID) != collection {
+			ops = append(ops, walOp{Op: opPutCollection, ID: u.ID, Collection: collection})
+		}
+	}
+	// trash entries are only added and removed; an asset may be trashed more
+	// than once, so a deletion names the entry by its DeletedAt too
+	for _, old := range c.trash {
+		if !containsTrashed(u.Trash, old) {
+			ops = append(ops, walOp{Op: opDeleteTrash, ID: u.ID, AssetID: old.Asset.GetID(), Trash: &trashRecord{DeletedAt: old.DeletedAt}})
+		}
+	}
+	for _, entry := range u.Trash {
+		if !containsTrashed(c.trash, entry) {
+			t, err := encodeTrashed(entry)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, walOp{Op: opPutTrash, ID: u.ID, Trash: &t})
+		}
+	}
+	return ops, nil
+}
+
+func containsTrashed(trash []*TrashedAsset, entry *TrashedAsset) bool {
+	for _, other := range trash {
+		if other == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTrashed reports whether a trash entry is the one trashed at deletedAt;
+// an asset may be in the trash more than once
+func sameTrashed(entry *TrashedAsset, assetID uuid.UUID, deletedAt time.Time) bool {
+	return entry.Asset.GetID() == assetID && entry.DeletedAt.Equal(deletedAt)
+}
+
+func (s *Storage) touchTeamLocked(team *Team) {
+	if s.wal == nil {
+		return
+	}
+	if s.dirtyTeams == nil {
+		s.dirtyTeams = make(map[uuid.UUID]*Team)
+	}
+	s.dirtyTeams[team.ID] = team
+}
+
+// walFailStop stops the server when a commit fails. The change is already in
+// memory, so serving on would acknowledge later changes built on one the log
+// lacks; after a restart the store is what the log holds.
+var walFailStop = func(err error) {
+	log.Fatalf("Write-ahead log failed, stopping: %v", err)
+}
+
+// commit appends the changes of the current mutation to the log as a single
+// record and fsyncs it, then publishes the mutation's events. Their webhook
+// deliveries are queued in the same record. The storage methods mark what
+// they change, so a grantee's edit logs the owner's asset. A failed commit
+// stops the server through walFailStop. The caller holds s.writeMu.
+func (s *Storage) commit() error {
+	s.mu.Lock()
+	enqueued := s.enqueueDeliveriesLocked(s.events)
+	// entities first, so revisions of a user created by this mutation replay
+	ops := make([]walOp, 0, len(s.dirtyUsers)+len(s.dirtyTeams)+len(s.pending))
+	for _, change := range s.dirtyUsers {
+		userOps, err := change.ops()
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		ops = append(ops, userOps...)
+	}
+	for _, team := range s.dirtyTeams {
+		assets, err := encodeAssets(team.Assets)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		ops = append(ops, walOp{Op: opPutTeam, Team: &teamRecord{Team: team, Assets: assets}})
+	}
+	ops = append(ops, s.pending...)
+	queued := s.events
+	s.pending, s.dirtyUsers, s.dirtyTeams, s.events = nil, nil, nil, nil
+	wal := s.wal
+	var data []byte
+	var err error
+	if wal != nil && len(ops) > 0 {
+		// the ops point into the store, so encode them before unlocking
+		data, err = json.Marshal(ops)
+	}
+	s.mu.Unlock()
+	if err == nil && data != nil {
+		err = wal.Append(data)
+	}
+	if err != nil {
+		walFailStop(err)
+		return err
+	}
+	for _, ev := range queued {
+		events.Publish(ev)
+	}
+	if enqueued > 0 {
+		wakeWebhooks()
+	}
+	return nil
+}
+
+// applyOp replays one logged change
+func (s *Storage) applyOp(op walOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch op.Op {
+	case opPutUser:
+		u, err := decodeUser(op.User)
+		if err != nil {
+			return err
+		}
+		if old := s.users[u.ID]; old != nil {
+			u.History = old.History
+		}
+		s.users[u.ID] = u
+	case opPutAsset, opDeleteAsset, opPutCollection, opDeleteCollection, opPutTrash, opDeleteTrash:
+		u := s.users[op.ID]
+		if u == nil {
+			return fmt.Errorf("%s for unknown user %s", op.Op, op.ID)
+		}
+		return applyUserOp(u, op)
+	case opPutShare:
+		s.shares[op.Share.ID] = op.Share
+	case opDeleteShare:
+		delete(s.shares, op.ID)
+	case opPutLink:
+		op.Link.passwordSalt, op.Link.passwordHash = op.Link.PasswordSalt, op.Link.PasswordHash
+		s.links[op.Link.ID] = op.Link.ShareLink
+	case opDeleteLink:
+		delete(s.links, op.ID)
+	case opPutOrg:
+		s.orgs[op.Org.ID] = op.Org
+	case opPutTeam:
+		assets, err := decodeAssets(op.Team.Assets)
+		if err != nil {
+			return err
+		}
+		op.Team.Team.Assets = assets
+		s.teams[op.Team.ID] = op.Team.Team
+	case opDeleteTeam:
+		delete(s.teams, op.ID)
+	case opAddRevision:
+		u := s.users[op.ID]
+		if u == nil {
+			return fmt.Errorf("revision for unknown user %s", op.ID)
+		}
+		if u.History == nil {
+			u.History = make(map[uuid.UUID][]*Revision)
+		}
+		history := u.History[op.AssetID]
+		if len(history) > 0 && history[len(history)-1].Number >= op.Revision.Number {
+			return nil
+		}
+		history = append(history, op.Revision)
+		if len(history) > maxRevisions {
+			history = history[len(history)-maxRevisions:]
+		}
+		u.History[op.AssetID] = history
+	case opDropHistory:
+		if u := s.users[op.ID]; u != nil {
+			delete(u.History, op.AssetID)
+		}
+	case opPutWebhook:
+		s.webhooks[op.Webhook.ID] = op.Webhook
+	case opDeleteWebhook:
+		s.deleteWebhookLocked(op.ID)
+	case opPutDelivery:
+		s.deliveries[op.Delivery.ID] = op.Delivery
+	case opDeleteDelivery:
+		delete(s.deliveries, op.ID)
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+	return nil
+}
+
+// bufferedResponse holds a response back until the mutation is durable
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// serveMutation runs a mutating handler and only sends its response once the
+// changes are in the write-ahead log. The handler changes the store through
+// its locked methods, so mutations run concurrently; only their commits are
+// serialized.
+func serveMutation(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	buf := &bufferedResponse{header: w.Header()}
+	next(buf, r)
+	store.writeMu.Lock()
+	defer store.writeMu.Unlock()
+	if err := store.commit(); err != nil {
+		log.Printf("serveMutation: cannot log %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "Could not persist the change", http.StatusInternalServerError)
+		return
+	}
+	if buf.status != 0 {
+		w.WriteHeader(buf.status)
+	}
+	w.Write(buf.body.Bytes())
+}
+
+// applyUserOp replays a change to one of the user's assets, collections or
+// trash entries. Puts replace the entry with the same ID or append it. The
+// caller holds s.mu.
+func applyUserOp(u *User, op walOp) error {
+	switch op.Op {
+	case opPutAsset:
+		asset, err := decodeTypedAsset(*op.Asset)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", u.ID, err)
+		}
+		if !putAsset(u, asset) {
+			u.Favourites = append(u.Favourites, asset)
+		}
+	case opDeleteAsset:
+		favourites := make([]Asset, 0, len(u.Favourites))
+		for _, asset := range u.Favourites {
+			if asset.GetID() != op.AssetID {
+				favourites = append(favourites, asset)
+			}
+		}
+		u.Favourites = favourites
+	case opPutCollection:
+		if updateCollection(u, op.Collection.ID, func(c *Collection) { *c = *op.Collection }) == nil {
+			u.Collections = append(u.Collections, op.Collection)
+		}
+	case opDeleteCollection:
+		collections := make([]*Collection, 0, len(u.Collections))
+		for _, c := range u.Collections {
+			if c.ID != op.AssetID {
+				collections = append(collections, c)
+			}
+		}
+		u.Collections = collections
+	case opPutTrash:
+		entry, err := decodeTrashed(*op.Trash)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", u.ID, err)
+		}
+		for _, old := range u.Trash {
+			if sameTrashed(old, entry.Asset.GetID(), entry.DeletedAt) {
+				return nil
+			}
+		}
+		u.Trash = append(u.Trash, entry)
+	case opDeleteTrash:
+		trash := make([]*TrashedAsset, 0, len(u.Trash))
+		for _, entry := range u.Trash {
+			if !sameTrashed(entry, op.AssetID, op.Trash.DeletedAt) {
+				trash = append(trash, entry)
+			}
+		}
+		u.Trash = trash
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// openTestWAL resets the store and logs its changes to a temporary file
+func openTestWAL(t *testing.T) string {
+	t.Helper()
+	resetStore()
+	path := filepath.Join(t.TempDir(), "store.wal")
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("opening log: %v", err)
+	}
+	t.Cleanup(func() { wal.Close() })
+	store.wal = wal
+	return path
+}
+
+func TestWAL_ReplayRebuildsStore(t *testing.T) {
+	path := openTestWAL(t)
+	ownerID, granteeID := uuid.New(), uuid.New()
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: ownerID})
+	store.AddUser(&User{ID: granteeID})
+	store.commit()
+	store.writeMu.Unlock()
+	token, _ := GenerateJWT(ownerID)
+
+	w := doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{
+		"type": ChartType, "favorite": true, "asset": map[string]string{"Title": "Sales"},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	chartID := store.GetUser(ownerID).Favourites[0].GetID()
+	doRequest(t, handleEditFavourite, token, http.MethodPut, "/favourites/edit?asset_id="+chartID.String(), map[string]string{"description": "edited"})
+	doRequest(t, handleShares, token, http.MethodPost, "/shares", map[string]interface{}{"asset_id": chartID, "user_id": granteeID, "permission": PermRead})
+	doRequest(t, handleCollections, token, http.MethodPost, "/collections", map[string]string{"name": "Report"})
+	other := &Chart{ID: uuid.New(), Title: "Gone"}
+	doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{"type": ChartType, "asset": other})
+	doRequest(t, handleDeleteFavourite, token, http.MethodDelete, "/favourites/delete?asset_id="+other.ID.String(), nil)
+
+	// Replay into an empty store, as after a crash
+	resetStore()
+	records, err := ReplayWAL(path)
+	if err != nil || records == 0 {
+		t.Fatalf("replaying: %d records, %v", records, err)
+	}
+	owner := store.GetUser(ownerID)
+	if owner == nil || len(owner.Favourites) != 1 || len(owner.Trash) != 1 || len(owner.Collections) != 1 {
+		t.Fatalf("unexpected replayed user %+v", owner)
+	}
+	if chart := owner.Favourites[0].(*Chart); chart.Description != "edited" || chart.Title != "Sales" {
+		t.Errorf("unexpected replayed chart %+v", chart)
+	}
+	if revs := owner.History[chartID]; len(revs) != 2 {
+		t.Errorf("expected 2 revisions replayed, got %d", len(revs))
+	}
+	if len(store.SharesForGrantee(uuid.Nil, granteeID)) != 1 {
+		t.Error("expected share replayed")
+	}
+
+	// Replaying the same records again changes nothing
+	ReplayWAL(path)
+	if revs := store.GetUser(ownerID).History[chartID]; len(revs) != 2 {
+		t.Errorf("expected replay to be idempotent, got %d revisions", len(revs))
+	}
+}
+
+func TestWAL_ReplaysOrganisationChanges(t *testing.T) {
+	path := openTestWAL(t)
+	ownerID, memberID, orgID := uuid.New(), uuid.New(), uuid.New()
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: ownerID})
+	store.AddUser(&User{ID: memberID})
+	store.CreateOrg(&Organisation{ID: orgID, Name: "GWI", OwnerID: ownerID})
+	store.InviteOrgMember(orgID, memberID)
+	store.JoinOrg(orgID, memberID)
+	store.commit()
+	store.writeMu.Unlock()
+	ownerToken, _ := GenerateJWT(ownerID)
+	memberToken, _ := GenerateJWT(memberID)
+
+	doRequest(t, handleAddFavourite, memberToken, http.MethodPost, "/favourites/add", map[string]interface{}{
+		"type": ChartType, "favorite": true, "asset": map[string]string{"Title": "Sales"},
+	})
+	chartID := store.GetUser(memberID).Favourites[0].GetID()
+	w := doRequest(t, handleTeams, ownerToken, http.MethodPost, "/teams", map[string]interface{}{"name": "Temporary"})
+	var team struct {
+		ID uuid.UUID `json:"id"`
+	}
+	json.NewDecoder(w.Body).Decode(&team)
+	stale := store.GetTeam(orgID, team.ID)
+	doRequest(t, handleTeamByID, ownerToken, http.MethodDelete, "/teams/"+team.ID.String(), nil)
+	// A request still holding the deleted team must not bring it back
+	if err := store.AddTeamMember(stale, memberID); err != errTeamNotFound {
+		t.Errorf("expected adding to a deleted team to fail, got %v", err)
+	}
+	if err := store.AddTeamAsset(stale, &Chart{ID: uuid.New()}); err != errTeamNotFound {
+		t.Errorf("expected adding an asset to a deleted team to fail, got %v", err)
+	}
+	doRequest(t, handleOrgMembers, ownerToken, http.MethodDelete, "/orgs/members?user_id="+memberID.String(), nil)
+
+	resetStore()
+	if _, err := ReplayWAL(path); err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	owner, member := store.GetUser(ownerID), store.GetUser(memberID)
+	if len(owner.Favourites) != 0 || len(owner.History) != 0 {
+		t.Errorf("expected the owner replayed without the member's assets, got %+v", owner)
+	}
+	if len(member.Favourites) != 1 || len(member.History[chartID]) != 1 || member.TenantID != uuid.Nil {
+		t.Errorf("expected the removed member replayed with their chart, got %+v", member)
+	}
+	if org := store.GetOrg(orgID); len(org.Members) != 1 || len(org.Invited) != 0 {
+		t.Errorf("expected the membership replayed, got %+v", org)
+	}
+	if store.GetTeam(orgID, team.ID) != nil {
+		t.Error("expected the team deletion replayed")
+	}
+}
+
+func TestWAL_TornTailAndCompaction(t *testing.T) {
+	path := openTestWAL(t)
+	userID := uuid.New()
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: userID, Favourites: []Asset{&Chart{ID: uuid.New(), Title: "Sales"}}})
+	store.commit()
+	store.writeMu.Unlock()
+
+	// A crash mid-append leaves half a record behind
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`0badc0de [{"op":"put_us`)
+	f.Close()
+	resetStore()
+	if records, err := ReplayWAL(path); err != nil || records != 1 {
+		t.Fatalf("expected 1 record replayed past the torn tail, got %d, %v", records, err)
+	}
+	if store.GetUser(userID) == nil {
+		t.Fatal("expected user replayed")
+	}
+	if records, _ := ReplayWAL(path); records != 1 {
+		t.Errorf("expected the torn tail cut off, got %d records", records)
+	}
+
+	// Corruption before the tail is not silently dropped
+	body, _ := os.ReadFile(path)
+	os.WriteFile(path, append([]byte("00000000 []\n"), body...), 0o600)
+	if _, err := ReplayWAL(path); err == nil {
+		t.Error("expected an error for a corrupt record before the tail")
+	}
+
+	// A snapshot contains everything logged and empties the log
+	path = openTestWAL(t)
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: userID})
+	store.commit()
+	store.writeMu.Unlock()
+	if _, err := WriteSnapshot(filepath.Join(t.TempDir(), "store.snapshot")); err != nil {
+		t.Fatalf("writing snapshot: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("expected the log truncated after the snapshot, %d bytes left", info.Size())
+	}
+}
+
+func TestWAL_LogsOwnerOfSharedEdits(t *testing.T) {
+	path := openTestWAL(t)
+	ownerID, granteeID := uuid.New(), uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Sales", Favorite: true}
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: ownerID, Favourites: []Asset{chart}})
+	store.AddUser(&User{ID: granteeID})
+	store.PutShare(&Share{ID: uuid.New(), OwnerID: ownerID, GranteeID: granteeID, AssetID: chart.ID, Permission: PermEdit})
+	store.commit()
+	store.writeMu.Unlock()
+	granteeToken, _ := GenerateJWT(granteeID)
+
+	w := doRequest(t, handleEditFavourite, granteeToken, http.MethodPut, "/favourites/edit?asset_id="+chart.ID.String(), map[string]string{"description": "by grantee"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	resetStore()
+	if _, err := ReplayWAL(path); err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	if got := findAsset(store.GetUser(ownerID), chart.ID).GetDescription(); got != "by grantee" {
+		t.Errorf("expected the grantee's edit replayed on the owner, got %q", got)
+	}
+}
+
+func TestWAL_LogsOnlyChangedEntries(t *testing.T) {
+	path := openTestWAL(t)
+	userID := uuid.New()
+	chart, other := &Chart{ID: uuid.New(), Title: "Sales"}, &Chart{ID: uuid.New(), Title: "Costs"}
+	report := &Collection{ID: uuid.New(), Name: "Report", AssetIDs: []uuid.UUID{chart.ID}}
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart, other}, Collections: []*Collection{report}})
+	store.commit()
+	store.writeMu.Unlock()
+	token, _ := GenerateJWT(userID)
+
+	lastOps := func() map[string]int {
+		body, _ := os.ReadFile(path)
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		ops, err := decodeWALRecord([]byte(lines[len(lines)-1]))
+		if err != nil {
+			t.Fatalf("decoding last record: %v", err)
+		}
+		kinds := make(map[string]int)
+		for _, op := range ops {
+			kinds[op.Op]++
+		}
+		return kinds
+	}
+	doRequest(t, handleEditFavourite, token, http.MethodPut, "/favourites/edit?asset_id="+chart.ID.String(), map[string]string{"description": "edited"})
+	if got := lastOps(); got[opPutUser] != 0 || got[opPutAsset] != 1 || len(got) != 2 {
+		t.Errorf("expected an edit to log the asset and its revision, got %v", got)
+	}
+	doRequest(t, handleDeleteFavourite, token, http.MethodDelete, "/favourites/delete?asset_id="+chart.ID.String(), nil)
+	if got := lastOps(); got[opDeleteAsset] != 1 || got[opPutTrash] != 1 || got[opPutCollection] != 1 || got[opPutUser] != 0 {
+		t.Errorf("expected trashing to log the asset, trash entry and collection, got %v", got)
+	}
+	// The same asset may be in the trash twice
+	doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{"type": ChartType, "asset": chart})
+	doRequest(t, handleDeleteFavourite, token, http.MethodDelete, "/favourites/delete?asset_id="+chart.ID.String(), nil)
+	doRequest(t, handleTrashRestore, token, http.MethodPost, "/trash/restore?asset_id="+chart.ID.String(), nil)
+	doRequest(t, handleCollectionByID, token, http.MethodDelete, "/collections/"+report.ID.String(), nil)
+	if got := lastOps(); got[opDeleteCollection] != 1 || len(got) != 1 {
+		t.Errorf("expected deleting a collection to log only its deletion, got %v", got)
+	}
+
+	want := store.GetUser(userID)
+	resetStore()
+	if _, err := ReplayWAL(path); err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	got := store.GetUser(userID)
+	if len(got.Favourites) != 2 || len(got.Trash) != 1 || len(got.Collections) != 0 {
+		t.Fatalf("unexpected replayed user %+v", got)
+	}
+	if !got.Trash[0].DeletedAt.Equal(want.Trash[0].DeletedAt) || findAsset(got, chart.ID).GetDescription() != "edited" {
+		t.Errorf("expected the trash and assets replayed as they were, got %+v", got)
+	}
+}
+
+func TestWAL_FailedCommitStops(t *testing.T) {
+	openTestWAL(t)
+	defer func(stop func(error)) { walFailStop = stop }(walFailStop)
+	var stopped error
+	walFailStop = func(err error) { stopped = err }
+	userID := uuid.New()
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: userID})
+	store.commit()
+	store.writeMu.Unlock()
+	token, _ := GenerateJWT(userID)
+
+	// The change is in memory once the append fails
+	store.wal.f.Close()
+	w := doRequest(t, handleCollections, token, http.MethodPost, "/collections", map[string]string{"name": "Report"})
+	if w.Code != http.StatusInternalServerError || stopped == nil {
+		t.Errorf("expected the server stopped and status %d, got %d and %v", http.StatusInternalServerError, w.Code, stopped)
+	}
+}
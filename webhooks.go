@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Delivery statuses. Deliveries that run out of attempts are dead letters,
+// kept until retried or their webhook is removed.
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryDead      = "dead"
+)
+
+// webhookEvents are the events a webhook can filter on: the change stream's
+// types, and favourite toggles which are also updates
+var webhookEvents = []string{EventCreated, EventUpdated, EventDeleted, ChangeFavorited, ChangeUnfavorited}
+
+var (
+	webhookMaxAttempts = 8
+	webhookBackoff     = 10 * time.Second
+	webhookMaxBackoff  = time.Hour
+	webhookClient      = newWebhookClient(publicIP)
+	webhookWake        = make(chan struct{}, 1)
+)
+
+const (
+	webhookWorkers         = 4
+	webhookLogSize         = 100
+	webhookAttemptsKept    = 20
+	webhookDispatchEvery   = time.Second
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// newWebhookClient returns the client delivering webhooks. It only connects
+// to the addresses allowed, checked once DNS is resolved so a name cannot
+// point at the internal network, and it neither uses a proxy nor follows
+// redirects, which would get around the check.
+func newWebhookClient(allowed func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("refusing to connect to %s", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 5 * time.Second},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// specialPurposeNets are the IANA special-purpose ranges webhooks are never
+// delivered to. IPv4-mapped IPv6 addresses are checked as the IPv4 address
+// they embed; the IPv6 ranges that embed or translate to IPv4 are refused
+// outright.
+var specialPurposeNets = parseCIDRs(
+	// IPv4
+	"0.0.0.0/8",       // this network
+	"10.0.0.0/8",      // private
+	"100.64.0.0/10",   // shared address space (carrier-grade NAT, cloud metadata)
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local
+	"172.16.0.0/12",   // private
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"192.88.99.0/24",  // 6to4 relay anycast
+	"192.168.0.0/16",  // private
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved, including broadcast
+	// IPv6
+	"::/96",          // unspecified, loopback and IPv4-compatible
+	"64:ff9b::/96",   // NAT64
+	"64:ff9b:1::/48", // local-use NAT64
+	"100::/64",       // discard-only
+	"2001::/23",      // IETF protocol assignments, including Teredo
+	"2001:db8::/32",  // documentation
+	"2002::/16",      // 6to4
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"fec0::/10",      // site-local
+	"ff00::/8",       // multicast
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for n, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[n] = ipnet
+	}
+	return nets
+}
+
+// publicIP reports whether webhooks may be delivered to ip, which must not
+// be in any special-purpose range
+func publicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, ipnet := range specialPurposeNets {
+		if ipnet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Webhook is an endpoint notified of the changes to its owner's assets.
+// Webhooks registered by an operator have the owner uuid.Nil and receive the
+// changes of every user.
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	OwnerID   uuid.UUID `json:"owner_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeliveryAttempt is one POST of a delivery
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Delivery is an event queued for, or logged against, a webhook. Failures
+// counts the failed attempts since it was last queued.
+type Delivery struct {
+	ID            uuid.UUID         `json:"id"`
+	WebhookID     uuid.UUID         `json:"webhook_id"`
+	Event         string            `json:"event"`
+	Payload       json.RawMessage   `json:"payload"`
+	Status        string            `json:"status"`
+	Failures      int               `json:"failures"`
+	Attempts      []DeliveryAttempt `json:"attempts"`
+	CreatedAt     time.Time         `json:"created_at"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+}
+
+// webhookPayload is the signed body POSTed to a webhook
+type webhookPayload struct {
+	ID            uuid.UUID       `json:"id"`
+	Event         string          `json:"event"`
+	UserID        uuid.UUID       `json:"user_id"`
+	AssetID       uuid.UUID       `json:"asset_id"`
+	AssetType     string          `json:"asset_type"`
+	Asset         json.RawMessage `json:"asset,omitempty"`
+	CollectionIDs []uuid.UUID     `json:"collection_ids,omitempty"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// webhookEvent names an event for webhooks: favourite toggles by their change
+func webhookEvent(ev Event) string {
+	if ev.Change != "" {
+		return ev.Change
+	}
+	return ev.Type
+}
+
+// matches reports whether the webhook wants the event. An updated filter also
+// matches favourite toggles.
+func (wh *Webhook) matches(ev Event) bool {
+	if wh.OwnerID != uuid.Nil && wh.OwnerID != ev.UserID {
+		return false
+	}
+	if len(wh.Events) == 0 {
+		return true
+	}
+	for _, name := range wh.Events {
+		if name == ev.Type || name == ev.Change {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueDeliveriesLocked queues a delivery of each event for every matching
+// webhook, returning how many were queued. The caller holds s.mu.
+func (s *Storage) enqueueDeliveriesLocked(evs []Event) int {
+	queued := 0
+	for _, ev := range evs {
+		for _, wh := range s.webhooks {
+			if !wh.matches(ev) {
+				continue
+			}
+			d := &Delivery{ID: uuid.New(), WebhookID: wh.ID, Event: webhookEvent(ev), Status: deliveryPending, CreatedAt: ev.At, NextAttemptAt: ev.At}
+			payload, err := json.Marshal(webhookPayload{
+				ID: d.ID, Event: d.Event, UserID: ev.UserID, AssetID: ev.AssetID, AssetType: ev.AssetType,
+				Asset: ev.Asset, CollectionIDs: ev.CollectionIDs, OccurredAt: ev.At,
+			})
+			if err != nil {
+				log.Printf("enqueueDeliveries: cannot encode event for webhook %s: %v", wh.ID, err)
+				continue
+			}
+			d.Payload = payload
+			s.deliveries[d.ID] = d
+			s.logLocked(walOp{Op: opPutDelivery, Delivery: d})
+			queued++
+		}
+	}
+	return queued
+}
+
+// wakeWebhooks tells the dispatcher deliveries are due
+func wakeWebhooks() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// signPayload is the X-Webhook-Signature of a body sent at the timestamp:
+// the hex HMAC-SHA256, keyed by the secret, of "<timestamp>.<body>"
+func signPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay is the wait after the nth consecutive failure
+func webhookRetryDelay(failures int) time.Duration {
+	delay := webhookBackoff
+	for i := 1; i < failures && delay < webhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookMaxBackoff)
+}
+
+// runWebhookDispatcher delivers due deliveries, checking every interval and
+// whenever a mutation queues some, until the context is cancelled
+func runWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+		dispatchWebhooks(ctx, time.Now())
+	}
+}
+
+// dispatchWebhooks attempts the deliveries due by now, a few at a time
+func dispatchWebhooks(ctx context.Context, now time.Time) {
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, webhookWorkers)
+	for _, d := range store.DueDeliveries(now) {
+		wh := store.webhook(d.WebhookID)
+		if wh == nil {
+			continue
+		}
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(wh *Webhook, d *Delivery) {
+			defer func() { <-workers; wg.Done() }()
+			attempt := attemptDelivery(ctx, wh, d)
+			// an attempt cut short by shutdown is retried on restart
+			if ctx.Err() == nil {
+				recordAttempt(d, attempt)
+			}
+		}(wh, d)
+	}
+	wg.Wait()
+}
+
+// attemptDelivery POSTs the signed payload; any 2xx response is a success
+func attemptDelivery(ctx context.Context, wh *Webhook, d *Delivery) DeliveryAttempt {
+	attempt := DeliveryAttempt{At: time.Now().UTC()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "platform-go-challenge-webhooks")
+	req.Header.Set("X-Webhook-ID", d.ID.String())
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(attempt.At.Unix(), 10))
+	req.Header.Set(webhookSignatureHeader, signPayload(wh.Secret, attempt.At.Unix(), d.Payload))
+	resp, err := webhookClient.Do(req)
+	attempt.DurationMS = time.Since(attempt.At).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = resp.Status
+	}
+	return attempt
+}
+
+// recordAttempt logs an attempt and decides what happens to the delivery:
+// delivered, retried after a backoff, or dead after webhookMaxAttempts failures
+func recordAttempt(d *Delivery, attempt DeliveryAttempt) {
+	store.writeMu.Lock()
+	defer store.writeMu.Unlock()
+	current := store.GetDelivery(d.WebhookID, d.ID)
+	if current == nil || current.Status != deliveryPending {
+		return
+	}
+	next := *current
+	next.Attempts = append(append([]DeliveryAttempt(nil), current.Attempts...), attempt)
+	if len(next.Attempts) > webhookAttemptsKept {
+		next.Attempts = next.Attempts[len(next.Attempts)-webhookAttemptsKept:]
+	}
+	switch {
+	case attempt.Error == "":
+		next.Status = deliveryDelivered
+	case next.Failures+1 >= webhookMaxAttempts:
+		next.Failures++
+		next.Status = deliveryDead
+		log.Printf("recordAttempt: delivery %s to webhook %s is dead after %d attempts: %s", d.ID, d.WebhookID, next.Failures, attempt.Error)
+	default:
+		next.Failures++
+		next.NextAttemptAt = attempt.At.Add(webhookRetryDelay(next.Failures))
+	}
+	store.PutDelivery(&next)
+	if err := store.commit(); err != nil {
+		log.Printf("recordAttempt: cannot log delivery %s: %v", d.ID, err)
+	}
+}
+
+// webhookView hides the secret, which is only shown when a webhook is created
+func webhookView(wh *Webhook) *Webhook {
+	view := *wh
+	view.Secret = ""
+	return &view
+}
+
+// Lists the user's webhooks (GET) or registers one (POST)
+func handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleWebhooks")
+	if !ok {
+		return
+	}
+	serveWebhooks(w, r, user.ID, "handleWebhooks")
+}
+
+// Serves /webhooks/{id}, its delivery log and retries for the user
+func handleWebhookByID(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleWebhookByID")
+	if !ok {
+		return
+	}
+	serveWebhookByID(w, r, user.ID, "/webhooks/", "handleWebhookByID")
+}
+
+// Operator webhooks receive the changes of every user. Their mutations
+// commit like those of AuthMiddleware.
+func handleAdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	adminMutation(w, r, func(w http.ResponseWriter, r *http.Request) {
+		serveWebhooks(w, r, uuid.Nil, "handleAdminWebhooks")
+	})
+}
+
+func handleAdminWebhookByID(w http.ResponseWriter, r *http.Request) {
+	adminMutation(w, r, func(w http.ResponseWriter, r *http.Request) {
+		serveWebhookByID(w, r, uuid.Nil, "/admin/webhooks/", "handleAdminWebhookByID")
+	})
+}
+
+func adminMutation(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		next(w, r)
+		return
+	}
+	serveMutation(w, r, next)
+}
+
+func serveWebhooks(w http.ResponseWriter, r *http.Request, ownerID uuid.UUID, handler string) {
+	switch r.Method {
+	case http.MethodGet:
+		webhooks := store.WebhooksOf(ownerID)
+		views := make([]*Webhook, 0, len(webhooks))
+		for _, wh := range webhooks {
+			views = append(views, webhookView(wh))
+		}
+		log.Printf("%s: returning %d webhooks", handler, len(views))
+		json.NewEncoder(w).Encode(views)
+	case http.MethodPost:
+		var req struct {
+			URL    string   `json:"url"`
+			Events []string `json:"events"`
+			Secret string   `json:"secret"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("%s: invalid request body: %v", handler, err)
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := validateWebhook(req.URL, req.Events); err != nil {
+			log.Printf("%s: invalid webhook: %v", handler, err)
+			http.Error(w, "Invalid webhook: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Secret == "" {
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				log.Printf("%s: cannot generate secret: %v", handler, err)
+				http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+				return
+			}
+			req.Secret = hex.EncodeToString(secret)
+		}
+		if req.Events == nil {
+			req.Events = []string{}
+		}
+		wh := &Webhook{ID: uuid.New(), OwnerID: ownerID, URL: req.URL, Events: req.Events, Secret: req.Secret, CreatedAt: time.Now().UTC()}
+		store.PutWebhook(wh)
+		log.Printf("%s: webhook %s registered for %s", handler, wh.ID, wh.URL)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(wh)
+	default:
+		log.Printf("%s: method not allowed %s", handler, r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateWebhook checks the endpoint is an absolute http(s) URL and the
+// filters name known events
+func validateWebhook(endpoint string, filters []string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, name := range filters {
+		known := false
+		for _, event := range webhookEvents {
+			known = known || name == event
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q, expected one of %s", name, strings.Join(webhookEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// serveWebhookByID routes {id} (GET, DELETE), {id}/deliveries (GET,
+// ?status=pending|delivered|dead) and {id}/deliveries/{delivery}/retry (POST)
+func serveWebhookByID(w http.ResponseWriter, r *http.Request, ownerID uuid.UUID, prefix, handler string) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+	webhookID, err := uuid.Parse(parts[0])
+	var wh *Webhook
+	if err == nil {
+		wh = store.GetWebhook(ownerID, webhookID)
+	}
+	if wh == nil {
+		log.Printf("%s: webhook not found %s", handler, r.URL.Path)
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(webhookView(wh))
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		store.RemoveWebhook(wh.ID)
+		log.Printf("%s: webhook %s removed", handler, wh.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "deliveries" && r.Method == http.MethodGet:
+		status := r.URL.Query().Get("status")
+		if status != "" && status != deliveryPending && status != deliveryDelivered && status != deliveryDead {
+			log.Printf("%s: invalid status %q", handler, status)
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		deliveries := store.DeliveriesOf(wh.ID, status)
+		log.Printf("%s: returning %d deliveries of webhook %s", handler, len(deliveries), wh.ID)
+		json.NewEncoder(w).Encode(deliveries)
+	case len(parts) == 4 && parts[1] == "deliveries" && parts[3] == "retry" && r.Method == http.MethodPost:
+		deliveryID, err := uuid.Parse(parts[2])
+		var d *Delivery
+		if err == nil {
+			d = store.GetDelivery(wh.ID, deliveryID)
+		}
+		if d == nil {
+			log.Printf("%s: delivery not found %s", handler, parts[2])
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+			return
+		}
+		if d.Status == deliveryPending {
+			log.Printf("%s: delivery %s already pending", handler, d.ID)
+			http.Error(w, "Delivery is already pending", http.StatusConflict)
+			return
+		}
+		next := *d
+		next.Status, next.Failures, next.NextAttemptAt = deliveryPending, 0, time.Now().UTC()
+		store.PutDelivery(&next)
+		wakeWebhooks()
+		log.Printf("%s: delivery %s queued again", handler, d.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(&next)
+	default:
+		log.Printf("%s: no route for %s %s", handler, r.Method, r.URL.Path)
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
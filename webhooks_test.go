@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// webhookReceiver records the deliveries it accepts and answers with status
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func (rec *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.received = append(rec.received, r)
+	rec.bodies = append(rec.bodies, body)
+	w.WriteHeader(rec.status)
+}
+
+func registerWebhook(t *testing.T, token, url string, events []string) *Webhook {
+	t.Helper()
+	w := doRequest(t, handleWebhooks, token, http.MethodPost, "/webhooks", map[string]interface{}{"url": url, "events": events, "secret": "shh"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var wh Webhook
+	json.NewDecoder(w.Body).Decode(&wh)
+	return &wh
+}
+
+// allowLoopbackWebhooks lets the webhooks of a test reach its httptest servers
+func allowLoopbackWebhooks(t *testing.T) {
+	t.Helper()
+	client := webhookClient
+	webhookClient = newWebhookClient(func(net.IP) bool { return true })
+	t.Cleanup(func() { webhookClient = client })
+}
+
+func TestWebhooks_SignedDelivery(t *testing.T) {
+	resetStore()
+	allowLoopbackWebhooks(t)
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Sales", Favorite: true}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart}})
+	token, _ := GenerateJWT(userID)
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	wh := registerWebhook(t, token, server.URL, []string{ChangeUnfavorited})
+
+	doRequest(t, handleEditFavourite, token, http.MethodPut, "/favourites/edit?asset_id="+chart.ID.String(), map[string]string{"description": "ignored"})
+	doRequest(t, handleRemoveFavourite, token, http.MethodPut, "/favourites/remove?asset_id="+chart.ID.String(), map[string]bool{"favorite": false})
+	dispatchWebhooks(context.Background(), time.Now())
+
+	if len(receiver.received) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(receiver.received))
+	}
+	req, body := receiver.received[0], receiver.bodies[0]
+	timestamp, _ := strconv.ParseInt(req.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if req.Header.Get(webhookSignatureHeader) != signPayload("shh", timestamp, body) {
+		t.Error("expected a valid signature")
+	}
+	var payload webhookPayload
+	json.Unmarshal(body, &payload)
+	if payload.Event != ChangeUnfavorited || payload.AssetID != chart.ID || payload.UserID != userID {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+
+	w := doRequest(t, handleWebhookByID, token, http.MethodGet, "/webhooks/"+wh.ID.String()+"/deliveries?status=delivered", nil)
+	var deliveries []*Delivery
+	json.NewDecoder(w.Body).Decode(&deliveries)
+	if len(deliveries) != 1 || len(deliveries[0].Attempts) != 1 || deliveries[0].Attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("unexpected delivery log %+v", deliveries)
+	}
+	// The secret is only shown on creation
+	w = doRequest(t, handleWebhooks, token, http.MethodGet, "/webhooks", nil)
+	var listed []*Webhook
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].Secret != "" {
+		t.Errorf("unexpected webhook list %+v", listed)
+	}
+}
+
+func TestWebhooks_BackoffAndDeadLetters(t *testing.T) {
+	resetStore()
+	allowLoopbackWebhooks(t)
+	webhookMaxAttempts = 3
+	defer func() { webhookMaxAttempts = 8 }()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	token, _ := GenerateJWT(userID)
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	wh := registerWebhook(t, token, server.URL, nil)
+	doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{"type": ChartType, "asset": map[string]string{"Title": "Sales"}})
+
+	now := time.Now()
+	dispatchWebhooks(context.Background(), now)
+	d := store.DeliveriesOf(wh.ID, "")[0]
+	if d.Status != deliveryPending || d.Failures != 1 || d.NextAttemptAt.Sub(d.Attempts[0].At) != webhookBackoff {
+		t.Fatalf("expected a retry after %v, got %+v", webhookBackoff, d)
+	}
+	// Not due again until the backoff has passed
+	dispatchWebhooks(context.Background(), now)
+	if len(receiver.received) != 1 {
+		t.Errorf("expected no attempt before the backoff, got %d", len(receiver.received))
+	}
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Hour)
+		dispatchWebhooks(context.Background(), now)
+	}
+	if dead := store.DeliveriesOf(wh.ID, deliveryDead); len(dead) != 1 || dead[0].Failures != 3 {
+		t.Fatalf("expected a dead letter after 3 attempts, got %+v", dead)
+	}
+
+	receiver.status = http.StatusNoContent
+	w := doRequest(t, handleWebhookByID, token, http.MethodPost, "/webhooks/"+wh.ID.String()+"/deliveries/"+d.ID.String()+"/retry", nil)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	dispatchWebhooks(context.Background(), time.Now())
+	if delivered := store.DeliveriesOf(wh.ID, deliveryDelivered); len(delivered) != 1 || len(delivered[0].Attempts) != 4 {
+		t.Errorf("expected the retried delivery delivered, got %+v", delivered)
+	}
+}
+
+func TestWebhooks_QueueSurvivesRestart(t *testing.T) {
+	path := openTestWAL(t)
+	userID := uuid.New()
+	store.writeMu.Lock()
+	store.AddUser(&User{ID: userID})
+	store.commit()
+	store.writeMu.Unlock()
+	token, _ := GenerateJWT(userID)
+	wh := registerWebhook(t, token, "http://127.0.0.1:1/unreachable", []string{EventCreated})
+	doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{"type": ChartType, "asset": map[string]string{"Title": "Sales"}})
+
+	resetStore()
+	if _, err := ReplayWAL(path); err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	if due := store.DueDeliveries(time.Now()); len(due) != 1 || due[0].WebhookID != wh.ID || store.webhook(wh.ID).Secret != "shh" {
+		t.Errorf("expected the queued delivery replayed, got %+v", due)
+	}
+}
+
+func TestAdminWebhooks_ReceiveAllUsers(t *testing.T) {
+	resetStore()
+	adminToken = "operator-secret"
+	defer func() { adminToken = "" }()
+	req := httptest.NewRequest(http.MethodPost, "/admin/webhooks", strings.NewReader(`{"url": "https://crm.example.com/hook"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	w := httptest.NewRecorder()
+	AdminMiddleware(handleAdminWebhooks)(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	for _, user := range []uuid.UUID{uuid.New(), uuid.New()} {
+		store.AddUser(&User{ID: user})
+		token, _ := GenerateJWT(user)
+		doRequest(t, handleAddFavourite, token, http.MethodPost, "/favourites/add", map[string]interface{}{"type": ChartType, "asset": map[string]string{"Title": "Sales"}})
+	}
+	if due := store.DueDeliveries(time.Now()); len(due) != 2 {
+		t.Errorf("expected a delivery per user, got %d", len(due))
+	}
+	if len(store.WebhooksOf(uuid.Nil)) != 1 {
+		t.Error("expected the operator webhook listed under the nil owner")
+	}
+}
+
+func TestWebhooks_PublicIP(t *testing.T) {
+	cases := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"2606:4700::1111", true},
+		{"::ffff:93.184.216.34", true},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"240.0.0.1", false},
+		{"192.0.0.1", false},
+		{"198.18.0.1", false},
+		{"::", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::127.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b:1::1", false},
+		{"2001::1", false},
+		{"2002:7f00:1::", false},
+		{"2001:db8::1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"fec0::1", false},
+		{"ff02::1", false},
+	}
+	for _, tc := range cases {
+		if got := publicIP(net.ParseIP(tc.addr)); got != tc.public {
+			t.Errorf("publicIP(%s) = %v, want %v", tc.addr, got, tc.public)
+		}
+	}
+}
+
+func TestWebhooks_RefusesInternalAddressesAndRedirects(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirect.Close()
+
+	if _, err := webhookClient.Post(server.URL, "application/json", nil); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("expected a loopback endpoint refused, got %v", err)
+	}
+
+	allowLoopbackWebhooks(t)
+	resp, err := webhookClient.Post(redirect.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("posting: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || len(receiver.received) != 0 {
+		t.Errorf("expected the redirect not followed, got %d and %d deliveries", resp.StatusCode, len(receiver.received))
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait     = 10 * time.Second
+	wsPongWait      = 60 * time.Second
+	wsPingInterval  = wsPongWait * 9 / 10
+	wsMaxMessage    = 64 << 10
+	wsOutboundQueue = 64
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+
+// wsConns are the open sockets, closed by closeWebSockets at shutdown
+var wsConns = struct {
+	sync.Mutex
+	m      map[*wsConn]struct{}
+	closed bool
+}{m: make(map[*wsConn]struct{})}
+
+// wsMessage is a client message. Data is the body of a mutation, as it would
+// be sent to the matching HTTP endpoint.
+type wsMessage struct {
+	ID           string          `json:"id"`
+	Type         string          `json:"type"`
+	AssetID      uuid.UUID       `json:"asset_id"`
+	CollectionID uuid.UUID       `json:"collection_id"`
+	Data         json.RawMessage `json:"data"`
+}
+
+// wsReply is a server message: the result of a client message (echoing its
+// id) or an event of a subscription
+type wsReply struct {
+	ID     string          `json:"id,omitempty"`
+	Type   string          `json:"type"`
+	Status int             `json:"status,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Event  *Event          `json:"event,omitempty"`
+}
+
+// wsMutation maps a socket mutation onto the HTTP handler implementing it
+type wsMutation struct {
+	method      string
+	path        func(assetID uuid.UUID) string
+	contentType string
+	handler     http.HandlerFunc
+}
+
+func byQuery(path string) func(uuid.UUID) string {
+	return func(id uuid.UUID) string { return path + "?asset_id=" + id.String() }
+}
+
+func byPath(action string) func(uuid.UUID) string {
+	return func(id uuid.UUID) string { return strings.TrimSuffix("/favourites/"+id.String()+"/"+action, "/") }
+}
+
+var wsMutations = map[string]wsMutation{
+	"add":      {method: http.MethodPost, path: func(uuid.UUID) string { return "/favourites/add" }, handler: handleAddFavourite},
+	"favorite": {method: http.MethodPut, path: byQuery("/favourites/remove"), handler: handleRemoveFavourite},
+	"edit":     {method: http.MethodPut, path: byQuery("/favourites/edit"), handler: handleEditFavourite},
+	"delete":   {method: http.MethodDelete, path: byQuery("/favourites/delete"), handler: handleDeleteFavourite},
+	"update":   {method: http.MethodPatch, path: byPath(""), contentType: mergePatchType, handler: handleFavouriteByID},
+	"tags":     {method: http.MethodPut, path: byPath("tags"), handler: handleFavouriteByID},
+	"move":     {method: http.MethodPost, path: byPath("move"), handler: handleFavouriteByID},
+	"pin":      {method: http.MethodPut, path: byPath("pin"), handler: handleFavouriteByID},
+}
+
+// wsConn is one socket. Subscriptions filter the events of the owners whose
+// assets or collections the client follows.
+type wsConn struct {
+	conn   *websocket.Conn
+	req    *http.Request
+	user   *User
+	send   chan wsReply
+	done   chan struct{}
+	closer sync.Once
+
+	mu          sync.Mutex
+	assets      map[uuid.UUID]bool
+	collections map[uuid.UUID]uuid.UUID
+	feeds       map[uuid.UUID]chan Event
+}
+
+// Serves the WebSocket API: clients subscribe to assets or collections and
+// issue mutations. Browsers, which cannot set headers on a WebSocket, may pass
+// the token as ?access_token=.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r, "handleWebSocket")
+	if !ok {
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("handleWebSocket: upgrade failed: %v", err)
+		return
+	}
+	c := &wsConn{
+		conn:        conn,
+		req:         r,
+		user:        user,
+		send:        make(chan wsReply, wsOutboundQueue),
+		done:        make(chan struct{}),
+		assets:      make(map[uuid.UUID]bool),
+		collections: make(map[uuid.UUID]uuid.UUID),
+		feeds:       make(map[uuid.UUID]chan Event),
+	}
+	wsConns.Lock()
+	if wsConns.closed {
+		wsConns.Unlock()
+		c.close(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	wsConns.m[c] = struct{}{}
+	wsConns.Unlock()
+	log.Printf("handleWebSocket: user %s connected", user.ID)
+	// the token is only checked on connect, so the socket ends with it
+	if expiresAt, ok := tokenExpiry(r); ok {
+		expiry := time.AfterFunc(time.Until(expiresAt), func() {
+			log.Printf("handleWebSocket: token of user %s expired", user.ID)
+			c.close(websocket.ClosePolicyViolation, "token expired")
+		})
+		defer expiry.Stop()
+	}
+	go c.writeLoop()
+	c.readLoop()
+	c.close(websocket.CloseNormalClosure, "")
+	wsConns.Lock()
+	delete(wsConns.m, c)
+	wsConns.Unlock()
+	log.Printf("handleWebSocket: user %s disconnected", user.ID)
+}
+
+// wsTokenFromQuery moves an ?access_token= into the Authorization header
+func wsTokenFromQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next(w, r)
+	}
+}
+
+func (c *wsConn) readLoop() {
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				if !c.reply(wsReply{Type: "error", Status: http.StatusBadRequest, Error: "Invalid message"}) {
+					return
+				}
+				continue
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("handleWebSocket: read failed for user %s: %v", c.user.ID, err)
+			}
+			return
+		}
+		if !c.reply(c.handle(msg)) {
+			return
+		}
+	}
+}
+
+// writeLoop is the only writer of the socket; it also sends the heartbeat
+func (c *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case reply := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(reply); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+// reply queues a result, waiting while the client catches up; reading stops
+// meanwhile, which pushes back on a client sending faster than it reads
+func (c *wsConn) reply(reply wsReply) bool {
+	select {
+	case c.send <- reply:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// push queues an event; a client that lets its queue fill up is disconnected
+// and should reload its state when it reconnects
+func (c *wsConn) push(ev Event) {
+	select {
+	case c.send <- wsReply{Type: "event", Event: &ev}:
+	case <-c.done:
+	default:
+		log.Printf("handleWebSocket: user %s too slow, disconnecting", c.user.ID)
+		c.close(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+// close ends the connection once, sending a close frame with the code
+func (c *wsConn) close(code int, reason string) {
+	c.closer.Do(func() {
+		close(c.done)
+		if code != websocket.CloseAbnormalClosure {
+			msg := websocket.FormatCloseMessage(code, reason)
+			c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+		}
+		c.conn.Close()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for owner, ch := range c.feeds {
+			events.Unsubscribe(owner, ch)
+			delete(c.feeds, owner)
+		}
+	})
+}
+
+// closeWebSockets tells every client the server is going away and refuses
+// new sockets
+func closeWebSockets() {
+	wsConns.Lock()
+	wsConns.closed = true
+	conns := make([]*wsConn, 0, len(wsConns.m))
+	for c := range wsConns.m {
+		conns = append(conns, c)
+	}
+	wsConns.Unlock()
+	for _, c := range conns {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	log.Printf("closeWebSockets: closed %d sockets", len(conns))
+}
+
+func (c *wsConn) handle(msg wsMessage) wsReply {
+	switch msg.Type {
+	case "subscribe", "unsubscribe":
+		status, err := c.subscribe(msg)
+		if err != nil {
+			return wsReply{ID: msg.ID, Type: "error", Status: status, Error: err.Error()}
+		}
+		return wsReply{ID: msg.ID, Type: "result", Status: status}
+	}
+	mutation, ok := wsMutations[msg.Type]
+	if !ok {
+		return wsReply{ID: msg.ID, Type: "error", Status: http.StatusBadRequest, Error: "Unknown message type " + msg.Type}
+	}
+	return c.mutate(msg, mutation)
+}
+
+// subscribe adds or removes a subscription to an asset the user can read or
+// to one of their own or shared collections
+func (c *wsConn) subscribe(msg wsMessage) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	subscribe := msg.Type == "subscribe"
+	switch {
+	case msg.AssetID != uuid.Nil:
+		if !subscribe {
+			delete(c.assets, msg.AssetID)
+			return http.StatusOK, nil
+		}
+		owner, _, err := resolveAsset(c.user, msg.AssetID, PermRead)
+		if errors.Is(err, errForbidden) {
+			return http.StatusForbidden, errors.New("Insufficient permission on asset")
+		}
+		if err != nil {
+			return http.StatusNotFound, errors.New("Asset not found")
+		}
+		c.assets[msg.AssetID] = true
+		c.followLocked(owner.ID)
+	case msg.CollectionID != uuid.Nil:
+		if !subscribe {
+			delete(c.collections, msg.CollectionID)
+			return http.StatusOK, nil
+		}
+		owner, _, err := resolveCollection(c.user, msg.CollectionID, PermRead)
+		if err != nil {
+			return http.StatusNotFound, errors.New("Collection not found")
+		}
+		c.collections[msg.CollectionID] = owner.ID
+		c.followLocked(owner.ID)
+	default:
+		return http.StatusBadRequest, errors.New("Subscription needs an asset_id or collection_id")
+	}
+	return http.StatusOK, nil
+}
+
+// followLocked subscribes to the events of an owner, once. The caller holds
+// c.mu.
+func (c *wsConn) followLocked(owner uuid.UUID) {
+	if _, ok := c.feeds[owner]; ok {
+		return
+	}
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	ch, _, _ := events.Subscribe(owner, math.MaxUint64)
+	c.feeds[owner] = ch
+	go c.forward(owner, ch)
+}
+
+// forward pushes the owner's events that match a subscription and that the
+// user can still read. If the hub drops the feed the connection is closed, as
+// events were lost.
+func (c *wsConn) forward(owner uuid.UUID, ch chan Event) {
+	for ev := range ch {
+		if c.wants(ev) && c.canRead(ev) {
+			c.push(ev)
+		}
+	}
+	c.mu.Lock()
+	dropped := c.feeds[owner] == ch
+	c.mu.Unlock()
+	if dropped {
+		c.close(websocket.CloseTryAgainLater, "events lost")
+	}
+}
+
+func (c *wsConn) wants(ev Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.assets[ev.AssetID] {
+		return true
+	}
+	for _, id := range ev.CollectionIDs {
+		if owner, ok := c.collections[id]; ok && owner == ev.UserID {
+			return true
+		}
+	}
+	return false
+}
+
+// canRead checks the event against the user's current access, as shares can be
+// revoked after subscribing. A deleted asset is no longer found, so its
+// deletion is sent while a share of it or of a collection that held it stays.
+func (c *wsConn) canRead(ev Event) bool {
+	user := store.GetUser(c.user.ID)
+	if user == nil {
+		return false
+	}
+	if ev.Type != EventDeleted {
+		owner, _, err := resolveAsset(user, ev.AssetID, PermRead)
+		return err == nil && owner.ID == ev.UserID
+	}
+	if ev.UserID == user.ID {
+		return true
+	}
+	for _, share := range store.SharesForGrantee(store.TenantOf(user), user.ID) {
+		if share.OwnerID == ev.UserID && (share.AssetID == ev.AssetID || containsID(ev.CollectionIDs, share.CollectionID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mutate runs a mutation through its HTTP handler, as the connected user
+func (c *wsConn) mutate(msg wsMessage, mutation wsMutation) wsReply {
+	req, err := http.NewRequestWithContext(c.req.Context(), mutation.method, mutation.path(msg.AssetID), bytes.NewReader(msg.Data))
+	if err != nil {
+		return wsReply{ID: msg.ID, Type: "error", Status: http.StatusBadRequest, Error: "Invalid mutation"}
+	}
+	if mutation.contentType != "" {
+		req.Header.Set("Content-Type", mutation.contentType)
+	}
+	buf := &bufferedResponse{header: make(http.Header)}
+	serveMutation(buf, req, mutation.handler)
+	reply := wsReply{ID: msg.ID, Type: "result", Status: buf.status}
+	if reply.Status == 0 {
+		reply.Status = http.StatusOK
+	}
+	body := bytes.TrimSpace(buf.body.Bytes())
+	if reply.Status >= http.StatusBadRequest {
+		reply.Type, reply.Error = "error", string(body)
+	} else if json.Valid(body) {
+		reply.Data = body
+	}
+	return reply
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func dialWS(t *testing.T, userID uuid.UUID) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(wsTokenFromQuery(AuthMiddleware(handleWebSocket)))
+	t.Cleanup(server.Close)
+	token, _ := GenerateJWT(userID)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?access_token=" + token
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func sendWS(t *testing.T, conn *websocket.Conn, msg map[string]interface{}) {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatalf("writing: %v", err)
+	}
+}
+
+// readWS reads the reply to the message id and the events that arrive
+// before it
+func readWS(t *testing.T, conn *websocket.Conn, id string) (result wsReply, events []Event) {
+	t.Helper()
+	for {
+		var reply wsReply
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("reading: %v", err)
+		}
+		if reply.Type == "event" {
+			events = append(events, *reply.Event)
+			continue
+		}
+		if reply.ID == id {
+			return reply, events
+		}
+	}
+}
+
+func TestWebSocket_SubscribeAndMutate(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	chart := &Chart{ID: uuid.New(), Title: "Sales"}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{chart}})
+	conn := dialWS(t, userID)
+
+	sendWS(t, conn, map[string]interface{}{"id": "1", "type": "subscribe", "asset_id": chart.ID})
+	if reply, _ := readWS(t, conn, "1"); reply.Type != "result" || reply.Status != http.StatusOK {
+		t.Fatalf("unexpected subscribe reply %+v", reply)
+	}
+	sendWS(t, conn, map[string]interface{}{"id": "2", "type": "edit", "asset_id": chart.ID, "data": map[string]string{"description": "edited"}})
+	reply, received := readWS(t, conn, "2")
+	if reply.Status != http.StatusOK {
+		t.Fatalf("unexpected edit reply %+v", reply)
+	}
+	var edited Chart
+	json.Unmarshal(reply.Data, &edited)
+	if edited.Description != "edited" || findAsset(store.GetUser(userID), chart.ID).GetDescription() != "edited" {
+		t.Errorf("expected description edited, got %q", edited.Description)
+	}
+	if len(received) == 0 {
+		var ev wsReply
+		if err := conn.ReadJSON(&ev); err != nil || ev.Type != "event" {
+			t.Fatalf("expected an event, got %+v (%v)", ev, err)
+		}
+		received = append(received, *ev.Event)
+	}
+	if received[0].Type != EventUpdated || received[0].AssetID != chart.ID {
+		t.Errorf("unexpected event %+v", received[0])
+	}
+
+	// Failed mutations report the handler's status
+	sendWS(t, conn, map[string]interface{}{"id": "3", "type": "delete", "asset_id": uuid.New()})
+	if reply, _ := readWS(t, conn, "3"); reply.Type != "error" || reply.Status != http.StatusNotFound {
+		t.Errorf("unexpected delete reply %+v", reply)
+	}
+	sendWS(t, conn, map[string]interface{}{"id": "4", "type": "launch"})
+	if reply, _ := readWS(t, conn, "4"); reply.Status != http.StatusBadRequest {
+		t.Errorf("unexpected reply to unknown type %+v", reply)
+	}
+}
+
+func TestWebSocket_CollectionSubscription(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	inside, outside := &Chart{ID: uuid.New(), Title: "In"}, &Chart{ID: uuid.New(), Title: "Out"}
+	collection := &Collection{ID: uuid.New(), Name: "Report", AssetIDs: []uuid.UUID{inside.ID}}
+	store.AddUser(&User{ID: userID, Favourites: []Asset{inside, outside}, Collections: []*Collection{collection}})
+	conn := dialWS(t, userID)
+
+	sendWS(t, conn, map[string]interface{}{"id": "1", "type": "subscribe", "collection_id": collection.ID})
+	readWS(t, conn, "1")
+	sendWS(t, conn, map[string]interface{}{"id": "2", "type": "delete", "asset_id": outside.ID})
+	sendWS(t, conn, map[string]interface{}{"id": "3", "type": "delete", "asset_id": inside.ID})
+	_, first := readWS(t, conn, "2")
+	_, second := readWS(t, conn, "3")
+	received := append(first, second...)
+	if len(received) == 0 {
+		var ev wsReply
+		conn.ReadJSON(&ev)
+		if ev.Event != nil {
+			received = append(received, *ev.Event)
+		}
+	}
+	if len(received) != 1 || received[0].Type != EventDeleted || received[0].AssetID != inside.ID {
+		t.Errorf("expected only the deletion of the collection's asset, got %+v", received)
+	}
+}
+
+func TestWebSocket_RequiresToken(t *testing.T) {
+	server := httptest.NewServer(wsTokenFromQuery(AuthMiddleware(handleWebSocket)))
+	defer server.Close()
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %v", err)
+	}
+}
+
+func TestWebSocket_RevokedShareStopsEvents(t *testing.T) {
+	resetStore()
+	ownerID, granteeID := uuid.New(), uuid.New()
+	revoked, kept := &Chart{ID: uuid.New(), Title: "Revoked"}, &Chart{ID: uuid.New(), Title: "Kept"}
+	store.AddUser(&User{ID: ownerID, Favourites: []Asset{revoked, kept}})
+	store.AddUser(&User{ID: granteeID})
+	revokedShare := &Share{ID: uuid.New(), OwnerID: ownerID, GranteeID: granteeID, AssetID: revoked.ID, Permission: PermRead}
+	store.PutShare(revokedShare)
+	store.PutShare(&Share{ID: uuid.New(), OwnerID: ownerID, GranteeID: granteeID, AssetID: kept.ID, Permission: PermRead})
+	ownerToken, _ := GenerateJWT(ownerID)
+	conn := dialWS(t, granteeID)
+	sendWS(t, conn, map[string]interface{}{"id": "1", "type": "subscribe", "asset_id": revoked.ID})
+	sendWS(t, conn, map[string]interface{}{"id": "2", "type": "subscribe", "asset_id": kept.ID})
+	readWS(t, conn, "2")
+
+	// The feed of the owner is ordered, so the edit of the kept asset is the
+	// next event once the revoked one is filtered out
+	store.RemoveShare(revokedShare.ID)
+	doRequest(t, handleEditFavourite, ownerToken, http.MethodPut, "/favourites/edit?asset_id="+revoked.ID.String(), map[string]string{"description": "hidden"})
+	doRequest(t, handleEditFavourite, ownerToken, http.MethodPut, "/favourites/edit?asset_id="+kept.ID.String(), map[string]string{"description": "seen"})
+	var reply wsReply
+	if err := conn.ReadJSON(&reply); err != nil || reply.Event == nil || reply.Event.AssetID != kept.ID {
+		t.Errorf("expected only the event of the kept asset, got %+v (%v)", reply, err)
+	}
+}
+
+func TestWebSocket_ClosesOnTokenExpiry(t *testing.T) {
+	resetStore()
+	userID := uuid.New()
+	store.AddUser(&User{ID: userID})
+	defer func(lifetime time.Duration) { tokenLifetime = lifetime }(tokenLifetime)
+	tokenLifetime = time.Second
+	conn := dialWS(t, userID)
+
+	var reply wsReply
+	if err := conn.ReadJSON(&reply); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("expected the socket closed when the token expires, got %+v (%v)", reply, err)
+	}
+}